@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+const defaultLogFile = "/var/log/sessionwarden/sessionwarden.log"
+
+// setupLogging sends logs to stderr (picked up by journald) and, if path is
+// set, appends them to that file too. Records below level are dropped, and
+// format is "text" or "json". Messages from the standard log package are
+// logged at info.
+func setupLogging(path, level, format string) error {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("invalid log level %q: expected debug, info, warn or error", level)
+	}
+
+	var out io.Writer = os.Stderr
+	if path != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+			return fmt.Errorf("failed to create log directory: %w", err)
+		}
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0640)
+		if err != nil {
+			return fmt.Errorf("failed to open log file: %w", err)
+		}
+		out = io.MultiWriter(os.Stderr, f)
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+	var handler slog.Handler
+	switch format {
+	case "text":
+		handler = slog.NewTextHandler(out, opts)
+	case "json":
+		handler = slog.NewJSONHandler(out, opts)
+	default:
+		return fmt.Errorf("invalid log format %q: expected text or json", format)
+	}
+
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
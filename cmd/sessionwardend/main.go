@@ -2,55 +2,155 @@ package main
 
 import (
 	"context"
-	"flag"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
 	"os"
 	"os/signal"
 	"os/user"
+	"path/filepath"
+	"strings"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/SoarinFerret/SessionWarden/internal/config"
 	"github.com/SoarinFerret/SessionWarden/internal/engine"
 	"github.com/SoarinFerret/SessionWarden/internal/ipc"
 	"github.com/SoarinFerret/SessionWarden/internal/loginctl"
+	"github.com/SoarinFerret/SessionWarden/internal/metrics"
+	"github.com/SoarinFerret/SessionWarden/internal/sdnotify"
 	"github.com/SoarinFerret/SessionWarden/internal/state"
+	"github.com/SoarinFerret/SessionWarden/internal/supervisor"
 	"github.com/godbus/dbus/v5"
+	"github.com/spf13/cobra"
 )
 
-func main() {
-	// Parse command line flags
-	userMode := flag.Bool("user", false, "Run in user mode (listen for notifications from system daemon)")
-	flag.Parse()
-
-	// If user mode, run notification listener only
-	if *userMode {
-		if err := runUserMode(); err != nil {
-			log.Fatal("User mode error:", err)
+const (
+	defaultConfigPath = "/etc/sessionwarden/config.toml"
+	defaultStateDir   = "/var/lib/sessionwarden"
+)
+
+var (
+	configPath  string
+	stateDir    string
+	stateStore  string
+	logFile     string
+	logLevel    string
+	logFormat   string
+	runAs       string
+	userMode    bool
+	metricsAddr string
+)
+
+var rootCmd = &cobra.Command{
+	Use:   "sessionwardend",
+	Short: "SessionWarden daemon",
+	Long: `sessionwardend tracks logind sessions, enforces SessionWarden policies and
+serves the D-Bus API used by swctl and the PAM module.
+
+With --user it instead runs as the per-user notification listener, showing
+the system daemon's notifications on the desktop.`,
+	Args:         cobra.MaximumNArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// The user-mode listener can't write to the system log file
+		if userMode && !cmd.Flags().Changed("log-file") {
+			logFile = ""
+		}
+		if err := setupLogging(logFile, logLevel, logFormat); err != nil {
+			return err
 		}
-		return
-	}
 
-	// Otherwise, run as system daemon
-	runSystemDaemon()
+		// If user mode, run notification listener only
+		if userMode {
+			if err := runUserMode(); err != nil {
+				return fmt.Errorf("user mode error: %w", err)
+			}
+			return nil
+		}
+
+		// The config path used to be a positional argument
+		if len(args) > 0 {
+			if cmd.Flags().Changed("config") {
+				return fmt.Errorf("config path given both as --config and as an argument")
+			}
+			slog.Warn("Passing the config path as an argument is deprecated, use --config")
+			configPath = args[0]
+		}
+
+		// Otherwise, run as system daemon
+		return runSystemDaemon()
+	},
 }
 
-func runSystemDaemon() {
-	// initialize the state manager
-	stateMgr, err := state.NewManager("state.json")
+func main() {
+	rootCmd.Flags().StringVarP(&configPath, "config", "c", defaultConfigPath, "Path to the config file")
+	rootCmd.Flags().StringVar(&stateDir, "state-dir", defaultStateDir, "Directory holding state.json and its backups")
+	rootCmd.Flags().StringVar(&stateStore, "store", "json", "State storage backend: json (single file) or journal (snapshot plus append-only journal)")
+	rootCmd.Flags().StringVar(&logFile, "log-file", defaultLogFile, "Also append logs to this file (empty to only log to stderr)")
+	rootCmd.Flags().StringVar(&logLevel, "log-level", "info", "Minimum log level: debug, info, warn or error")
+	rootCmd.Flags().StringVar(&logFormat, "log-format", "text", "Log format: text or json")
+	rootCmd.Flags().StringVar(&runAs, "run-as", "", "Drop root privileges to this user after start-up (e.g. sessionwarden)")
+	rootCmd.Flags().StringVar(&metricsAddr, "metrics-listen", "", "Serve Prometheus metrics at /metrics on unix:/path or a loopback host:port (empty to disable)")
+	rootCmd.Flags().BoolVar(&userMode, "user", false, "Run in user mode (listen for notifications from system daemon)")
+
+	if err := rootCmd.Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+func runSystemDaemon() error {
+	// load config
+	slog.Info("Loading config", "path", configPath)
+	config, err := config.LoadConfigFromFile(configPath)
 	if err != nil {
-		log.Fatal("Failed to initialize state manager:", err)
+		return fmt.Errorf("failed to load config %s: %w", configPath, err)
 	}
 
-	// check for argument to determine config location
-	argPath := "/etc/sessionwarden/config.toml"
-	if flag.NArg() > 0 {
-		argPath = flag.Arg(0)
+	if err := os.MkdirAll(stateDir, 0750); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	// The metrics listener is opened before dropping privileges, so a bad
+	// address fails start-up and the socket can go where only root can write
+	var metricsListener net.Listener
+	if metricsAddr != "" {
+		metricsListener, err = metrics.Listen(metricsAddr)
+		if err != nil {
+			return fmt.Errorf("failed to open metrics listener: %w", err)
+		}
+		defer metricsListener.Close()
+	}
+
+	if runAs != "" {
+		owned := []string{stateDir}
+		if path, ok := strings.CutPrefix(metricsAddr, "unix:"); ok {
+			owned = append(owned, path)
+		}
+		if err := dropPrivileges(runAs, owned...); err != nil {
+			return fmt.Errorf("failed to drop privileges to %s: %w", runAs, err)
+		}
+		slog.Info("Dropped privileges", "run_as", runAs)
+	}
+
+	warnAppPrivileges(config)
+
+	// initialize the state manager
+	statePath := filepath.Join(stateDir, "state.json")
+	var store state.Store
+	switch stateStore {
+	case "json":
+		store = state.NewFileStore(statePath)
+	case "journal":
+		store = state.NewJournalStore(statePath)
+	default:
+		return fmt.Errorf("unknown state store %q: expected json or journal", stateStore)
+	}
+	stateMgr, err := state.NewManagerWithStore(store)
+	if err != nil {
+		return fmt.Errorf("failed to initialize state manager: %w", err)
 	}
-	log.Println("Using config file at:", argPath)
-	// load config
-	config, err := config.LoadConfigFromFile(argPath)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -66,7 +166,7 @@ func runSystemDaemon() {
 	// Create the user engine (needs to be accessible by IPC)
 	userEngine, err := engine.NewEngine(stateMgr, config)
 	if err != nil {
-		log.Fatal("Failed to create user engine:", err)
+		return fmt.Errorf("failed to create user engine: %w", err)
 	}
 
 	// Create SessionManager for IPC and signal emission
@@ -75,44 +175,90 @@ func runSystemDaemon() {
 	// Set the notification emitter on the engine
 	userEngine.SetNotificationEmitter(sm)
 
-	var wg sync.WaitGroup
-
-	// Start the loginctl listener (system D-Bus)
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		log.Println("Monitoring dbus for session changes...")
-		if err := loginctl.Watch(ctx, stateMgr); err != nil {
-			log.Println("logind watcher error:", err)
+	// Ping the systemd watchdog every time the engine completes a check,
+	// so a wedged engine gets the daemon restarted
+	engineReady := make(chan struct{})
+	var engineReadyOnce sync.Once
+	collector := metrics.NewCollector(stateMgr, config)
+	userEngine.SetEnforceHook(collector.ObserveEnforcement)
+	userEngine.SetHeartbeatHook(func(checkDuration time.Duration) {
+		collector.ObserveCheck(checkDuration)
+		engineReadyOnce.Do(func() { close(engineReady) })
+		if _, err := sdnotify.Notify(sdnotify.Watchdog); err != nil {
+			slog.Warn("Failed to ping watchdog", "error", err)
 		}
-	}()
+	})
+	if interval, err := sdnotify.WatchdogInterval(); err != nil {
+		slog.Warn("Ignoring watchdog", "error", err)
+	} else if interval > 0 && interval < 2*time.Minute {
+		slog.Warn("Watchdog interval is shorter than the engine's check interval; use WatchdogSec of at least 2min", "interval", interval)
+	}
 
-	// Start your own DBus service (sessionwarden)
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		log.Println("Opening system D-Bus service...")
-		if err := serveSessionWarden(ctx, sm); err != nil {
-			log.Println("sessionwarden service error:", err)
-		}
-	}()
+	components := []supervisor.Component{
+		{
+			// Start the loginctl listener (system D-Bus)
+			Name: "logind watcher",
+			Run: func(ctx context.Context, ready func()) error {
+				slog.Info("Monitoring D-Bus for session changes")
+				return loginctl.Watch(ctx, stateMgr, ready)
+			},
+		},
+		{
+			// Start your own DBus service (sessionwarden)
+			Name: "sessionwarden D-Bus service",
+			Run: func(ctx context.Context, ready func()) error {
+				slog.Info("Opening system D-Bus service")
+				return serveSessionWarden(ctx, sm, ready)
+			},
+		},
+		{
+			// Start the user engine (periodic session checker); it is
+			// ready once the first check has completed
+			Name: "user engine",
+			Run: func(ctx context.Context, ready func()) error {
+				go func() {
+					select {
+					case <-engineReady:
+						ready()
+					case <-ctx.Done():
+					}
+				}()
+				return userEngine.Run(ctx)
+			},
+		},
+	}
 
-	// Start the user engine (periodic session checker)
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		if err := userEngine.Run(ctx); err != nil {
-			log.Println("user engine error:", err)
+	if metricsListener != nil {
+		components = append(components, supervisor.Component{
+			Name: "metrics endpoint",
+			Run: func(ctx context.Context, ready func()) error {
+				slog.Info("Serving metrics", "address", metricsAddr)
+				return metrics.Serve(ctx, metricsListener, collector, ready)
+			},
+		})
+	}
+
+	runErr := supervisor.Run(ctx, components, func() {
+		slog.Info("All components started")
+		if _, err := sdnotify.Notify(sdnotify.Ready); err != nil {
+			slog.Warn("Failed to notify systemd of readiness", "error", err)
 		}
-	}()
+	})
+	sdnotify.Notify(sdnotify.Stopping)
 
-	wg.Wait()
+	if err := stateMgr.Close(); err != nil {
+		slog.Error("Failed to save state on shutdown", "error", err)
+	}
+	if runErr != nil {
+		return runErr
+	}
 	fmt.Println("Shutdown complete")
+	return nil
 }
 
 // runUserMode runs the notification listener for user sessions
 func runUserMode() error {
-	log.Println("Starting sessionwardend in user mode (notification listener)...")
+	slog.Info("Starting sessionwardend in user mode (notification listener)")
 
 	// Get current username for filtering
 	currentUser, err := user.Current()
@@ -120,7 +266,7 @@ func runUserMode() error {
 		return fmt.Errorf("failed to get current user: %w", err)
 	}
 	username := currentUser.Username
-	log.Printf("Running in user mode for user: %s", username)
+	slog.Info("Running in user mode", "user", username)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -140,10 +286,11 @@ func runUserMode() error {
 	}
 	defer systemConn.Close()
 
-	// Subscribe to notification signals from system daemon
+	// Subscribe to notification signals from system daemon. Only Manager2's
+	// signal carries the urgency and tag.
 	if err := systemConn.AddMatchSignal(
 		dbus.WithMatchObjectPath(ipc.ObjectPath),
-		dbus.WithMatchInterface(ipc.InterfaceName),
+		dbus.WithMatchInterface(ipc.Interface2Name),
 		dbus.WithMatchMember("NotificationSignal"),
 	); err != nil {
 		return fmt.Errorf("failed to add match signal: %w", err)
@@ -159,16 +306,20 @@ func runUserMode() error {
 	signalChan := make(chan *dbus.Signal, 10)
 	systemConn.Signal(signalChan)
 
-	log.Println("Listening for notification signals from system daemon...")
+	slog.Info("Listening for notification signals from system daemon")
+
+	// IDs of the last notification shown for each tag, so the next one
+	// replaces it
+	replaces := make(map[string]uint32)
 
 	for {
 		select {
 		case <-ctx.Done():
-			log.Println("User mode shutting down...")
+			slog.Info("User mode shutting down")
 			return nil
 		case sig := <-signalChan:
-			if sig.Name == ipc.InterfaceName+".NotificationSignal" {
-				handleNotificationSignal(sessionConn, sig, username)
+			if sig.Name == ipc.Interface2Name+".NotificationSignal" {
+				handleNotificationSignal(sessionConn, sig, username, replaces)
 			}
 		}
 	}
@@ -176,61 +327,82 @@ func runUserMode() error {
 
 // handleNotificationSignal processes a notification signal and sends desktop notification
 // It filters notifications to only show those meant for the current user
-func handleNotificationSignal(conn *dbus.Conn, sig *dbus.Signal, currentUsername string) {
+// Tagged notifications replace the last one with the same tag (tracked in
+// replaces) and stay until dismissed
+func handleNotificationSignal(conn *dbus.Conn, sig *dbus.Signal, currentUsername string, replaces map[string]uint32) {
 	if len(sig.Body) < 3 {
-		log.Printf("Invalid notification signal: expected 3 arguments, got %d", len(sig.Body))
+		slog.Warn("Invalid notification signal: expected 3 arguments", "got", len(sig.Body))
 		return
 	}
 
 	targetUsername, ok := sig.Body[0].(string)
 	if !ok {
-		log.Printf("Invalid notification signal: username is not a string")
+		slog.Warn("Invalid notification signal: username is not a string")
 		return
 	}
 
 	// Filter: only process notifications for the current user
 	if targetUsername != currentUsername {
-		log.Printf("Ignoring notification for user %s (current user: %s)", targetUsername, currentUsername)
+		slog.Debug("Ignoring notification for another user", "user", targetUsername, "current_user", currentUsername)
 		return
 	}
 
 	title, ok := sig.Body[1].(string)
 	if !ok {
-		log.Printf("Invalid notification signal: title is not a string")
+		slog.Warn("Invalid notification signal: title is not a string")
 		return
 	}
 
 	message, ok := sig.Body[2].(string)
 	if !ok {
-		log.Printf("Invalid notification signal: message is not a string")
+		slog.Warn("Invalid notification signal: message is not a string")
 		return
 	}
 
-	log.Printf("Received notification signal for %s: %s - %s", currentUsername, title, message)
+	// Fall back to the legacy signal's three arguments
+	urgency := ipc.UrgencyNormal
+	tag := ""
+	if len(sig.Body) >= 5 {
+		if u, ok := sig.Body[3].(byte); ok {
+			urgency = u
+		}
+		tag, _ = sig.Body[4].(string)
+	}
+
+	slog.Info("Received notification signal", "user", currentUsername, "title", title, "message", message, "urgency", urgency, "tag", tag)
+
+	expireTimeout := int32(30000) // 30 seconds
+	if tag != "" {
+		expireTimeout = 0 // never expire
+	}
 
 	// Send desktop notification via org.freedesktop.Notifications
 	obj := conn.Object("org.freedesktop.Notifications", "/org/freedesktop/Notifications")
 	call := obj.Call("org.freedesktop.Notifications.Notify", 0,
 		"SessionWarden",  // app_name
-		uint32(0),        // replaces_id
+		replaces[tag],    // replaces_id (0 for a new notification)
 		"dialog-warning", // app_icon
 		title,            // summary
 		message,          // body
 		[]string{},       // actions
 		map[string]dbus.Variant{ // hints
-			"urgency": dbus.MakeVariant(byte(1)), // normal urgency
+			"urgency": dbus.MakeVariant(urgency),
 		},
-		int32(30000), // expire_timeout (30 seconds)
+		expireTimeout,
 	)
 
-	if call.Err != nil {
-		log.Printf("Failed to send desktop notification: %v", call.Err)
-	} else {
-		log.Printf("Successfully sent desktop notification: %s", title)
+	var id uint32
+	if err := call.Store(&id); err != nil {
+		slog.Error("Failed to send desktop notification", "error", err)
+		return
+	}
+	if tag != "" {
+		replaces[tag] = id
 	}
+	slog.Info("Sent desktop notification", "title", title, "id", id)
 }
 
-func serveSessionWarden(ctx context.Context, sm *ipc.SessionManager) error {
+func serveSessionWarden(ctx context.Context, sm *ipc.SessionManager, ready func()) error {
 	conn, err := dbus.ConnectSystemBus()
 	if err != nil {
 		return fmt.Errorf("failed to connect to system bus: %w", err)
@@ -238,17 +410,18 @@ func serveSessionWarden(ctx context.Context, sm *ipc.SessionManager) error {
 	defer conn.Close()
 
 	reply, err := conn.RequestName(ipc.ServiceName, dbus.NameFlagDoNotQueue)
-	if err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+	if err != nil {
 		return fmt.Errorf("failed to request name: %w", err)
 	}
+	if reply != dbus.RequestNameReplyPrimaryOwner {
+		return fmt.Errorf("failed to request name: %s is already owned", ipc.ServiceName)
+	}
 
-	sm.SetConnection(conn)
-
-	err = conn.Export(sm, dbus.ObjectPath(ipc.ObjectPath), ipc.InterfaceName)
-	if err != nil {
-		return fmt.Errorf("failed to export interface: %w", err)
+	if err := sm.Export(conn); err != nil {
+		return err
 	}
+	ready()
 
-	<-ctx.Done()
+	sm.ServeUserObjects(ctx)
 	return nil
 }
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/SoarinFerret/SessionWarden/internal/config"
+)
+
+// Capabilities the daemon needs to kill other users' apps and see their
+// executables, from linux/capability.h
+const (
+	capKill      = 5
+	capSysPtrace = 19
+)
+
+// dropPrivileges hands the given paths (recursively) to username and switches
+// the whole process to that user and its primary group. It must run before
+// any D-Bus connection is opened, since the bus authenticates by uid at
+// connect time.
+func dropPrivileges(username string, paths ...string) error {
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("must be started as root to switch users")
+	}
+
+	u, err := user.Lookup(username)
+	if err != nil {
+		return err
+	}
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return fmt.Errorf("invalid uid %q: %w", u.Uid, err)
+	}
+	gid, err := strconv.Atoi(u.Gid)
+	if err != nil {
+		return fmt.Errorf("invalid gid %q: %w", u.Gid, err)
+	}
+	if uid == 0 {
+		return fmt.Errorf("user %s is root", username)
+	}
+
+	// The state files may have been written by an earlier run as root
+	for _, root := range paths {
+		err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			return os.Lchown(path, uid, gid)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to give %s to %s: %w", root, username, err)
+		}
+	}
+
+	// Group changes must come first, since they need root
+	if err := syscall.Setgroups([]int{}); err != nil {
+		return fmt.Errorf("setgroups: %w", err)
+	}
+	if err := syscall.Setgid(gid); err != nil {
+		return fmt.Errorf("setgid: %w", err)
+	}
+	if err := syscall.Setuid(uid); err != nil {
+		return fmt.Errorf("setuid: %w", err)
+	}
+	return nil
+}
+
+// hasCapabilities reports whether the process has each of caps in its
+// effective set. Root normally has all of them, but a user switched to
+// with --run-as has none.
+func hasCapabilities(caps ...uint) bool {
+	status, err := os.ReadFile("/proc/self/status")
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(status), "\n") {
+		hex, ok := strings.CutPrefix(line, "CapEff:")
+		if !ok {
+			continue
+		}
+		effective, err := strconv.ParseUint(strings.TrimSpace(hex), 16, 64)
+		if err != nil {
+			return false
+		}
+		for _, c := range caps {
+			if effective&(1<<c) == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// warnAppPrivileges logs a warning if the config kills apps but the daemon
+// can't: without CAP_KILL the signals fail, and without CAP_SYS_PTRACE apps
+// can't be matched by executable.
+func warnAppPrivileges(cfg *config.Config) {
+	var users []string
+	for name, uc := range cfg.Users {
+		if len(uc.BlockedApps) > 0 || (len(uc.Apps) > 0 && uc.AppEnforceAction() == config.ActionTerminate) {
+			users = append(users, name)
+		}
+	}
+	if len(users) == 0 || hasCapabilities(capKill, capSysPtrace) {
+		return
+	}
+	slog.Warn("Blocked apps and app_action = \"terminate\" need CAP_KILL and CAP_SYS_PTRACE, which the daemon lacks; apps will not be killed",
+		"users", strings.Join(users, ","), "uid", os.Getuid())
+}
@@ -0,0 +1,70 @@
+package arg
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/spf13/cobra"
+
+	"github.com/SoarinFerret/SessionWarden/internal/ipc"
+)
+
+var attemptsCmd = &cobra.Command{
+	Use:   "attempts [username]",
+	Short: "List denied login attempts",
+	Long:  `List logins denied by policy in the last 30 days, for all users or a specific user if username is provided`,
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		username := ""
+		if len(args) > 0 {
+			username = args[0]
+		}
+
+		conn, err := dbus.ConnectSystemBus()
+		if err != nil {
+			log.Fatal("Failed to connect to system bus:", err)
+		}
+		defer conn.Close()
+
+		obj := conn.Object(ipc.ServiceName, dbus.ObjectPath(ipc.ObjectPath))
+
+		var attempts map[string][]ipc.LoginAttempt
+		err = obj.Call(ipc.Interface2Name+".ListLoginAttempts", 0, username).Store(&attempts)
+		if err != nil {
+			log.Fatal("Failed to list login attempts:", err)
+		}
+
+		users := make([]string, 0, len(attempts))
+		for user, entries := range attempts {
+			if len(entries) > 0 {
+				users = append(users, user)
+			}
+		}
+		if len(users) == 0 {
+			fmt.Println("No denied login attempts")
+			return
+		}
+		sort.Strings(users)
+
+		for _, user := range users {
+			fmt.Printf("\nUser: %s\n", user)
+			for _, entry := range attempts[user] {
+				fmt.Printf("  %s  %-14s", time.Unix(entry.Time, 0).Format("2006-01-02 15:04:05"), entry.Reason)
+				if entry.Service != "" {
+					fmt.Printf("  service: %s", entry.Service)
+				}
+				if entry.Phase != "" {
+					fmt.Printf("  phase: %s", entry.Phase)
+				}
+				fmt.Println()
+			}
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(attemptsCmd)
+}
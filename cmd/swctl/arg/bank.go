@@ -0,0 +1,88 @@
+package arg
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/spf13/cobra"
+
+	"github.com/SoarinFerret/SessionWarden/internal/ipc"
+)
+
+var bankCmd = &cobra.Command{
+	Use:   "bank",
+	Short: "Show or spend a user's saved time",
+	Long:  `Show or spend the unused daily allowance saved in a user's time bank`,
+}
+
+var bankShowCmd = &cobra.Command{
+	Use:   "show <username>",
+	Short: "Show a user's time bank balance",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		username := args[0]
+
+		conn, err := dbus.ConnectSystemBus()
+		if err != nil {
+			log.Fatal("Failed to connect to system bus:", err)
+		}
+		defer conn.Close()
+
+		obj := conn.Object(ipc.ServiceName, dbus.ObjectPath(ipc.ObjectPath))
+
+		var bank ipc.BankStatus
+		err = obj.Call(ipc.Interface2Name+".GetBank", 0, username).Store(&bank)
+		if err != nil {
+			log.Fatal("Failed to get time bank:", err)
+		}
+
+		fmt.Printf("Time bank for %s: %s\n", username, formatDuration(time.Duration(bank.Balance)*time.Second))
+		if bank.Today >= 0 {
+			fmt.Printf("  Unused today: %s (saved at the end of the day)\n", formatDuration(time.Duration(bank.Today)*time.Second))
+		} else {
+			fmt.Printf("  Spent today: %s\n", formatDuration(time.Duration(-bank.Today)*time.Second))
+		}
+		if bank.AutoSpend {
+			fmt.Println("  Spent automatically when the daily limit is reached")
+		}
+	},
+}
+
+var bankSpendCmd = &cobra.Command{
+	Use:   "spend <username> <duration>",
+	Short: "Spend saved time as extra time today",
+	Long: `Take time from a user's time bank and grant it as extra time today.
+Example:
+  swctl bank spend bob 45m`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		username := args[0]
+		d, err := time.ParseDuration(args[1])
+		if err != nil {
+			log.Fatalf("Invalid duration (use e.g. 45m or 1h30m): %v", err)
+		}
+
+		conn, err := dbus.ConnectSystemBus()
+		if err != nil {
+			log.Fatal("Failed to connect to system bus:", err)
+		}
+		defer conn.Close()
+
+		obj := conn.Object(ipc.ServiceName, dbus.ObjectPath(ipc.ObjectPath))
+
+		var id string
+		err = obj.Call(ipc.Interface2Name+".SpendBank", 0, username, int32(d.Minutes())).Store(&id)
+		if err != nil {
+			log.Fatal("Failed to spend time bank:", err)
+		}
+		fmt.Printf("Spent %s from %s's time bank (override %s)\n", formatDuration(d), username, id)
+	},
+}
+
+func init() {
+	bankCmd.AddCommand(bankShowCmd)
+	bankCmd.AddCommand(bankSpendCmd)
+	rootCmd.AddCommand(bankCmd)
+}
@@ -1,9 +1,10 @@
 package arg
 
 import (
-	"encoding/json"
 	"fmt"
 	"log"
+	"os"
+	"sort"
 	"strconv"
 	"time"
 
@@ -17,40 +18,52 @@ var (
 	extraTime    int
 	allowedHours string
 	expires      string
+	dailyLimit   string
+	block        bool
+	starts       string
+	repeatDays   string
 	reason       string
 )
 
 var overrideCmd = &cobra.Command{
 	Use:   "override",
 	Short: "Manage temporary policy overrides",
-	Long:  `Add, list, or remove temporary policy overrides for users`,
+	Long:  `Add, list, edit or remove temporary policy overrides for users`,
 }
 
 var overrideAddCmd = &cobra.Command{
 	Use:   "add <username>",
 	Short: "Add a temporary policy override for a user",
-	Long: `Add a temporary override to grant extra time or modify allowed hours.
+	Long: `Add a temporary override to change a user's time, limit or allowed hours.
 Examples:
   swctl override add alice --extra-time 60 --reason "Working on urgent project"
-  swctl override add bob --allowed-hours "18:00-22:00" --expires "2026-01-20T23:59:59"`,
+  swctl override add bob --allowed-hours "18:00-22:00" --expires "2026-01-20T23:59:59"
+  swctl override add bob --extra-time -30 --reason "Chores not done"
+  swctl override add bob --daily-limit 4h --allowed-hours "10:00-22:00"
+  swctl override add bob --block --starts "2026-03-02T00:00:00Z" --expires "2026-03-08T23:59:59Z"
+
+Overrides can start later and repeat on certain weekdays until they expire:
+  swctl override add bob --allowed-hours "16:00-23:00" --repeat fri \
+      --starts "2026-07-01T00:00:00Z" --expires "2026-07-31T23:59:59Z"
+  swctl override add bob --extra-time 30 --repeat sat --expires "2026-09-01T00:00:00Z"
+
+--repeat takes weekdays (e.g. "sat,sun"), "weekdays" or "weekends".`,
 	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		username := args[0]
 
-		if extraTime == 0 && allowedHours == "" {
-			log.Fatal("Must specify either --extra-time or --allowed-hours")
-		}
-
-		var expiresAt time.Time
-		var err error
-		if expires != "" {
-			expiresAt, err = time.Parse(time.RFC3339, expires)
-			if err != nil {
-				log.Fatalf("Invalid expires format (use RFC3339): %v", err)
+		fields := overrideFields(cmd)
+		if _, ok := fields["expires_at"]; !ok {
+			if repeatDays != "" {
+				log.Fatal("--repeat needs --expires, or the override would only last a day")
+			}
+			// Default: expire at the end of the day it starts
+			start := time.Now()
+			if starts != "" {
+				start = time.Unix(fields["starts_at"].Value().(int64), 0)
 			}
-		} else {
-			// Default: expire at end of day
-			expiresAt = time.Now().Truncate(24 * time.Hour).Add(24*time.Hour - time.Nanosecond)
+			expiresAt := time.Date(start.Year(), start.Month(), start.Day()+1, 0, 0, 0, 0, start.Location()).Add(-time.Nanosecond)
+			fields["expires_at"] = dbus.MakeVariant(expiresAt.Unix())
 		}
 
 		conn, err := dbus.ConnectSystemBus()
@@ -61,26 +74,89 @@ Examples:
 
 		obj := conn.Object(ipc.ServiceName, dbus.ObjectPath(ipc.ObjectPath))
 
-		err = obj.Call(ipc.InterfaceName+".AddOverride", 0,
-			username, reason, extraTime, allowedHours, expiresAt.Unix()).Store()
+		var id string
+		err = obj.Call(ipc.Interface2Name+".AddOverride", 0, username, fields).Store(&id)
 		if err != nil {
 			log.Fatal("Failed to add override:", err)
 		}
 
-		fmt.Printf("Override added for user: %s\n", username)
-		if extraTime > 0 {
-			fmt.Printf("  Extra time: %d minutes\n", extraTime)
+		fmt.Printf("Override %s added for user: %s\n", id, username)
+		if extraTime != 0 {
+			fmt.Printf("  Extra time: %+d minutes\n", extraTime)
+		}
+		if dailyLimit != "" {
+			fmt.Printf("  Daily limit: %s\n", dailyLimit)
+		}
+		if block {
+			fmt.Println("  Blocked: yes")
 		}
 		if allowedHours != "" {
 			fmt.Printf("  Allowed hours: %s\n", allowedHours)
 		}
-		fmt.Printf("  Expires: %s\n", expiresAt.Format(time.RFC3339))
+		if starts != "" {
+			fmt.Printf("  Starts: %s\n", starts)
+		}
+		if repeatDays != "" {
+			fmt.Printf("  Repeats: %s\n", repeatDays)
+		}
+		fmt.Printf("  Expires: %s\n", time.Unix(fields["expires_at"].Value().(int64), 0).Format(time.RFC3339))
 		if reason != "" {
 			fmt.Printf("  Reason: %s\n", reason)
 		}
 	},
 }
 
+// overrideFields returns the AddOverride or EditOverride fields for the
+// flags given on the command line
+func overrideFields(cmd *cobra.Command) map[string]dbus.Variant {
+	fields := make(map[string]dbus.Variant)
+	if cmd.Flags().Changed("extra-time") {
+		fields["extra_minutes"] = dbus.MakeVariant(int32(extraTime))
+	}
+	if cmd.Flags().Changed("daily-limit") {
+		var minutes int32
+		if dailyLimit != "" {
+			d, err := time.ParseDuration(dailyLimit)
+			if err != nil {
+				log.Fatalf("Invalid daily limit (use e.g. 1h30m): %v", err)
+			}
+			minutes = int32(d.Minutes())
+		}
+		fields["daily_limit_minutes"] = dbus.MakeVariant(minutes)
+	}
+	if cmd.Flags().Changed("block") {
+		fields["block"] = dbus.MakeVariant(block)
+	}
+	if cmd.Flags().Changed("allowed-hours") {
+		fields["allowed_hours"] = dbus.MakeVariant(allowedHours)
+	}
+	if cmd.Flags().Changed("starts") {
+		var startsAt int64
+		if starts != "" {
+			t, err := time.Parse(time.RFC3339, starts)
+			if err != nil {
+				log.Fatalf("Invalid starts format (use RFC3339): %v", err)
+			}
+			startsAt = t.Unix()
+		}
+		fields["starts_at"] = dbus.MakeVariant(startsAt)
+	}
+	if cmd.Flags().Changed("expires") {
+		expiresAt, err := time.Parse(time.RFC3339, expires)
+		if err != nil {
+			log.Fatalf("Invalid expires format (use RFC3339): %v", err)
+		}
+		fields["expires_at"] = dbus.MakeVariant(expiresAt.Unix())
+	}
+	if cmd.Flags().Changed("repeat") {
+		fields["repeat"] = dbus.MakeVariant(repeatDays)
+	}
+	if cmd.Flags().Changed("reason") {
+		fields["reason"] = dbus.MakeVariant(reason)
+	}
+	return fields
+}
+
 var overrideListCmd = &cobra.Command{
 	Use:   "list [username]",
 	Short: "List active overrides",
@@ -100,58 +176,124 @@ var overrideListCmd = &cobra.Command{
 
 		obj := conn.Object(ipc.ServiceName, dbus.ObjectPath(ipc.ObjectPath))
 
-		var jsonResult string
-		err = obj.Call(ipc.InterfaceName+".ListOverrides", 0, username).Store(&jsonResult)
+		var overrides map[string][]ipc.OverrideInfo
+		err = obj.Call(ipc.Interface2Name+".ListOverrides", 0, username).Store(&overrides)
 		if err != nil {
 			log.Fatal("Failed to list overrides:", err)
 		}
 
-		var overrides map[string][]map[string]interface{}
-		err = json.Unmarshal([]byte(jsonResult), &overrides)
-		if err != nil {
-			log.Fatal("Failed to parse response:", err)
+		users := make([]string, 0, len(overrides))
+		for user, userOverrides := range overrides {
+			if len(userOverrides) > 0 {
+				users = append(users, user)
+			}
 		}
-
-		if len(overrides) == 0 {
+		if len(users) == 0 {
 			fmt.Println("No active overrides")
 			return
 		}
+		sort.Strings(users)
 
-		for user, userOverrides := range overrides {
-			if len(userOverrides) == 0 {
-				continue
-			}
+		for _, user := range users {
 			fmt.Printf("\nUser: %s\n", user)
-			for idx, override := range userOverrides {
-				fmt.Printf("  [%d] ", idx)
-				if reason, ok := override["reason"].(string); ok && reason != "" {
-					fmt.Printf("Reason: %s, ", reason)
-				}
-				if extraTime, ok := override["extra_hours"].(float64); ok && extraTime > 0 {
-					fmt.Printf("Extra time: %d min, ", int(extraTime))
-				}
-				if allowedHours, ok := override["allowed_hours"].(string); ok && allowedHours != "" {
-					fmt.Printf("Allowed hours: %s, ", allowedHours)
-				}
-				if expiresAt, ok := override["expires_at"].(string); ok {
-					fmt.Printf("Expires: %s", expiresAt)
+			for _, override := range overrides[user] {
+				fmt.Printf("  [%s] ", override.Id)
+				if override.Reason != "" {
+					fmt.Printf("Reason: %s, ", override.Reason)
 				}
+				printOverrideDetails(override)
 				fmt.Println()
 			}
 		}
 	},
 }
 
+// printOverrideDetails prints what an override grants and when it applies
+func printOverrideDetails(o ipc.OverrideInfo) {
+	if o.ExtraMinutes != 0 {
+		fmt.Printf("Extra time: %+d min, ", o.ExtraMinutes)
+	}
+	if o.DailyLimitMinutes > 0 {
+		fmt.Printf("Daily limit: %s, ", time.Duration(o.DailyLimitMinutes)*time.Minute)
+	}
+	if o.Block {
+		fmt.Print("Blocked, ")
+	}
+	if o.AllowedHours != "" {
+		fmt.Printf("Allowed hours: %s, ", o.AllowedHours)
+	}
+	if o.Repeat != "" {
+		fmt.Printf("Repeats: %s, ", o.Repeat)
+	}
+	if o.StartsAt != 0 {
+		fmt.Printf("Starts: %s, ", time.Unix(o.StartsAt, 0).Format("2006-01-02 15:04"))
+	}
+	fmt.Printf("Expires: %s", time.Unix(o.ExpiresAt, 0).Format("2006-01-02 15:04"))
+	if o.CreatedBy != "" {
+		fmt.Printf(", Granted by: %s", o.CreatedBy)
+	}
+	if o.CreatedAt != 0 {
+		fmt.Printf(" at %s", time.Unix(o.CreatedAt, 0).Format("2006-01-02 15:04"))
+	}
+}
+
 var overrideRemoveCmd = &cobra.Command{
-	Use:   "remove <username> <index>",
-	Short: "Remove an override by index",
-	Long:  `Remove an override for a user by its index (use 'override list' to see indices)`,
-	Args:  cobra.ExactArgs(2),
+	Use:   "remove <id>",
+	Short: "Remove an override by ID",
+	Long: `Remove an override by its ID (use 'override list' to see IDs).
+
+The old form, 'remove <username> <index>', still works but is deprecated:
+indices shift as overrides expire or are removed.`,
+	Args: cobra.RangeArgs(1, 2),
 	Run: func(cmd *cobra.Command, args []string) {
-		username := args[0]
-		index, err := strconv.Atoi(args[1])
+		conn, err := dbus.ConnectSystemBus()
+		if err != nil {
+			log.Fatal("Failed to connect to system bus:", err)
+		}
+		defer conn.Close()
+
+		obj := conn.Object(ipc.ServiceName, dbus.ObjectPath(ipc.ObjectPath))
+
+		if len(args) == 2 {
+			username := args[0]
+			index, err := strconv.Atoi(args[1])
+			if err != nil {
+				log.Fatal("Invalid index (must be a number):", err)
+			}
+			fmt.Fprintln(os.Stderr, "Warning: removing by index is deprecated, use 'swctl override remove <id>'")
+
+			err = obj.Call(ipc.InterfaceName+".RemoveOverride", 0, username, index).Store()
+			if err != nil {
+				log.Fatal("Failed to remove override:", err)
+			}
+			fmt.Printf("Override %d removed for user: %s\n", index, username)
+			return
+		}
+
+		id := args[0]
+		err = obj.Call(ipc.Interface2Name+".RemoveOverride", 0, id).Store()
 		if err != nil {
-			log.Fatal("Invalid index (must be a number):", err)
+			log.Fatal("Failed to remove override:", err)
+		}
+		fmt.Printf("Override %s removed\n", id)
+	},
+}
+
+var overrideEditCmd = &cobra.Command{
+	Use:   "edit <id>",
+	Short: "Change an existing override",
+	Long: `Change an existing override. Only the given flags are changed.
+Examples:
+  swctl override edit 3f9a1c07 --extra-time 90
+  swctl override edit 3f9a1c07 --expires "2026-01-20T23:59:59"
+  swctl override edit 3f9a1c07 --repeat "" --starts ""`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		id := args[0]
+
+		changes := overrideFields(cmd)
+		if len(changes) == 0 {
+			log.Fatal("Nothing to change: give at least one of --extra-time, --daily-limit, --block, --allowed-hours, --starts, --expires, --repeat or --reason")
 		}
 
 		conn, err := dbus.ConnectSystemBus()
@@ -162,23 +304,36 @@ var overrideRemoveCmd = &cobra.Command{
 
 		obj := conn.Object(ipc.ServiceName, dbus.ObjectPath(ipc.ObjectPath))
 
-		err = obj.Call(ipc.InterfaceName+".RemoveOverride", 0, username, index).Store()
+		err = obj.Call(ipc.Interface2Name+".EditOverride", 0, id, changes).Store()
 		if err != nil {
-			log.Fatal("Failed to remove override:", err)
+			log.Fatal("Failed to edit override:", err)
 		}
-
-		fmt.Printf("Override %d removed for user: %s\n", index, username)
+		fmt.Printf("Override %s updated\n", id)
 	},
 }
 
 func init() {
-	overrideAddCmd.Flags().IntVarP(&extraTime, "extra-time", "t", 0, "Extra time in minutes")
+	overrideAddCmd.Flags().IntVarP(&extraTime, "extra-time", "t", 0, "Extra time in minutes (negative to take time away)")
+	overrideAddCmd.Flags().StringVarP(&dailyLimit, "daily-limit", "l", "", "Daily limit to use instead of the configured one (e.g. 1h30m)")
+	overrideAddCmd.Flags().BoolVarP(&block, "block", "b", false, "Deny logins entirely while the override is active")
 	overrideAddCmd.Flags().StringVarP(&allowedHours, "allowed-hours", "a", "", "Override allowed hours (format: HH:MM-HH:MM)")
 	overrideAddCmd.Flags().StringVarP(&expires, "expires", "e", "", "Expiration time (RFC3339 format)")
+	overrideAddCmd.Flags().StringVarP(&starts, "starts", "s", "", "Start time, if not now (RFC3339 format)")
+	overrideAddCmd.Flags().StringVar(&repeatDays, "repeat", "", "Only apply on these weekdays (e.g. sat,sun, weekdays or weekends)")
 	overrideAddCmd.Flags().StringVarP(&reason, "reason", "r", "", "Reason for override")
 
 	overrideCmd.AddCommand(overrideAddCmd)
 	overrideCmd.AddCommand(overrideListCmd)
+	overrideEditCmd.Flags().IntVarP(&extraTime, "extra-time", "t", 0, "Extra time in minutes (negative to take time away, 0 for none)")
+	overrideEditCmd.Flags().StringVarP(&dailyLimit, "daily-limit", "l", "", "Daily limit (e.g. 1h30m, empty to use the configured one)")
+	overrideEditCmd.Flags().BoolVarP(&block, "block", "b", false, "Deny logins entirely (--block=false to stop)")
+	overrideEditCmd.Flags().StringVarP(&allowedHours, "allowed-hours", "a", "", "Allowed hours (format: HH:MM-HH:MM, empty for the configured hours)")
+	overrideEditCmd.Flags().StringVarP(&expires, "expires", "e", "", "Expiration time (RFC3339 format)")
+	overrideEditCmd.Flags().StringVarP(&starts, "starts", "s", "", "Start time (RFC3339 format, empty to start now)")
+	overrideEditCmd.Flags().StringVar(&repeatDays, "repeat", "", "Only apply on these weekdays (empty for every day)")
+	overrideEditCmd.Flags().StringVarP(&reason, "reason", "r", "", "Reason for override")
+
 	overrideCmd.AddCommand(overrideRemoveCmd)
+	overrideCmd.AddCommand(overrideEditCmd)
 	rootCmd.AddCommand(overrideCmd)
 }
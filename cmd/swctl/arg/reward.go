@@ -0,0 +1,100 @@
+package arg
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/spf13/cobra"
+
+	"github.com/SoarinFerret/SessionWarden/internal/ipc"
+)
+
+var rewardCmd = &cobra.Command{
+	Use:   "reward <username> <+duration> [reason]",
+	Short: "Give a user extra time today or this week",
+	Long: `Record a reward in a user's ledger, adding to today's limit or, with
+--week, to this week's: it can be spent on any day until the end of the
+week, but only once.
+Example:
+  swctl reward bob +30m "did dishes"`,
+	Args: cobra.RangeArgs(2, 3),
+	Run: func(cmd *cobra.Command, args []string) {
+		addLedgerEntry(cmd, args, false)
+	},
+}
+
+var penalizeCmd = &cobra.Command{
+	Use:   "penalize <username> <-duration> [reason]",
+	Short: "Take time away from a user today or this week",
+	Long: `Record a penalty in a user's ledger, taking from today's limit or, with
+--week, from this week's: it is taken once, from today unless rewards for
+the week make up for it.
+Example:
+  swctl penalize bob -20m "late to dinner"`,
+	Args: cobra.RangeArgs(2, 3),
+	Run: func(cmd *cobra.Command, args []string) {
+		addLedgerEntry(cmd, args, true)
+	},
+}
+
+// addLedgerEntry records a reward or penalty from the reward and penalize
+// arguments. Penalties are always negative, whatever their sign.
+func addLedgerEntry(cmd *cobra.Command, args []string, penalty bool) {
+	username := args[0]
+	d, err := time.ParseDuration(strings.TrimPrefix(args[1], "+"))
+	if err != nil {
+		log.Fatalf("Invalid duration (use e.g. +30m or -1h): %v", err)
+	}
+	if d < 0 {
+		d = -d
+	}
+	if d < time.Minute {
+		log.Fatal("Duration must be at least one minute")
+	}
+	minutes := int32(d.Minutes())
+	if penalty {
+		minutes = -minutes
+	}
+
+	var reason string
+	if len(args) > 2 {
+		reason = args[2]
+	}
+	scope := "day"
+	if week, _ := cmd.Flags().GetBool("week"); week {
+		scope = "week"
+	}
+
+	conn, err := dbus.ConnectSystemBus()
+	if err != nil {
+		log.Fatal("Failed to connect to system bus:", err)
+	}
+	defer conn.Close()
+
+	obj := conn.Object(ipc.ServiceName, dbus.ObjectPath(ipc.ObjectPath))
+
+	err = obj.Call(ipc.Interface2Name+".AddLedgerEntry", 0, username, minutes, scope, reason).Store()
+	if err != nil {
+		log.Fatal("Failed to add ledger entry:", err)
+	}
+
+	when := "today"
+	if scope == "week" {
+		when = "this week"
+	}
+	if penalty {
+		fmt.Printf("Took %s from %s %s\n", formatDuration(d), username, when)
+	} else {
+		fmt.Printf("Gave %s %s extra %s\n", username, formatDuration(d), when)
+	}
+}
+
+func init() {
+	for _, c := range []*cobra.Command{rewardCmd, penalizeCmd} {
+		c.Flags().BoolP("week", "w", false, "Apply once to the rest of the week instead of today")
+		rootCmd.AddCommand(c)
+	}
+}
@@ -0,0 +1,120 @@
+package arg
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/SoarinFerret/SessionWarden/internal/config"
+	"github.com/SoarinFerret/SessionWarden/internal/simulate"
+)
+
+var (
+	simConfigPath string
+	simUser       string
+	simEventsPath string
+	simUntil      string
+	simJSON       bool
+	simVerbose    bool
+)
+
+var simulateCmd = &cobra.Command{
+	Use:   "simulate",
+	Short: "Dry-run a policy against a sequence of session events",
+	Long: `Replay scripted or recorded logins, locks and sleeps through the policy
+engine using a simulated clock, and print the resulting timeline of
+notifications, lock actions and denied logins. Nothing is sent to the daemon.
+
+The events file is a JSON array, for example:
+  [
+    {"time": "2026-01-19T15:00:00-06:00", "type": "login", "session": "1"},
+    {"time": "2026-01-19T16:10:00-06:00", "type": "lock", "session": "1"},
+    {"time": "2026-01-19T16:30:00-06:00", "type": "unlock", "session": "1"},
+    {"time": "2026-01-19T21:00:00-06:00", "type": "logout", "session": "1"}
+  ]
+
+Event types: login, logout, lock, unlock, sleep, wake. Login events may also
+set "session_type", "remote" and "service" to exercise session policies.
+
+Examples:
+  swctl simulate --config new.toml --user bob --events events.json
+  swctl simulate -c new.toml -u bob -e events.json --until 2026-01-19T23:59:00-06:00`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := config.LoadConfigFromFile(simConfigPath)
+		if err != nil {
+			log.Fatalf("Failed to load config %s: %v", simConfigPath, err)
+		}
+
+		events, err := simulate.LoadEvents(simEventsPath)
+		if err != nil {
+			log.Fatalf("Failed to load events %s: %v", simEventsPath, err)
+		}
+
+		var opts simulate.Options
+		if simUntil != "" {
+			opts.Until, err = time.Parse(time.RFC3339, simUntil)
+			if err != nil {
+				log.Fatalf("Invalid until format (use RFC3339): %v", err)
+			}
+		}
+
+		// The state manager logs as it would in the daemon; keep the
+		// timeline readable unless asked otherwise
+		if !simVerbose {
+			log.SetOutput(io.Discard)
+		}
+		timeline, err := simulate.Run(*cfg, simUser, events, opts)
+		log.SetOutput(os.Stderr)
+		if err != nil {
+			log.Fatal("Simulation failed:", err)
+		}
+
+		if simJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(timeline); err != nil {
+				log.Fatal("Failed to encode timeline:", err)
+			}
+			return
+		}
+
+		fmt.Printf("Simulated timeline for user: %s\n", simUser)
+		fmt.Println("=" + repeat("=", len(simUser)+29))
+
+		lastDay := ""
+		for _, entry := range timeline {
+			day := entry.Time.Format("2006-01-02 (Mon)")
+			if day != lastDay {
+				fmt.Printf("\n%s\n", day)
+				lastDay = day
+			}
+			fmt.Printf("  %s  %-14s", entry.Time.Format("15:04"), entry.Action)
+			if entry.Session != "" {
+				fmt.Printf("  [%s]", entry.Session)
+			}
+			if entry.Message != "" {
+				fmt.Printf("  %s", entry.Message)
+			}
+			fmt.Println()
+		}
+	},
+}
+
+func init() {
+	simulateCmd.Flags().StringVarP(&simConfigPath, "config", "c", "/etc/sessionwarden/config.toml", "Config file to evaluate")
+	simulateCmd.Flags().StringVarP(&simUser, "user", "u", "", "User to simulate")
+	simulateCmd.Flags().StringVarP(&simEventsPath, "events", "e", "", "JSON file of session events")
+	simulateCmd.Flags().StringVar(&simUntil, "until", "", "Keep the clock running until this time (RFC3339 format)")
+	simulateCmd.Flags().BoolVar(&simJSON, "json", false, "Print the timeline as JSON")
+	simulateCmd.Flags().BoolVarP(&simVerbose, "verbose", "v", false, "Show state manager log output")
+	simulateCmd.MarkFlagRequired("user")
+	simulateCmd.MarkFlagRequired("events")
+
+	rootCmd.AddCommand(simulateCmd)
+}
@@ -0,0 +1,98 @@
+package arg
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/spf13/cobra"
+
+	"github.com/SoarinFerret/SessionWarden/internal/state"
+)
+
+var stateFile string
+
+var stateCmd = &cobra.Command{
+	Use:   "state",
+	Short: "Verify or restore the daemon's state file",
+	Long: `Check the state file and its backups, or restore a backup after corruption.
+These commands work on the files directly, so they can be used while the
+daemon is stopped.`,
+}
+
+var stateVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check the state file and its backups",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ok := printStateFile(stateFile)
+		for n := 1; n <= state.BackupCount; n++ {
+			printStateFile(state.BackupPath(stateFile, n))
+		}
+		if !ok {
+			os.Exit(1)
+		}
+	},
+}
+
+var stateRestoreCmd = &cobra.Command{
+	Use:   "restore [backup-number]",
+	Short: "Restore the state file from a backup",
+	Long: `Replace the state file with a backup (1 is the newest). Without a backup
+number, the newest valid backup is used. The replaced file is kept with a
+.pre-restore suffix.
+
+Stop sessionwardend first, or it will overwrite the restored file.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		n := 0
+		if len(args) > 0 {
+			var err error
+			n, err = strconv.Atoi(args[0])
+			if err != nil || n < 1 || n > state.BackupCount {
+				log.Fatalf("Invalid backup number %q: must be between 1 and %d", args[0], state.BackupCount)
+			}
+		} else {
+			for i := 1; i <= state.BackupCount; i++ {
+				if _, err := state.VerifyFile(state.BackupPath(stateFile, i)); err == nil {
+					n = i
+					break
+				}
+			}
+			if n == 0 {
+				log.Fatal("No valid backup found")
+			}
+		}
+
+		if err := state.RestoreBackup(stateFile, n); err != nil {
+			log.Fatal("Failed to restore backup:", err)
+		}
+		fmt.Printf("Restored %s from %s\n", stateFile, state.BackupPath(stateFile, n))
+	},
+}
+
+// printStateFile prints whether the state file at path loads, returning
+// false if it exists but is invalid
+func printStateFile(path string) bool {
+	s, err := state.VerifyFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		fmt.Printf("%-45s missing\n", path)
+		return true
+	case err != nil:
+		fmt.Printf("%-45s INVALID: %v\n", path, err)
+		return false
+	}
+	fmt.Printf("%-45s ok (%d users, last written %s)\n",
+		path, len(s.Users), s.HeartBeat.Format("2006-01-02 15:04:05"))
+	return true
+}
+
+func init() {
+	stateCmd.PersistentFlags().StringVarP(&stateFile, "file", "f", "/var/lib/sessionwarden/state.json", "Path to the state file")
+	stateCmd.AddCommand(stateVerifyCmd)
+	stateCmd.AddCommand(stateRestoreCmd)
+	rootCmd.AddCommand(stateCmd)
+}
@@ -1,9 +1,9 @@
 package arg
 
 import (
-	"encoding/json"
 	"fmt"
 	"log"
+	"os/user"
 	"time"
 
 	"github.com/godbus/dbus/v5"
@@ -13,12 +13,21 @@ import (
 )
 
 var userCmd = &cobra.Command{
-	Use:   "user <username>",
+	Use:   "user [username]",
 	Short: "Show detailed status for a user",
-	Long:  `Display detailed session information, time usage, and active overrides for a user`,
-	Args:  cobra.ExactArgs(1),
+	Long:  `Display detailed session information, time usage, active overrides, and rewards and penalties for a user (yourself, by default)`,
+	Args:  cobra.MaximumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		username := args[0]
+		var username string
+		if len(args) > 0 {
+			username = args[0]
+		} else {
+			current, err := user.Current()
+			if err != nil {
+				log.Fatal("Failed to get current user:", err)
+			}
+			username = current.Username
+		}
 
 		conn, err := dbus.ConnectSystemBus()
 		if err != nil {
@@ -28,100 +37,48 @@ var userCmd = &cobra.Command{
 
 		obj := conn.Object(ipc.ServiceName, dbus.ObjectPath(ipc.ObjectPath))
 
-		var jsonResult string
-		err = obj.Call(ipc.InterfaceName+".GetUserStatus", 0, username).Store(&jsonResult)
+		var status ipc.UserStatus
+		err = obj.Call(ipc.Interface2Name+".GetUserStatus", 0, username).Store(&status)
 		if err != nil {
 			log.Fatal("Failed to get user status:", err)
 		}
 
-		var userData map[string]interface{}
-		err = json.Unmarshal([]byte(jsonResult), &userData)
-		if err != nil {
-			log.Fatal("Failed to parse response:", err)
-		}
-
 		fmt.Printf("User: %s\n", username)
 		fmt.Println("=" + repeat("=", len(username)+5))
 
 		// Paused status
-		if paused, ok := userData["paused"].(bool); ok && paused {
+		if status.Paused {
 			fmt.Println("Status: PAUSED")
 		} else {
 			fmt.Println("Status: Active")
 		}
 
 		// Time usage
-		if timeUsed, ok := userData["time_used_seconds"].(float64); ok {
-			duration := time.Duration(int64(timeUsed)) * time.Second
-			fmt.Printf("Time used today: %s\n", formatDuration(duration))
+		fmt.Printf("Time used today: %s\n", formatDuration(time.Duration(status.TimeUsed)*time.Second))
+		if status.TimeRemaining >= 0 {
+			fmt.Printf("Time remaining: %s\n", formatDuration(time.Duration(status.TimeRemaining)*time.Second))
 		}
 
 		// Active sessions
-		if sessions, ok := userData["sessions"].([]interface{}); ok && len(sessions) > 0 {
-			fmt.Printf("\nActive Sessions (%d):\n", countActiveSessions(sessions))
-			for _, s := range sessions {
-				sessionMap, ok := s.(map[string]interface{})
-				if !ok {
-					continue
-				}
-
-				// Check if session is active (no end time)
-				if endTimeStr, ok := sessionMap["end"].(string); ok && endTimeStr != "" {
-					if endTime, err := time.Parse(time.RFC3339, endTimeStr); err == nil && !endTime.IsZero() {
-						continue // Skip ended sessions
-					}
-				}
-
-				if sessionID, ok := sessionMap["session_id"].(string); ok {
-					fmt.Printf("  Session: %s\n", sessionID)
-				}
-				if startStr, ok := sessionMap["start"].(string); ok {
-					if startTime, err := time.Parse(time.RFC3339, startStr); err == nil {
-						fmt.Printf("    Started: %s (%s ago)\n",
-							startTime.Format("15:04:05"),
-							time.Since(startTime).Round(time.Second))
-					}
-				}
-
-				// Show segment info
-				if segments, ok := sessionMap["segments"].([]interface{}); ok {
-					activeSegment := false
-					var totalDuration time.Duration
-					for _, seg := range segments {
-						segMap, ok := seg.(map[string]interface{})
-						if !ok {
-							continue
-						}
-						startStr, _ := segMap["start"].(string)
-						endStr, _ := segMap["stop"].(string)
-
-						if startStr != "" {
-							start, err := time.Parse(time.RFC3339, startStr)
-							if err != nil {
-								continue
-							}
-
-							var end time.Time
-							if endStr != "" {
-								end, err = time.Parse(time.RFC3339, endStr)
-								if err != nil {
-									continue
-								}
-							} else {
-								// Active segment
-								end = time.Now()
-								activeSegment = true
-							}
-
-							totalDuration += end.Sub(start)
-						}
-					}
-					fmt.Printf("    Active time: %s\n", formatDuration(totalDuration))
-					if activeSegment {
-						fmt.Printf("    Status: Currently active\n")
-					} else {
-						fmt.Printf("    Status: Idle\n")
-					}
+		var active []ipc.SessionStatus
+		for _, s := range status.Sessions {
+			if s.End == 0 {
+				active = append(active, s)
+			}
+		}
+		if len(active) > 0 {
+			fmt.Printf("\nActive Sessions (%d):\n", len(active))
+			for _, s := range active {
+				startTime := time.Unix(s.Start, 0)
+				fmt.Printf("  Session: %s\n", s.Id)
+				fmt.Printf("    Started: %s (%s ago)\n",
+					startTime.Format("15:04:05"),
+					time.Since(startTime).Round(time.Second))
+				fmt.Printf("    Active time: %s\n", formatDuration(time.Duration(s.ActiveSeconds)*time.Second))
+				if s.Idle {
+					fmt.Printf("    Status: Idle\n")
+				} else {
+					fmt.Printf("    Status: Currently active\n")
 				}
 			}
 		} else {
@@ -129,30 +86,52 @@ var userCmd = &cobra.Command{
 		}
 
 		// Overrides
-		if overrides, ok := userData["exceptions"].([]interface{}); ok && len(overrides) > 0 {
-			fmt.Printf("\nActive Overrides (%d):\n", len(overrides))
-			for idx, o := range overrides {
-				overrideMap, ok := o.(map[string]interface{})
-				if !ok {
-					continue
+		if len(status.Overrides) > 0 {
+			fmt.Printf("\nActive Overrides (%d):\n", len(status.Overrides))
+			for _, o := range status.Overrides {
+				fmt.Printf("  [%s] ", o.Id)
+				if o.Reason != "" {
+					fmt.Printf("Reason: %s\n      ", o.Reason)
 				}
+				printOverrideDetails(o)
+				fmt.Println()
+			}
+		}
+
+		// App usage
+		var apps []ipc.AppStatus
+		if err := obj.Call(ipc.Interface2Name+".GetAppUsage", 0, username).Store(&apps); err != nil {
+			log.Fatal("Failed to get app usage:", err)
+		}
+		if len(apps) > 0 {
+			fmt.Printf("\nApp Usage (%d):\n", len(apps))
+			for _, a := range apps {
+				fmt.Printf("  %s: %s of %s\n", a.Name,
+					formatDuration(time.Duration(a.Used)*time.Second),
+					formatDuration(time.Duration(a.Budget)*time.Second))
+			}
+		}
 
-				fmt.Printf("  [%d] ", idx)
-				if reason, ok := overrideMap["reason"].(string); ok && reason != "" {
-					fmt.Printf("Reason: %s\n      ", reason)
+		// Ledger
+		if len(status.Ledger) > 0 {
+			fmt.Printf("\nRewards and Penalties (%d):\n", len(status.Ledger))
+			for _, e := range status.Ledger {
+				sign := "+"
+				if e.Minutes < 0 {
+					sign = "-"
 				}
-				if extraTime, ok := overrideMap["extra_hours"].(float64); ok && extraTime > 0 {
-					fmt.Printf("Extra time: %d min, ", int(extraTime))
+				fmt.Printf("  %s%s", sign, formatDuration(time.Duration(abs(e.Minutes))*time.Minute))
+				if e.Scope == "week" {
+					fmt.Print(" this week")
 				}
-				if allowedHours, ok := overrideMap["allowed_hours"].(string); ok && allowedHours != "" {
-					fmt.Printf("Allowed hours: %s, ", allowedHours)
+				if e.Reason != "" {
+					fmt.Printf(": %s", e.Reason)
 				}
-				if expiresAt, ok := overrideMap["expires_at"].(string); ok {
-					if exp, err := time.Parse(time.RFC3339, expiresAt); err == nil {
-						fmt.Printf("Expires: %s", exp.Format("2006-01-02 15:04"))
-					}
+				fmt.Printf(" (%s", time.Unix(e.Time, 0).Format("Mon 15:04"))
+				if e.By != "" {
+					fmt.Printf(" by %s", e.By)
 				}
-				fmt.Println()
+				fmt.Println(")")
 			}
 		}
 	},
@@ -162,6 +141,13 @@ func init() {
 	rootCmd.AddCommand(userCmd)
 }
 
+func abs(n int32) int32 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
 func repeat(s string, count int) string {
 	result := ""
 	for i := 0; i < count; i++ {
@@ -185,22 +171,3 @@ func formatDuration(d time.Duration) string {
 	}
 	return fmt.Sprintf("%ds", s)
 }
-
-func countActiveSessions(sessions []interface{}) int {
-	count := 0
-	for _, s := range sessions {
-		sessionMap, ok := s.(map[string]interface{})
-		if !ok {
-			continue
-		}
-
-		// Check if session is active (no end time or zero end time)
-		if endTimeStr, ok := sessionMap["end"].(string); ok && endTimeStr != "" {
-			if endTime, err := time.Parse(time.RFC3339, endTimeStr); err == nil && !endTime.IsZero() {
-				continue // Skip ended sessions
-			}
-		}
-		count++
-	}
-	return count
-}
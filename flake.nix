@@ -79,6 +79,43 @@
                 This will be written to /etc/sessionwarden/config.toml
               '';
             };
+
+            runAs = lib.mkOption {
+              type = lib.types.nullOr lib.types.str;
+              default = "sessionwarden";
+              description = ''
+                User the daemon runs as. The user is created, allowed to
+                lock and terminate sessions through polkit, and given
+                CAP_KILL and CAP_SYS_PTRACE to kill blocked apps.
+                Set to null to run as root.
+              '';
+            };
+
+            logLevel = lib.mkOption {
+              type = lib.types.enum [ "debug" "info" "warn" "error" ];
+              default = "info";
+              description = "Minimum level of messages the daemon logs.";
+            };
+
+            metricsListen = lib.mkOption {
+              type = lib.types.nullOr lib.types.str;
+              default = null;
+              example = "unix:/run/sessionwarden/metrics.sock";
+              description = ''
+                Serve Prometheus metrics at /metrics on this unix socket
+                (unix:/path) or loopback address (e.g. 127.0.0.1:9477).
+              '';
+            };
+
+            pamArgs = lib.mkOption {
+              type = lib.types.listOf lib.types.str;
+              default = [ ];
+              example = [ "timeout_ms=5000" "fail_open" "debug" ];
+              description = ''
+                Arguments passed to pam_sessionwarden.so, e.g. bypass_group=,
+                timeout_ms=, fail_open/fail_closed, debug and log_file=.
+              '';
+            };
           };
 
           config = lib.mkIf cfg.enable {
@@ -93,13 +130,54 @@
               wantedBy = [ "multi-user.target" ];
               after = [ "network.target" "dbus.service" ];
               serviceConfig = {
-                Type = "simple";
-                ExecStart = "${sessionwarden}/bin/sessionwardend";
-                User = "root";
+                # Ready once the logind watcher, D-Bus service and engine
+                # are all up; the engine pings the watchdog every minute
+                Type = "notify";
+                WatchdogSec = "3min";
+                ExecStart = lib.concatStringsSep " " ([
+                  "${sessionwarden}/bin/sessionwardend"
+                  "--config /etc/sessionwarden/config.toml"
+                  "--state-dir /var/lib/sessionwarden"
+                  "--log-level ${cfg.logLevel}"
+                ] ++ lib.optional (cfg.metricsListen != null) "--metrics-listen ${cfg.metricsListen}");
+                # systemd hands the directories below to the user. The
+                # capabilities, which --run-as would lose, let it signal
+                # other users' apps and read their executables.
+                User = if cfg.runAs != null then cfg.runAs else "root";
+                AmbientCapabilities = lib.mkIf (cfg.runAs != null) [ "CAP_KILL" "CAP_SYS_PTRACE" ];
+                CapabilityBoundingSet = lib.mkIf (cfg.runAs != null) [ "CAP_KILL" "CAP_SYS_PTRACE" ];
+                StateDirectory = "sessionwarden";
+                StateDirectoryMode = "0750";
+                LogsDirectory = "sessionwarden";
+                # Holds the metrics socket, if any
+                RuntimeDirectory = "sessionwarden";
                 Restart = "on-failure";
               };
             };
 
+            users.users = lib.mkIf (cfg.runAs == "sessionwarden") {
+              sessionwarden = {
+                isSystemUser = true;
+                group = "sessionwarden";
+                description = "SessionWarden daemon";
+              };
+            };
+            users.groups = lib.mkIf (cfg.runAs == "sessionwarden") {
+              sessionwarden = { };
+            };
+
+            # Let the unprivileged daemon lock and terminate sessions
+            security.polkit.enable = lib.mkIf (cfg.runAs != null) true;
+            security.polkit.extraConfig = lib.mkIf (cfg.runAs != null) ''
+              polkit.addRule(function(action, subject) {
+                if (subject.user == "${cfg.runAs}" &&
+                    (action.id == "org.freedesktop.login1.lock-sessions" ||
+                     action.id == "org.freedesktop.login1.manage")) {
+                  return polkit.Result.YES;
+                }
+              });
+            '';
+
             # SystemD user service (runs per-user for notifications)
             systemd.user.services.sessionwardend-user = {
               description = "SessionWarden User Notification Listener";
@@ -124,6 +202,7 @@
               order = config.security.pam.services.login.rules.account.unix.order - 10;
               control = "required";
               modulePath = "/lib/security/pam_sessionwarden.so";
+              args = cfg.pamArgs;
             };
 
             security.pam.services.login.rules.auth.sessionwarden = {
@@ -131,6 +210,7 @@
               order = config.security.pam.services.login.rules.auth.unix.order - 400;
               control = "required";
               modulePath = "/lib/security/pam_sessionwarden.so";
+              args = cfg.pamArgs;
             };
 
             # Configuration file
@@ -0,0 +1,272 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// dateLayout is the format of calendar dates in the config and of the keys
+// of the tagged days
+const dateLayout = "2006-01-02"
+
+// CalendarConfig tags days, e.g. as "holiday" or "vacation", so users can
+// have a different policy on them. Days are tagged inline or from the
+// events in .ics files.
+type CalendarConfig struct {
+	// Days maps a tag to dates ("2026-12-24") or inclusive date ranges
+	// ("2026-12-21..2027-01-04")
+	Days map[string][]string `toml:"days"`
+	// ICS files whose events tag every day they cover
+	ICS []ICSSource `toml:"ics"`
+
+	tags dayTags // built by Load
+}
+
+// ICSSource is an iCalendar file whose events all get the same tag
+type ICSSource struct {
+	Path string `toml:"path"`
+	Tag  string `toml:"tag"`
+}
+
+// DayPolicy changes a user's policy on days with a calendar tag
+type DayPolicy struct {
+	Weekend      bool      `toml:"weekend"`       // use the weekend schedule
+	DailyLimit   Duration  `toml:"daily_limit"`   // instead of the usual daily limit
+	AllowedHours TimeRange `toml:"allowed_hours"` // instead of the usual allowed hours
+}
+
+// dayTags maps a date (in dateLayout) to its tags
+type dayTags map[string][]string
+
+func (dt dayTags) add(day time.Time, tag string) {
+	key := day.Format(dateLayout)
+	for _, t := range dt[key] {
+		if t == tag {
+			return
+		}
+	}
+	dt[key] = append(dt[key], tag)
+}
+
+// on returns the tags of t's date, sorted
+func (dt dayTags) on(t time.Time) []string {
+	return dt[t.Format(dateLayout)]
+}
+
+// Load tags the days listed inline and in the .ics files
+func (c *CalendarConfig) Load() error {
+	c.tags = make(dayTags)
+
+	for tag, dates := range c.Days {
+		for _, entry := range dates {
+			first, last, err := parseDateRange(entry)
+			if err != nil {
+				return fmt.Errorf("invalid date %q in [calendar.days] %s: %w", entry, tag, err)
+			}
+			for day := first; !day.After(last); day = day.AddDate(0, 0, 1) {
+				c.tags.add(day, tag)
+			}
+		}
+	}
+
+	for _, src := range c.ICS {
+		if src.Tag == "" {
+			return fmt.Errorf("missing tag for calendar file %s", src.Path)
+		}
+		f, err := os.Open(src.Path)
+		if err != nil {
+			return fmt.Errorf("failed to open calendar file: %w", err)
+		}
+		events, err := ParseICS(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to parse calendar file %s: %w", src.Path, err)
+		}
+		for _, e := range events {
+			for day := e.First; !day.After(e.Last); day = day.AddDate(0, 0, 1) {
+				c.tags.add(day, src.Tag)
+			}
+		}
+	}
+
+	for _, tags := range c.tags {
+		sort.Strings(tags)
+	}
+	return nil
+}
+
+// HasTag reports whether any day can be given tag
+func (c *CalendarConfig) HasTag(tag string) bool {
+	if _, ok := c.Days[tag]; ok {
+		return true
+	}
+	for _, src := range c.ICS {
+		if src.Tag == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// parseDateRange parses "2006-01-02" or "2006-01-02..2006-01-05", returning
+// the first and last day (in local time)
+func parseDateRange(s string) (first, last time.Time, err error) {
+	from, to, isRange := strings.Cut(s, "..")
+	first, err = time.ParseInLocation(dateLayout, strings.TrimSpace(from), time.Local)
+	if err != nil {
+		return first, last, err
+	}
+	if !isRange {
+		return first, first, nil
+	}
+	last, err = time.ParseInLocation(dateLayout, strings.TrimSpace(to), time.Local)
+	if err != nil {
+		return first, last, err
+	}
+	if last.Before(first) {
+		return first, last, fmt.Errorf("range ends before it starts")
+	}
+	return first, last, nil
+}
+
+// ICSEvent is the span of days an iCalendar event covers. First and Last
+// are midnight local time, and both are included.
+type ICSEvent struct {
+	Summary string
+	First   time.Time
+	Last    time.Time
+}
+
+// ParseICS reads the VEVENTs from an iCalendar file. Only DTSTART, DTEND
+// and SUMMARY are used, so recurring events only cover their first
+// occurrence.
+func ParseICS(r io.Reader) ([]ICSEvent, error) {
+	lines, err := unfoldICS(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []ICSEvent
+	var inEvent bool
+	var summary, start, end string
+	for _, line := range lines {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		// Drop parameters such as ;VALUE=DATE or ;TZID=Europe/London
+		params := ""
+		if i := strings.IndexByte(name, ';'); i >= 0 {
+			name, params = name[:i], name[i+1:]
+		}
+
+		switch strings.ToUpper(name) {
+		case "BEGIN":
+			if strings.EqualFold(value, "VEVENT") {
+				inEvent = true
+				summary, start, end = "", "", ""
+			}
+		case "END":
+			if !strings.EqualFold(value, "VEVENT") || !inEvent {
+				continue
+			}
+			inEvent = false
+			e, err := icsEvent(summary, start, end)
+			if err != nil {
+				return nil, err
+			}
+			events = append(events, e)
+		case "SUMMARY":
+			summary = value
+		case "DTSTART":
+			start = icsValue(value, params)
+		case "DTEND":
+			end = icsValue(value, params)
+		}
+	}
+	return events, nil
+}
+
+// unfoldICS splits r into content lines, joining folded continuation lines
+func unfoldICS(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+// icsValue tags a date-time with its time zone parameter, if any, so
+// parseICSTime can interpret it
+func icsValue(value, params string) string {
+	for _, p := range strings.Split(params, ";") {
+		if tz, ok := strings.CutPrefix(p, "TZID="); ok {
+			return value + "@" + tz
+		}
+	}
+	return value
+}
+
+func icsEvent(summary, start, end string) (ICSEvent, error) {
+	first, allDay, err := parseICSTime(start)
+	if err != nil {
+		return ICSEvent{}, fmt.Errorf("event %q: invalid DTSTART: %w", summary, err)
+	}
+	e := ICSEvent{Summary: summary, First: midnight(first), Last: midnight(first)}
+	if end == "" {
+		return e, nil
+	}
+
+	last, _, err := parseICSTime(end)
+	if err != nil {
+		return ICSEvent{}, fmt.Errorf("event %q: invalid DTEND: %w", summary, err)
+	}
+	// DTEND is exclusive: an all-day event ending on the 5th covers the
+	// 4th, as does a timed event ending at midnight
+	if allDay || last.Equal(midnight(last)) {
+		last = last.AddDate(0, 0, -1)
+	}
+	if last = midnight(last); last.After(e.First) {
+		e.Last = last
+	}
+	return e, nil
+}
+
+// parseICSTime parses an iCalendar DATE or DATE-TIME (UTC with a Z suffix,
+// in a time zone given as value@zone by icsValue, or floating), returning
+// it in local time
+func parseICSTime(s string) (t time.Time, allDay bool, err error) {
+	value, zone, _ := strings.Cut(s, "@")
+	loc := time.Local
+	if zone != "" {
+		if loc, err = time.LoadLocation(zone); err != nil {
+			loc = time.Local
+		}
+	}
+
+	switch {
+	case len(value) == 8:
+		t, err = time.ParseInLocation("20060102", value, time.Local)
+		return t, true, err
+	case strings.HasSuffix(value, "Z"):
+		t, err = time.Parse("20060102T150405Z", value)
+	default:
+		t, err = time.ParseInLocation("20060102T150405", value, loc)
+	}
+	return t.Local(), false, err
+}
+
+func midnight(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testICS = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"SUMMARY:Autumn half\r\n" +
+	"  term\r\n" +
+	"DTSTART;VALUE=DATE:20261026\r\n" +
+	"DTEND;VALUE=DATE:20261031\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"SUMMARY:Inset day\r\n" +
+	"DTSTART;VALUE=DATE:20261106\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"SUMMARY:Sports day\r\n" +
+	"DTSTART:20261110T090000\r\n" +
+	"DTEND:20261110T150000\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func day(s string) time.Time {
+	t, err := time.ParseInLocation(dateLayout, s, time.Local)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestParseICS(t *testing.T) {
+	events, err := ParseICS(strings.NewReader(testICS))
+	assert.NoError(t, err)
+	assert.Len(t, events, 3)
+
+	// DTEND is exclusive for all-day events
+	assert.Equal(t, "Autumn half term", events[0].Summary)
+	assert.Equal(t, day("2026-10-26"), events[0].First)
+	assert.Equal(t, day("2026-10-30"), events[0].Last)
+
+	// Without DTEND, an event covers one day
+	assert.Equal(t, day("2026-11-06"), events[1].First)
+	assert.Equal(t, day("2026-11-06"), events[1].Last)
+
+	assert.Equal(t, day("2026-11-10"), events[2].First)
+	assert.Equal(t, day("2026-11-10"), events[2].Last)
+
+	_, err = ParseICS(strings.NewReader("BEGIN:VEVENT\nDTSTART:tomorrow\nEND:VEVENT\n"))
+	assert.Error(t, err)
+}
+
+func TestLoadConfig_Calendar(t *testing.T) {
+	icsPath := filepath.Join(t.TempDir(), "school.ics")
+	assert.NoError(t, os.WriteFile(icsPath, []byte(testICS), 0644))
+
+	cfg, err := LoadConfigFromBytes([]byte(`
+[calendar.days]
+holiday = ["2026-12-24", "2026-12-28..2026-12-31"]
+
+[[calendar.ics]]
+path = "` + icsPath + `"
+tag = "holiday"
+
+[default]
+allowed_hours = "09:00-17:00"
+weekend_hours = "10:00-20:00"
+
+[default.calendar.holiday]
+weekend = true
+
+[users.alice]
+daily_limit = "2h"
+
+[users.alice.calendar.holiday]
+daily_limit = "4h"
+`))
+	assert.NoError(t, err)
+
+	bob := cfg.Default
+	assert.True(t, bob.IsWeekend(day("2026-12-24")))
+	assert.True(t, bob.IsWeekend(day("2026-12-30")))
+	assert.True(t, bob.IsWeekend(day("2026-10-27"))) // from the .ics file
+	assert.False(t, bob.IsWeekend(day("2026-12-23")))
+
+	// Users' calendar policies replace the default's
+	alice := cfg.Users["alice"]
+	p, ok := alice.DayPolicyFor(day("2026-12-24"))
+	assert.True(t, ok)
+	assert.Equal(t, Duration(4*time.Hour), p.DailyLimit)
+	assert.False(t, alice.IsWeekend(day("2026-12-24")))
+	_, ok = alice.DayPolicyFor(day("2026-12-23"))
+	assert.False(t, ok)
+}
+
+func TestLoadConfig_InvalidCalendar(t *testing.T) {
+	for _, toml := range []string{
+		"[calendar.days]\nholiday = [\"24/12/2026\"]",
+		"[calendar.days]\nholiday = [\"2026-12-31..2026-12-24\"]",
+		"[[calendar.ics]]\npath = \"/nonexistent/school.ics\"\ntag = \"holiday\"",
+		"[users.alice.calendar.holiday]\nweekend = true",
+	} {
+		_, err := LoadConfigFromBytes([]byte(toml))
+		assert.Error(t, err, toml)
+	}
+}
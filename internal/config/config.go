@@ -60,15 +60,22 @@ func (tr *TimeRange) UnmarshalText(text []byte) error {
 	return nil
 }
 
+// String formats the range as "HH:MM-HH:MM", or "" if it is empty
+func (tr TimeRange) String() string {
+	if tr.IsEmpty() {
+		return ""
+	}
+	return fmt.Sprintf("%02d:%02d-%02d:%02d",
+		tr.Start.Hour(), tr.Start.Minute(),
+		tr.End.Hour(), tr.End.Minute())
+}
+
 // MarshalJSON serializes TimeRange as a string in "HH:MM-HH:MM" format
 func (tr TimeRange) MarshalJSON() ([]byte, error) {
 	if tr.IsEmpty() {
 		return []byte("null"), nil
 	}
-	s := fmt.Sprintf("\"%02d:%02d-%02d:%02d\"",
-		tr.Start.Hour(), tr.Start.Minute(),
-		tr.End.Hour(), tr.End.Minute())
-	return []byte(s), nil
+	return []byte(`"` + tr.String() + `"`), nil
 }
 
 // UnmarshalJSON deserializes TimeRange from a string in "HH:MM-HH:MM" format
@@ -95,19 +102,166 @@ func (d *Duration) UnmarshalText(text []byte) error {
 	return nil
 }
 
+// Session policy actions taken when a session is no longer permitted, and
+// app actions taken when an app's daily budget is used up. ActionKillApp is
+// reported when a blocked or over-budget app is killed.
+const (
+	ActionLock      = "lock"
+	ActionTerminate = "terminate"
+	ActionNotify    = "notify"
+	ActionKillApp   = "kill_app"
+)
+
+// SessionPolicy adjusts how sessions of one kind are treated. Policies are
+// keyed by PAM service (e.g. "sshd"), "remote" for any remote session, or
+// logind session type ("x11", "wayland", "tty").
+type SessionPolicy struct {
+	CountUsage   *bool     `toml:"count_usage"`   // count toward daily_limit (default true)
+	AllowedHours TimeRange `toml:"allowed_hours"` // further restrict when these sessions are allowed
+	Deny         bool      `toml:"deny"`          // never allow these sessions
+	Action       string    `toml:"action"`        // "lock" (default) or "terminate"
+}
+
+// CountsUsage reports whether sessions under this policy count toward the daily limit.
+func (sp SessionPolicy) CountsUsage() bool {
+	return sp.CountUsage == nil || *sp.CountUsage
+}
+
+// EnforceAction returns the action to take when a session is not permitted.
+func (sp SessionPolicy) EnforceAction() string {
+	if sp.Action == "" {
+		return ActionLock
+	}
+	return sp.Action
+}
+
+// BankConfig lets a user save unused daily allowance in a time bank
+type BankConfig struct {
+	Max       Duration `toml:"max"`        // most that can be saved; the bank is off if 0
+	Expiry    Duration `toml:"expiry"`     // how long saved time lasts (forever if 0)
+	AutoSpend bool     `toml:"auto_spend"` // draw on the bank when the daily limit is reached
+}
+
+// Enabled reports whether the user has a time bank
+func (bc BankConfig) Enabled() bool {
+	return bc.Max > 0
+}
+
+// AppRule blocks an application, always or only during a time window
+type AppRule struct {
+	Match string    `toml:"match"` // executable path if it contains "/", otherwise a process or executable name
+	Hours TimeRange `toml:"hours"` // when the app is blocked (always, if unset)
+}
+
+// BlocksAt reports whether the rule blocks its app at t
+func (r AppRule) BlocksAt(t time.Time) bool {
+	return r.Hours.IsEmpty() || r.Hours.WithinRange(t)
+}
+
+// WindDownConfig sends a countdown notification that repeats, replacing
+// itself, in the last stretch before the allowed hours window ends
+type WindDownConfig struct {
+	Start    Duration `toml:"start"`    // how long before the window ends to begin; off if 0
+	Every    Duration `toml:"every"`    // how often to repeat it (default 5m)
+	Critical Duration `toml:"critical"` // when to escalate to critical urgency and repeat every minute (default 5m)
+}
+
+// Enabled reports whether the user gets wind-down notifications
+func (wd WindDownConfig) Enabled() bool {
+	return wd.Start > 0
+}
+
+// Interval returns how often the notification repeats before it is critical
+func (wd WindDownConfig) Interval() time.Duration {
+	if wd.Every <= 0 {
+		return 5 * time.Minute
+	}
+	return time.Duration(wd.Every)
+}
+
+// CriticalAt returns how long before the window ends the notification
+// becomes critical
+func (wd WindDownConfig) CriticalAt() time.Duration {
+	if wd.Critical <= 0 {
+		return 5 * time.Minute
+	}
+	return time.Duration(wd.Critical)
+}
+
 type UserConfig struct {
-	DailyLimit   Duration   `toml:"daily_limit"`
-	AllowedHours TimeRange  `toml:"allowed_hours"`
-	WeekendHours TimeRange  `toml:"weekend_hours"`
-	WeekendDays  []string   `toml:"weekend_days"`
-	NotifyBefore []Duration `toml:"notify_before"`
-	LockScreen   *bool      `toml:"lock_screen"`
-	Enabled      *bool      `toml:"enabled"`
+	DailyLimit      Duration                 `toml:"daily_limit"`
+	AllowedHours    TimeRange                `toml:"allowed_hours"`
+	WeekendHours    TimeRange                `toml:"weekend_hours"`
+	WeekendDays     []string                 `toml:"weekend_days"`
+	NotifyBefore    []Duration               `toml:"notify_before"`
+	LockScreen      *bool                    `toml:"lock_screen"`
+	Enabled         *bool                    `toml:"enabled"`
+	SessionPolicies map[string]SessionPolicy `toml:"sessions"`
+	DayPolicies     map[string]DayPolicy     `toml:"calendar"` // keyed by calendar tag
+	Bank            BankConfig               `toml:"bank"`
+	WindDown        WindDownConfig           `toml:"wind_down"`
+	// Apps maps an application to its daily budget. Processes match by
+	// name or by the base name of their executable, ignoring case.
+	Apps      map[string]Duration `toml:"apps"`
+	AppAction string              `toml:"app_action"` // "notify" (default) or "terminate" when an app's budget is used up
+	// BlockedApps are killed whenever they run during their hours
+	BlockedApps []AppRule `toml:"blocked_apps"`
+	// MaxContinuous is how long a user may be active without a break of
+	// at least BreakLength (0 means no limit)
+	MaxContinuous Duration `toml:"max_continuous"`
+	BreakLength   Duration `toml:"break_length"`
+
+	tags dayTags // the calendar's tagged days, set by SetDefault
 }
 
-// IsWeekend reports whether t falls on one of the configured weekend days.
-// If weekend_days is not set, Saturday and Sunday are used.
+// DayPolicyFor returns the policy for t's date, if it has a calendar tag
+// the user has a policy for. If several do, the first tag alphabetically
+// wins.
+func (uc *UserConfig) DayPolicyFor(t time.Time) (DayPolicy, bool) {
+	for _, tag := range uc.tags.on(t) {
+		if p, ok := uc.DayPolicies[tag]; ok {
+			return p, true
+		}
+	}
+	return DayPolicy{}, false
+}
+
+// SessionPolicyFor returns the policy matching a session, checking the PAM
+// service first, then "remote", then the logind session type.
+func (uc *UserConfig) SessionPolicyFor(sessionType string, remote bool, service string) (SessionPolicy, bool) {
+	if service != "" {
+		if p, ok := uc.SessionPolicies[service]; ok {
+			return p, true
+		}
+	}
+	if remote {
+		if p, ok := uc.SessionPolicies["remote"]; ok {
+			return p, true
+		}
+	}
+	if sessionType != "" {
+		if p, ok := uc.SessionPolicies[sessionType]; ok {
+			return p, true
+		}
+	}
+	return SessionPolicy{}, false
+}
+
+// AppEnforceAction returns the action to take when an app's budget is used up
+func (uc *UserConfig) AppEnforceAction() string {
+	if uc.AppAction == "" {
+		return ActionNotify
+	}
+	return uc.AppAction
+}
+
+// IsWeekend reports whether t falls on one of the configured weekend days,
+// or on a day whose calendar policy says to use the weekend schedule. If
+// weekend_days is not set, Saturday and Sunday are used.
 func (uc *UserConfig) IsWeekend(t time.Time) bool {
+	if p, ok := uc.DayPolicyFor(t); ok && p.Weekend {
+		return true
+	}
 	if len(uc.WeekendDays) == 0 {
 		return t.Weekday() == time.Saturday || t.Weekday() == time.Sunday
 	}
@@ -134,10 +288,83 @@ func (c *Config) Validate() error {
 	if err := validateWeekendDays("default", c.Default.WeekendDays); err != nil {
 		return err
 	}
+	if err := validateSessionPolicies("default", c.Default.SessionPolicies); err != nil {
+		return err
+	}
+	if err := c.validateDayPolicies("default", c.Default.DayPolicies); err != nil {
+		return err
+	}
+	if err := validateBreaks("default", c.Default); err != nil {
+		return err
+	}
+	if err := validateApps("default", c.Default); err != nil {
+		return err
+	}
 	for username, userConfig := range c.Users {
 		if err := validateWeekendDays("users."+username, userConfig.WeekendDays); err != nil {
 			return err
 		}
+		if err := validateSessionPolicies("users."+username, userConfig.SessionPolicies); err != nil {
+			return err
+		}
+		if err := c.validateDayPolicies("users."+username, userConfig.DayPolicies); err != nil {
+			return err
+		}
+		if err := validateBreaks("users."+username, userConfig); err != nil {
+			return err
+		}
+		if err := validateApps("users."+username, userConfig); err != nil {
+			return err
+		}
+	}
+	if c.Alerts.DeniedLoginThreshold < 0 {
+		return fmt.Errorf("invalid denied_login_threshold %d in [alerts]: must not be negative", c.Alerts.DeniedLoginThreshold)
+	}
+	return nil
+}
+
+func validateSessionPolicies(section string, policies map[string]SessionPolicy) error {
+	for kind, policy := range policies {
+		switch policy.Action {
+		case "", ActionLock, ActionTerminate:
+		default:
+			return fmt.Errorf("invalid action %q in [%s.sessions.%s]: expected \"lock\" or \"terminate\"", policy.Action, section, kind)
+		}
+	}
+	return nil
+}
+
+func (c *Config) validateDayPolicies(section string, policies map[string]DayPolicy) error {
+	for tag := range policies {
+		if !c.Calendar.HasTag(tag) {
+			return fmt.Errorf("unknown calendar tag %q in [%s.calendar]: tag days in [calendar.days] or [[calendar.ics]]", tag, section)
+		}
+	}
+	return nil
+}
+
+func validateApps(section string, uc UserConfig) error {
+	switch uc.AppAction {
+	case "", ActionNotify, ActionTerminate:
+	default:
+		return fmt.Errorf("invalid app_action %q in [%s]: expected \"notify\" or \"terminate\"", uc.AppAction, section)
+	}
+	for app, budget := range uc.Apps {
+		if budget <= 0 {
+			return fmt.Errorf("invalid budget for %q in [%s.apps]: must be positive", app, section)
+		}
+	}
+	for i, rule := range uc.BlockedApps {
+		if rule.Match == "" {
+			return fmt.Errorf("missing match in blocked_apps entry %d of [%s]", i+1, section)
+		}
+	}
+	return nil
+}
+
+func validateBreaks(section string, uc UserConfig) error {
+	if uc.MaxContinuous > 0 && uc.BreakLength <= 0 {
+		return fmt.Errorf("missing break_length in [%s]: required with max_continuous", section)
 	}
 	return nil
 }
@@ -151,9 +378,28 @@ func validateWeekendDays(section string, days []string) error {
 	return nil
 }
 
+// PamConfig holds settings the PAM module fetches from the daemon
+type PamConfig struct {
+	// ExemptGroups are groups whose members are never restricted
+	// (defaults to wheel and sudo)
+	ExemptGroups []string `toml:"exempt_groups"`
+}
+
+// AlertsConfig controls notifications sent to administrators
+type AlertsConfig struct {
+	// Admins are the users notified about denied logins
+	Admins []string `toml:"admins"`
+	// DeniedLoginThreshold notifies admins each time a user reaches this
+	// many denied logins in a day (0 disables)
+	DeniedLoginThreshold int `toml:"denied_login_threshold"`
+}
+
 type Config struct {
-	Default UserConfig            `toml:"default"`
-	Users   map[string]UserConfig `toml:"users"`
+	Default  UserConfig            `toml:"default"`
+	Users    map[string]UserConfig `toml:"users"`
+	Pam      PamConfig             `toml:"pam"`
+	Alerts   AlertsConfig          `toml:"alerts"`
+	Calendar CalendarConfig        `toml:"calendar"`
 }
 
 // SetDefault sets default configuration values for each user based on the Default config.
@@ -166,6 +412,10 @@ func (c *Config) SetDefault() {
 		defaultVal := false
 		c.Default.LockScreen = &defaultVal
 	}
+	if c.Pam.ExemptGroups == nil {
+		c.Pam.ExemptGroups = []string{"wheel", "sudo"}
+	}
+	c.Default.tags = c.Calendar.tags
 
 	if c.Users != nil {
 		for username, userConfig := range c.Users {
@@ -190,13 +440,39 @@ func (c *Config) SetDefault() {
 			if userConfig.Enabled == nil {
 				userConfig.Enabled = c.Default.Enabled
 			}
+			if userConfig.SessionPolicies == nil {
+				userConfig.SessionPolicies = c.Default.SessionPolicies
+			}
+			if userConfig.DayPolicies == nil {
+				userConfig.DayPolicies = c.Default.DayPolicies
+			}
+			if userConfig.Bank == (BankConfig{}) {
+				userConfig.Bank = c.Default.Bank
+			}
+			if userConfig.Apps == nil {
+				userConfig.Apps = c.Default.Apps
+			}
+			if userConfig.AppAction == "" {
+				userConfig.AppAction = c.Default.AppAction
+			}
+			if userConfig.BlockedApps == nil {
+				userConfig.BlockedApps = c.Default.BlockedApps
+			}
+			if userConfig.WindDown == (WindDownConfig{}) {
+				userConfig.WindDown = c.Default.WindDown
+			}
+			if userConfig.MaxContinuous == 0 {
+				userConfig.MaxContinuous = c.Default.MaxContinuous
+				userConfig.BreakLength = c.Default.BreakLength
+			}
+			userConfig.tags = c.Calendar.tags
 			c.Users[username] = userConfig
 		}
 	}
 }
 
 func LoadConfigFromFile(path string) (*Config, error) {
-	file, err := os.OpenFile(path, os.O_RDONLY|os.O_CREATE, 0644)
+	file, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
@@ -207,6 +483,9 @@ func LoadConfigFromFile(path string) (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := config.Calendar.Load(); err != nil {
+		return nil, err
+	}
 	config.SetDefault()
 	if err := config.Validate(); err != nil {
 		return nil, err
@@ -220,6 +499,9 @@ func LoadConfigFromBytes(data []byte) (Config, error) {
 	if err != nil {
 		return config, err
 	}
+	if err := config.Calendar.Load(); err != nil {
+		return config, err
+	}
 
 	config.SetDefault()
 	if err := config.Validate(); err != nil {
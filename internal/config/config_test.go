@@ -290,3 +290,206 @@ weekend_days = ["sat"]
 	_, err = LoadConfigFromBytes([]byte(tomlData))
 	assert.Error(t, err)
 }
+
+func TestLoadConfig_SessionPolicies(t *testing.T) {
+	tomlData := `
+[default.sessions.tty]
+action = "terminate"
+
+[users.user1]
+daily_limit = "2h"
+[users.user1.sessions.sshd]
+count_usage = false
+[users.user1.sessions.remote]
+allowed_hours = "16:00-20:00"
+[users.user2]
+daily_limit = "1h"
+`
+	cfg, err := LoadConfigFromBytes([]byte(tomlData))
+	assert.NoError(t, err)
+
+	uc := cfg.Users["user1"]
+	// service takes precedence over remote
+	p, ok := uc.SessionPolicyFor("tty", true, "sshd")
+	assert.True(t, ok)
+	assert.False(t, p.CountsUsage())
+	assert.Equal(t, ActionLock, p.EnforceAction())
+
+	p, ok = uc.SessionPolicyFor("tty", true, "telnet")
+	assert.True(t, ok)
+	assert.True(t, p.CountsUsage())
+	assert.False(t, p.AllowedHours.IsEmpty())
+
+	_, ok = uc.SessionPolicyFor("wayland", false, "gdm-password")
+	assert.False(t, ok)
+
+	// user2 inherits the default session policies
+	uc = cfg.Users["user2"]
+	p, ok = uc.SessionPolicyFor("tty", false, "login")
+	assert.True(t, ok)
+	assert.Equal(t, ActionTerminate, p.EnforceAction())
+}
+
+func TestLoadConfig_InvalidSessionAction(t *testing.T) {
+	tomlData := `
+[users.user1.sessions.tty]
+action = "logout"
+`
+	_, err := LoadConfigFromBytes([]byte(tomlData))
+	assert.Error(t, err)
+}
+
+func TestLoadConfig_Breaks(t *testing.T) {
+	tomlData := `
+[default]
+max_continuous = "45m"
+break_length = "10m"
+
+[users.user1]
+daily_limit = "2h"
+
+[users.user2]
+max_continuous = "1h"
+break_length = "15m"
+`
+	cfg, err := LoadConfigFromBytes([]byte(tomlData))
+	assert.NoError(t, err)
+	assert.Equal(t, Duration(45*time.Minute), cfg.Users["user1"].MaxContinuous)
+	assert.Equal(t, Duration(10*time.Minute), cfg.Users["user1"].BreakLength)
+	assert.Equal(t, Duration(15*time.Minute), cfg.Users["user2"].BreakLength)
+
+	_, err = LoadConfigFromBytes([]byte("[users.user1]\nmax_continuous = \"45m\""))
+	assert.Error(t, err)
+}
+
+func TestLoadConfig_WindDown(t *testing.T) {
+	tomlData := `
+[default.wind_down]
+start = "30m"
+
+[users.user1]
+daily_limit = "2h"
+
+[users.user2.wind_down]
+start = "1h"
+every = "15m"
+critical = "10m"
+`
+	cfg, err := LoadConfigFromBytes([]byte(tomlData))
+	assert.NoError(t, err)
+
+	wd := cfg.Users["user1"].WindDown
+	assert.True(t, wd.Enabled())
+	assert.Equal(t, 5*time.Minute, wd.Interval())
+	assert.Equal(t, 5*time.Minute, wd.CriticalAt())
+
+	wd = cfg.Users["user2"].WindDown
+	assert.Equal(t, Duration(time.Hour), wd.Start)
+	assert.Equal(t, 15*time.Minute, wd.Interval())
+	assert.Equal(t, 10*time.Minute, wd.CriticalAt())
+}
+
+func TestLoadConfig_Apps(t *testing.T) {
+	tomlData := `
+[default]
+app_action = "terminate"
+
+[users.user1.apps]
+minecraft = "1h"
+discord = "30m"
+
+[users.user2]
+daily_limit = "2h"
+`
+	cfg, err := LoadConfigFromBytes([]byte(tomlData))
+	assert.NoError(t, err)
+
+	uc := cfg.Users["user1"]
+	assert.Equal(t, Duration(time.Hour), uc.Apps["minecraft"])
+	assert.Equal(t, ActionTerminate, uc.AppEnforceAction())
+	uc = cfg.Users["user2"]
+	assert.Empty(t, uc.Apps)
+
+	var defaults UserConfig
+	assert.Equal(t, ActionNotify, defaults.AppEnforceAction())
+
+	cfg, err = LoadConfigFromBytes([]byte(`
+[[default.blocked_apps]]
+match = "/usr/bin/steam"
+
+[[default.blocked_apps]]
+match = "discord"
+hours = "00:00-16:00"
+`))
+	assert.NoError(t, err)
+	rules := cfg.Default.BlockedApps
+	if assert.Len(t, rules, 2) {
+		morning := time.Date(2024, 6, 3, 9, 0, 0, 0, time.UTC)
+		evening := time.Date(2024, 6, 3, 18, 0, 0, 0, time.UTC)
+		assert.True(t, rules[0].BlocksAt(evening))
+		assert.True(t, rules[1].BlocksAt(morning))
+		assert.False(t, rules[1].BlocksAt(evening))
+	}
+
+	for _, toml := range []string{
+		"[users.user1]\napp_action = \"kill\"",
+		"[users.user1.apps]\nminecraft = \"0s\"",
+		"[[users.user1.blocked_apps]]\nhours = \"00:00-16:00\"",
+	} {
+		_, err := LoadConfigFromBytes([]byte(toml))
+		assert.Error(t, err, toml)
+	}
+}
+
+func TestLoadConfig_PamExemptGroups(t *testing.T) {
+	cfg, err := LoadConfigFromBytes([]byte(`
+[default]
+enabled = true
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"wheel", "sudo"}, cfg.Pam.ExemptGroups)
+
+	cfg, err = LoadConfigFromBytes([]byte(`
+[pam]
+exempt_groups = ["parents"]
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"parents"}, cfg.Pam.ExemptGroups)
+
+	// An explicit empty list exempts nobody but root
+	cfg, err = LoadConfigFromBytes([]byte(`
+[pam]
+exempt_groups = []
+`))
+	assert.NoError(t, err)
+	assert.Empty(t, cfg.Pam.ExemptGroups)
+	assert.NotNil(t, cfg.Pam.ExemptGroups)
+}
+
+func TestLoadConfig_Alerts(t *testing.T) {
+	cfg, err := LoadConfigFromBytes([]byte(`
+[alerts]
+admins = ["mom", "dad"]
+denied_login_threshold = 3
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"mom", "dad"}, cfg.Alerts.Admins)
+	assert.Equal(t, 3, cfg.Alerts.DeniedLoginThreshold)
+
+	_, err = LoadConfigFromBytes([]byte(`
+[alerts]
+denied_login_threshold = -1
+`))
+	assert.Error(t, err)
+}
+
+func TestLoadConfigFromFile_Missing(t *testing.T) {
+	path := t.TempDir() + "/missing.toml"
+
+	_, err := LoadConfigFromFile(path)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	// The file must not be created as a side effect
+	_, err = os.Stat(path)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
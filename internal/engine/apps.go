@@ -0,0 +1,246 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os/user"
+	"slices"
+	"sort"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/SoarinFerret/SessionWarden/internal/config"
+	"github.com/SoarinFerret/SessionWarden/internal/eval"
+	"github.com/SoarinFerret/SessionWarden/internal/session"
+)
+
+// appUsageGap is the longest time between two checks that is counted toward
+// an app. It allows for a late tick; longer gaps mean the daemon wasn't
+// running and count nothing.
+const appUsageGap = 2 * time.Minute
+
+// appKillGrace is how long a killed app has to exit after SIGTERM before it
+// is sent SIGKILL (replaced in tests)
+var appKillGrace = 5 * time.Second
+
+// Reasons recorded in the history when an app is killed
+const (
+	appKillBlocked = "blocked"
+	appKillBudget  = "budget_used"
+)
+
+// checkApps kills the user's blocked apps and, if countUsage is set (the
+// user is at their session), enforces their app budgets
+func (e *Engine) checkApps(username string, userConfig config.UserConfig, countUsage bool, now time.Time) {
+	procs, err := lookupUserProcesses(username)
+	if err != nil {
+		slog.Error("Failed to list user processes", "user", username, "error", err)
+		return
+	}
+
+	e.checkBlockedApps(username, userConfig, procs, now)
+	if countUsage && len(userConfig.Apps) > 0 {
+		e.checkAppBudgets(username, userConfig, procs, now)
+	}
+}
+
+// checkBlockedApps kills the processes of each app blocked at now
+func (e *Engine) checkBlockedApps(username string, userConfig config.UserConfig, procs []process, now time.Time) {
+	for _, rule := range userConfig.BlockedApps {
+		if !rule.BlocksAt(now) {
+			continue
+		}
+		var matched []process
+		for _, p := range procs {
+			if p.matchesApp(rule.Match) {
+				matched = append(matched, p)
+			}
+		}
+		if len(matched) == 0 {
+			continue
+		}
+
+		message := fmt.Sprintf("%s is not allowed on your account", rule.Match)
+		if !rule.Hours.IsEmpty() {
+			message = fmt.Sprintf("%s is not allowed until %s", rule.Match, rule.Hours.End.Format("15:04"))
+		}
+		if err := e.enforceApp(username, rule.Match, appKillBlocked, matched, message); err != nil {
+			slog.Error("Failed to enforce app policy", "user", username, "app", rule.Match, "error", err)
+		}
+	}
+}
+
+// checkAppBudgets counts the time since the last check toward each of the
+// user's budgeted apps that is running, and warns about or kills apps whose
+// budget is used up
+func (e *Engine) checkAppBudgets(username string, userConfig config.UserConfig, procs []process, now time.Time) {
+	running := runningApps(procs, userConfig.Apps)
+
+	names := make([]string, 0, len(running))
+	for app := range running {
+		names = append(names, app)
+	}
+	sort.Strings(names)
+
+	err := e.stateMgr.UpdateUser(username, false, func(u *session.User) error {
+		if u.Apps == nil {
+			u.Apps = &session.AppUsage{}
+		}
+		u.Apps.Record(now, names, appUsageGap)
+		return nil
+	})
+	if err != nil {
+		slog.Error("Failed to record app usage", "user", username, "error", err)
+		return
+	}
+
+	remaining := eval.GetAppRemaining(username, e.stateMgr.Snapshot(), *e.config, now)
+	for _, app := range names {
+		left := remaining[app]
+		if left > 0 {
+			if eval.CheckSendNotification(left, userConfig.NotifyBefore) {
+				message := fmt.Sprintf("You have %s left in %s today", FormatTimeRemaining(time.Duration(left)*time.Second), app)
+				e.sendAppNotification(username, app, message)
+			}
+			continue
+		}
+
+		if userConfig.AppEnforceAction() == config.ActionTerminate {
+			message := fmt.Sprintf("%s was closed: your time in it is used up for today", app)
+			if err := e.enforceApp(username, app, appKillBudget, running[app], message); err != nil {
+				slog.Error("Failed to enforce app policy", "user", username, "app", app, "error", err)
+			}
+		} else if eval.CheckSendNotification(left, []config.Duration{0}) {
+			// Only notify once, as the budget runs out
+			e.sendAppNotification(username, app, fmt.Sprintf("Your time in %s is used up for today", app))
+		}
+	}
+}
+
+// enforceApp kills the processes of app, records each kill in the user's
+// history and tells the user why. Processes get appKillGrace to exit after
+// SIGTERM and are then sent SIGKILL; only those that have exited are
+// recorded, so one that can't be killed isn't reported every minute.
+func (e *Engine) enforceApp(username, app, reason string, procs []process, message string) error {
+	var signalled []process
+	var errs []error
+	for _, p := range procs {
+		if err := signalProcess(p, syscall.SIGTERM); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		signalled = append(signalled, p)
+	}
+	if len(signalled) == 0 {
+		return errors.Join(errs...)
+	}
+
+	survivors := waitForExit(signalled, appKillGrace)
+	for _, p := range survivors {
+		if err := signalProcess(p, syscall.SIGKILL); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(survivors) > 0 {
+		survivors = waitForExit(survivors, time.Second)
+	}
+
+	var killed []process
+	for _, p := range signalled {
+		if slices.Contains(survivors, p) {
+			errs = append(errs, fmt.Errorf("process %s did not exit after SIGKILL", p))
+			continue
+		}
+		killed = append(killed, p)
+	}
+	if len(killed) == 0 {
+		return errors.Join(errs...)
+	}
+
+	err := e.stateMgr.UpdateUser(username, false, func(u *session.User) error {
+		for _, p := range killed {
+			u.AddHistory(session.HistoryEntry{
+				Kind:   session.HistoryAppKilled,
+				Reason: reason,
+				App:    app,
+				Detail: p.String(),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		errs = append(errs, fmt.Errorf("failed to record app kill: %w", err))
+	}
+
+	slog.Info("Killed app", "user", username, "app", app, "reason", reason, "processes", len(killed), "decision", config.ActionKillApp)
+	if e.enforceHook != nil {
+		e.enforceHook(username, config.ActionKillApp)
+	}
+	e.sendAppNotification(username, app, message)
+	return errors.Join(errs...)
+}
+
+func (e *Engine) sendAppNotification(username, app, message string) {
+	if e.notificationEmit == nil {
+		slog.Error("Failed to send app notification", "user", username, "app", app, "error", "notification emitter not set")
+		return
+	}
+	if err := e.notificationEmit.EmitNotificationSignal(username, "App Time Limit", message, urgencyNormal, ""); err != nil {
+		slog.Error("Failed to send app notification", "user", username, "app", app, "error", err)
+	}
+}
+
+// lookupUserProcesses lists the processes of the user called username
+func lookupUserProcesses(username string) ([]process, error) {
+	u, err := user.Lookup(username)
+	if err != nil {
+		return nil, err
+	}
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return nil, fmt.Errorf("invalid uid %q for %s", u.Uid, username)
+	}
+	return userProcesses(uid)
+}
+
+// runningApps returns the processes of each app in apps that is running
+func runningApps(procs []process, apps map[string]config.Duration) map[string][]process {
+	running := make(map[string][]process)
+	for app := range apps {
+		for _, p := range procs {
+			if p.matchesApp(app) {
+				running[app] = append(running[app], p)
+			}
+		}
+	}
+	return running
+}
+
+// signalProcess sends sig to p
+func signalProcess(p process, sig syscall.Signal) error {
+	if err := syscall.Kill(p.PID, sig); err != nil {
+		return fmt.Errorf("failed to signal process %s: %w", p, err)
+	}
+	return nil
+}
+
+// waitForExit waits up to timeout for procs to exit, and returns those that
+// are still running
+func waitForExit(procs []process, timeout time.Duration) []process {
+	deadline := time.Now().Add(timeout)
+	for {
+		var running []process
+		for _, p := range procs {
+			if !processExited(p) {
+				running = append(running, p)
+			}
+		}
+		if len(running) == 0 || !time.Now().Before(deadline) {
+			return running
+		}
+		procs = running
+		time.Sleep(100 * time.Millisecond)
+	}
+}
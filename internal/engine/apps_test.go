@@ -0,0 +1,101 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SoarinFerret/SessionWarden/internal/config"
+	"github.com/SoarinFerret/SessionWarden/internal/session"
+	"github.com/SoarinFerret/SessionWarden/internal/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcess_MatchesApp(t *testing.T) {
+	p := process{PID: 1, Name: "Discord", Exe: "/opt/discord/Discord"}
+	assert.True(t, p.matchesApp("discord"))
+	assert.True(t, p.matchesApp("/opt/discord/Discord"))
+	assert.True(t, p.matchesApp("/opt/discord/../discord/Discord"))
+	assert.False(t, p.matchesApp("/usr/bin/discord"))
+	assert.False(t, process{PID: 2, Name: "discord"}.matchesApp("/usr/bin/discord"))
+}
+
+func TestEngine_EnforceApp(t *testing.T) {
+	mgr, err := state.NewManager(filepath.Join(t.TempDir(), "state.json"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	mgr.HandleLogin("alice", "sess1")
+	var actions []string
+	e := &Engine{stateMgr: mgr, config: &config.Config{}}
+	e.SetEnforceHook(func(username, action string) { actions = append(actions, action) })
+
+	cmd := exec.Command("sleep", "60")
+	if !assert.NoError(t, cmd.Start()) {
+		return
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	p := process{PID: cmd.Process.Pid, Name: "sleep", Exe: cmd.Path}
+	err = e.enforceApp("alice", "sleep", appKillBlocked, []process{p}, "sleep is not allowed")
+	assert.NoError(t, err)
+	assert.Error(t, <-done, "the process should have been killed")
+	assert.Equal(t, []string{config.ActionKillApp}, actions)
+
+	st := mgr.Snapshot()
+	u, err := st.GetUser("alice")
+	if !assert.NoError(t, err) {
+		return
+	}
+	kills := u.GetHistory(session.HistoryAppKilled, time.Time{})
+	if assert.Len(t, kills, 1) {
+		assert.Equal(t, "sleep", kills[0].App)
+		assert.Equal(t, appKillBlocked, kills[0].Reason)
+		assert.Equal(t, p.String(), kills[0].Detail)
+	}
+}
+
+func TestEngine_EnforceApp_EscalatesToSIGKILL(t *testing.T) {
+	mgr, err := state.NewManager(filepath.Join(t.TempDir(), "state.json"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	mgr.HandleLogin("alice", "sess1")
+	e := &Engine{stateMgr: mgr, config: &config.Config{}}
+
+	old := appKillGrace
+	appKillGrace = 200 * time.Millisecond
+	defer func() { appKillGrace = old }()
+
+	// Ignored signals stay ignored across exec, so this sleep ignores SIGTERM
+	cmd := exec.Command("sh", "-c", `trap "" TERM; exec sleep 60`)
+	if !assert.NoError(t, cmd.Start()) {
+		return
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	p := process{PID: cmd.Process.Pid, Name: "sleep"}
+	assert.Eventually(t, func() bool {
+		comm, _ := os.ReadFile(fmt.Sprintf("/proc/%d/comm", p.PID))
+		return strings.TrimSpace(string(comm)) == "sleep"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	err = e.enforceApp("alice", "sleep", appKillBlocked, []process{p}, "sleep is not allowed")
+	assert.NoError(t, err)
+	select {
+	case err := <-done:
+		assert.ErrorContains(t, err, "killed")
+	case <-time.After(5 * time.Second):
+		cmd.Process.Kill()
+		t.Fatal("the process ignoring SIGTERM was not killed")
+	}
+
+	st := mgr.Snapshot()
+	u, _ := st.GetUser("alice")
+	assert.Len(t, u.GetHistory(session.HistoryAppKilled, time.Time{}), 1)
+}
@@ -2,27 +2,50 @@ package engine
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"time"
 
 	"github.com/SoarinFerret/SessionWarden/internal/config"
 	"github.com/SoarinFerret/SessionWarden/internal/eval"
+	"github.com/SoarinFerret/SessionWarden/internal/session"
 	"github.com/SoarinFerret/SessionWarden/internal/state"
 	"github.com/godbus/dbus/v5"
 )
 
-// NotificationEmitter is an interface for sending notifications
+// NotificationEmitter is an interface for sending notifications. Urgency is
+// as in the desktop notifications spec, and notifications with the same
+// non-empty tag replace each other instead of stacking.
 type NotificationEmitter interface {
-	EmitNotificationSignal(username, title, message string) error
+	EmitNotificationSignal(username, title, message string, urgency byte, tag string) error
 }
 
+// Notification urgencies, as in the desktop notifications spec
+const (
+	urgencyNormal   byte = 1
+	urgencyCritical byte = 2
+)
+
+// windDownTag is the tag of the wind-down notification, so each update
+// replaces the last one
+const windDownTag = "wind-down"
+
+// historyPruneInterval is how often old history entries are removed
+const historyPruneInterval = 24 * time.Hour
+
 // Engine monitors active sessions and enforces time limits
 type Engine struct {
 	stateMgr         *state.Manager
 	config           *config.Config
 	conn             *dbus.Conn
 	notificationEmit NotificationEmitter
+	heartbeatHook    func(checkDuration time.Duration)
+	enforceHook      func(username, action string)
+	lastPrune        time.Time
+
+	// login1 returns the logind object at path (replaced in tests)
+	login1 func(path dbus.ObjectPath) dbus.BusObject
 }
 
 // NewEngine creates a new user engine instance
@@ -44,6 +67,19 @@ func (e *Engine) SetNotificationEmitter(emitter NotificationEmitter) {
 	e.notificationEmit = emitter
 }
 
+// SetHeartbeatHook sets a function called after every completed session
+// check with how long the check took, e.g. to ping the systemd watchdog
+func (e *Engine) SetHeartbeatHook(hook func(checkDuration time.Duration)) {
+	e.heartbeatHook = hook
+}
+
+// SetEnforceHook sets a function called after a session has been locked or
+// terminated, or an app killed, with the action taken (config.ActionLock,
+// ActionTerminate or ActionKillApp)
+func (e *Engine) SetEnforceHook(hook func(username, action string)) {
+	e.enforceHook = hook
+}
+
 // Run starts the periodic checker (runs every minute)
 func (e *Engine) Run(ctx context.Context) error {
 	defer e.conn.Close()
@@ -51,7 +87,7 @@ func (e *Engine) Run(ctx context.Context) error {
 	ticker := time.NewTicker(1 * time.Minute)
 	defer ticker.Stop()
 
-	log.Println("User engine started - monitoring active sessions...")
+	slog.Info("User engine started - monitoring active sessions")
 
 	// Run immediately on start
 	e.checkSessions()
@@ -59,7 +95,7 @@ func (e *Engine) Run(ctx context.Context) error {
 	for {
 		select {
 		case <-ctx.Done():
-			log.Println("User engine shutting down...")
+			slog.Info("User engine shutting down")
 			return nil
 		case <-ticker.C:
 			e.checkSessions()
@@ -70,9 +106,16 @@ func (e *Engine) Run(ctx context.Context) error {
 // checkSessions evaluates all active sessions
 func (e *Engine) checkSessions() {
 	now := time.Now()
-	currentState := e.stateMgr.GetState()
+	currentState := e.stateMgr.Snapshot()
+
+	slog.Debug("Checking sessions", "time", now.Format(time.RFC3339))
 
-	log.Printf("DEBUG: Checking sessions at %s", now.Format(time.RFC3339))
+	if now.Sub(e.lastPrune) >= historyPruneInterval {
+		if err := e.stateMgr.PruneHistory(now); err != nil {
+			slog.Error("Failed to prune history", "error", err)
+		}
+		e.lastPrune = now
+	}
 
 	for username, user := range currentState.Users {
 		// Skip if user is paused or has no active sessions
@@ -91,36 +134,111 @@ func (e *Engine) checkSessions() {
 			continue
 		}
 
+		if userConfig.Bank.Enabled() {
+			e.updateBank(username, currentState, userConfig, now)
+		}
+		e.updateLedgerUse(username, currentState, now)
+
 		// Check if user has active sessions
 		activeSession := user.GetActiveSession()
 		if activeSession == nil {
 			continue
 		}
 
-		// check if eval.PermitLogin would block login now
-		if !eval.PermitLogin(username, *currentState, *e.config, now) {
-			log.Printf("User %s is not permitted to log in now - locking session", username)
-			if err := e.lockSession(username, activeSession.SessionId, userConfig); err != nil {
-				log.Printf("Failed to lock session for %s: %v", username, err)
+		// Blocked apps are killed whenever the user is logged in, but app
+		// usage only counts while they are at their session
+		if len(userConfig.Apps) > 0 || len(userConfig.BlockedApps) > 0 {
+			e.checkApps(username, userConfig, !activeSession.IsIdle(), now)
+		}
+
+		// Evaluate each session separately, since session policies can
+		// treat e.g. SSH and desktop sessions differently
+		permitted := true
+		for _, sess := range user.GetActiveSessions() {
+			if eval.PermitSession(username, sess.SessionInfo, currentState, *e.config, now) {
+				continue
 			}
+			if sess == activeSession {
+				permitted = false
+			}
+			slog.Info("Session not permitted - enforcing policy", "user", username, "session_id", sess.SessionId, "session_type", sess.Type, "decision", "deny")
+			if err := e.enforceSession(username, sess, userConfig); err != nil {
+				slog.Error("Failed to enforce policy", "user", username, "session_id", sess.SessionId, "error", err)
+			}
+		}
+		if !permitted {
 			continue
 		}
 
 		// Calculate time remaining using eval package (handles overrides)
-		timeRemainingSeconds := eval.GetTimeRemaining(username, *currentState, *e.config, now)
+		timeRemainingSeconds := eval.GetTimeRemaining(username, currentState, *e.config, now)
 
 		// Send notifications based on notify_before configuration
 		e.sendNotifications(username, activeSession.SessionId, timeRemainingSeconds, userConfig.NotifyBefore)
+
+		if userConfig.WindDown.Enabled() {
+			e.sendWindDownNotification(username, activeSession.SessionId, currentState, userConfig, now)
+		}
+
+		// Warn before a mandatory break; the session is locked by the
+		// permit check above once it is due
+		if breakRemaining, ok := eval.GetBreakRemaining(username, currentState, *e.config, now); ok {
+			e.sendBreakNotification(username, activeSession.SessionId, breakRemaining, userConfig)
+		}
 	}
 
 	// Update heartbeat
 	e.stateMgr.Heartbeat()
+	if e.heartbeatHook != nil {
+		e.heartbeatHook(time.Since(now))
+	}
+}
+
+// updateBank records today's unused allowance in the user's time bank, which
+// also settles the previous day's once the day has changed
+func (e *Engine) updateBank(username string, currentState state.State, userConfig config.UserConfig, now time.Time) {
+	pending := eval.BankPending(username, currentState, *e.config, now)
+	if bank := currentState.Users[username].Bank; bank != nil && bank.HasPending(now, pending) {
+		return // nothing has changed
+	}
+
+	err := e.stateMgr.UpdateUser(username, false, func(u *session.User) error {
+		if u.Bank == nil {
+			u.Bank = &session.TimeBank{}
+		}
+		u.Bank.SetPending(now, pending, int64(time.Duration(userConfig.Bank.Max).Seconds()), time.Duration(userConfig.Bank.Expiry))
+		return nil
+	})
+	if err != nil {
+		slog.Error("Failed to update time bank", "user", username, "error", err)
+	}
+}
+
+// updateLedgerUse records how much of the week's ledger entries the user
+// has spent today, so each counts only once across the week
+func (e *Engine) updateLedgerUse(username string, currentState state.State, now time.Time) {
+	pending := eval.LedgerWeekPending(username, currentState, *e.config, now)
+	use := currentState.Users[username].LedgerUse
+	if use.HasPending(now, pending) || (use == nil && pending == 0) {
+		return // nothing has changed
+	}
+
+	err := e.stateMgr.UpdateUser(username, false, func(u *session.User) error {
+		if u.LedgerUse == nil {
+			u.LedgerUse = &session.LedgerUse{}
+		}
+		u.LedgerUse.SetPending(now, pending)
+		return nil
+	})
+	if err != nil {
+		slog.Error("Failed to update ledger use", "user", username, "error", err)
+	}
 }
 
 // sendNotifications sends desktop notifications to users when time is running low
 func (e *Engine) sendNotifications(username, sessionPath string, timeRemainingSeconds int64, notifyBefore []config.Duration) {
 
-	log.Printf("DEBUG: Preparing to send notifications to %s with %d seconds remaining", username, timeRemainingSeconds)
+	slog.Debug("Checking notification thresholds", "user", username, "session_id", sessionPath, "remaining_seconds", timeRemainingSeconds)
 
 	// Check if we should send a notification
 	if !eval.CheckSendNotification(timeRemainingSeconds, notifyBefore) {
@@ -129,16 +247,80 @@ func (e *Engine) sendNotifications(username, sessionPath string, timeRemainingSe
 
 	// Send notification
 	timeRemaining := time.Duration(timeRemainingSeconds) * time.Second
-	message := formatTimeRemaining(timeRemaining)
+	message := FormatTimeRemaining(timeRemaining)
 	if err := e.sendDesktopNotification(username, sessionPath, message); err != nil {
-		log.Printf("Failed to send notification to %s: %v", username, err)
+		slog.Error("Failed to send notification", "user", username, "session_id", sessionPath, "error", err)
 	} else {
-		log.Printf("Sent notification to %s: %s remaining", username, message)
+		slog.Info("Sent notification", "user", username, "session_id", sessionPath, "remaining", message)
+	}
+}
+
+// BreakNotifyBefore returns when to warn a user before a mandatory break:
+// at their notify_before thresholds, or 5 minutes before if they have none
+func BreakNotifyBefore(userConfig config.UserConfig) []config.Duration {
+	if len(userConfig.NotifyBefore) == 0 {
+		return []config.Duration{config.Duration(5 * time.Minute)}
 	}
+	return userConfig.NotifyBefore
 }
 
-// formatTimeRemaining formats duration into human-readable string
-func formatTimeRemaining(d time.Duration) string {
+// sendBreakNotification warns a user that they must take a break soon
+func (e *Engine) sendBreakNotification(username, sessionPath string, breakRemainingSeconds int64, userConfig config.UserConfig) {
+	if !eval.CheckSendNotification(breakRemainingSeconds, BreakNotifyBefore(userConfig)) {
+		return
+	}
+	if e.notificationEmit == nil {
+		slog.Error("Failed to send break notification", "user", username, "session_id", sessionPath, "error", "notification emitter not set")
+		return
+	}
+
+	remaining := FormatTimeRemaining(time.Duration(breakRemainingSeconds) * time.Second)
+	body := fmt.Sprintf("Your session will be locked in %s for a %s break",
+		remaining, FormatTimeRemaining(time.Duration(userConfig.BreakLength)))
+	if err := e.notificationEmit.EmitNotificationSignal(username, "Break Time", body, urgencyNormal, ""); err != nil {
+		slog.Error("Failed to send break notification", "user", username, "session_id", sessionPath, "error", err)
+	} else {
+		slog.Info("Sent break notification", "user", username, "session_id", sessionPath, "remaining", remaining)
+	}
+}
+
+// sendWindDownNotification updates the countdown to the end of the user's
+// allowed hours window, if they are in its last stretch
+func (e *Engine) sendWindDownNotification(username, sessionPath string, currentState state.State, userConfig config.UserConfig, now time.Time) {
+	windowEnd := eval.GetWindowEnd(username, currentState, *e.config, now)
+	if windowEnd.IsZero() {
+		return
+	}
+	secondsLeft := int64(windowEnd.Sub(now).Seconds())
+	send, critical := eval.CheckWindDown(secondsLeft, userConfig.WindDown)
+	if !send {
+		return
+	}
+	if e.notificationEmit == nil {
+		slog.Error("Failed to send wind-down notification", "user", username, "session_id", sessionPath, "error", "notification emitter not set")
+		return
+	}
+
+	urgency := urgencyNormal
+	if critical {
+		urgency = urgencyCritical
+	}
+	body := WindDownMessage(windowEnd, time.Duration(secondsLeft)*time.Second)
+	if err := e.notificationEmit.EmitNotificationSignal(username, "Time to Wind Down", body, urgency, windDownTag); err != nil {
+		slog.Error("Failed to send wind-down notification", "user", username, "session_id", sessionPath, "error", err)
+	} else {
+		slog.Info("Sent wind-down notification", "user", username, "session_id", sessionPath, "window_end", windowEnd.Format("15:04"), "critical", critical)
+	}
+}
+
+// WindDownMessage is the body of the wind-down notification, counting down
+// to windowEnd
+func WindDownMessage(windowEnd time.Time, remaining time.Duration) string {
+	return fmt.Sprintf("Your allowed hours end at %s, %s left", windowEnd.Format("15:04"), FormatTimeRemaining(remaining))
+}
+
+// FormatTimeRemaining formats duration into human-readable string
+func FormatTimeRemaining(d time.Duration) string {
 	hours := int(d.Hours())
 	minutes := int(d.Minutes()) % 60
 
@@ -157,7 +339,7 @@ func (e *Engine) sendDesktopNotification(username, sessionPath, message string)
 	title := "Session Time Warning"
 	body := fmt.Sprintf("You have %s of session time remaining", message)
 
-	return e.notificationEmit.EmitNotificationSignal(username, title, body)
+	return e.notificationEmit.EmitNotificationSignal(username, title, body, urgencyNormal, "")
 }
 
 // SendNotification sends a custom notification to a user (public method for IPC)
@@ -167,12 +349,12 @@ func (e *Engine) SendNotification(username, sessionPath, message string) error {
 	}
 
 	title := "SessionWarden"
-	return e.notificationEmit.EmitNotificationSignal(username, title, message)
+	return e.notificationEmit.EmitNotificationSignal(username, title, message, urgencyNormal, "")
 }
 
 // LockUserSession locks the active session for a user (public method for IPC)
 func (e *Engine) LockUserSession(username string) error {
-	currentState := e.stateMgr.GetState()
+	currentState := e.stateMgr.Snapshot()
 
 	// Get user from state
 	user, err := currentState.GetUser(username)
@@ -190,54 +372,114 @@ func (e *Engine) LockUserSession(username string) error {
 		}
 	}
 
-	// Get active session
-	activeSession := user.GetActiveSession()
-	if activeSession == nil {
+	// Enforce on every active session
+	activeSessions := user.GetActiveSessions()
+	if len(activeSessions) == 0 {
 		return fmt.Errorf("no active session for user %s", username)
 	}
 
-	return e.lockSession(username, activeSession.SessionId, userConfig)
+	var errs []error
+	for _, sess := range activeSessions {
+		if err := e.enforceSession(username, sess, userConfig); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// enforceSession locks or terminates a session, depending on the session
+// policy that matches it (TTY and SSH sessions can't be locked)
+func (e *Engine) enforceSession(username string, sess *session.SessionRecord, userConfig config.UserConfig) error {
+	policy, _ := userConfig.SessionPolicyFor(sess.Type, sess.Remote, sess.Service)
+	action := policy.EnforceAction()
+
+	// Sessions are enforced every minute until they are allowed again, so
+	// only count the ones that were actually locked or terminated
+	enforced := false
+	var err error
+	if action == config.ActionTerminate {
+		err = e.terminateSession(username, sess.SessionId)
+		enforced = err == nil
+	} else {
+		enforced, err = e.lockSession(username, sess.SessionId, userConfig)
+	}
+	if enforced && e.enforceHook != nil {
+		e.enforceHook(username, action)
+	}
+	return err
+}
+
+// logindObject returns the logind object at path
+func (e *Engine) logindObject(path dbus.ObjectPath) dbus.BusObject {
+	if e.login1 != nil {
+		return e.login1(path)
+	}
+	return e.conn.Object("org.freedesktop.login1", path)
+}
+
+// terminateSession ends a specific user session using loginctl
+func (e *Engine) terminateSession(username, sessionPath string) error {
+	sessionObj := e.logindObject(dbus.ObjectPath(sessionPath))
+
+	idVariant, err := sessionObj.GetProperty("org.freedesktop.login1.Session.Id")
+	if err != nil {
+		return fmt.Errorf("failed to get session ID from path %s: %w", sessionPath, err)
+	}
+
+	sessionID := idVariant.Value().(string)
+
+	managerObj := e.logindObject("/org/freedesktop/login1")
+	call := managerObj.Call("org.freedesktop.login1.Manager.TerminateSession", 0, sessionID)
+
+	if call.Err != nil {
+		return fmt.Errorf("failed to terminate session %s for %s: %w", sessionID, username, call.Err)
+	}
+
+	slog.Info("Terminated session", "user", username, "session_id", sessionID, "decision", config.ActionTerminate)
+	return nil
 }
 
-// lockSession locks a specific user session using loginctl
-func (e *Engine) lockSession(username, sessionPath string, userConfig config.UserConfig) error {
+// lockSession locks a specific user session using loginctl, and reports
+// whether it did: sessions that are already locked, or users with
+// lock_screen off, are left alone
+func (e *Engine) lockSession(username, sessionPath string, userConfig config.UserConfig) (bool, error) {
 	// Check if we should lock or just log
 	if userConfig.LockScreen != nil && !*userConfig.LockScreen {
-		log.Printf("Lock screen disabled for %s - session would be locked but policy says no", username)
-		return nil
+		slog.Info("Lock screen disabled - not locking session", "user", username, "session_id", sessionPath)
+		return false, nil
 	}
 
 	// Get the session object
-	sessionObj := e.conn.Object("org.freedesktop.login1", dbus.ObjectPath(sessionPath))
+	sessionObj := e.logindObject(dbus.ObjectPath(sessionPath))
 
 	// Check if session is already locked
 	lockedVariant, err := sessionObj.GetProperty("org.freedesktop.login1.Session.LockedHint")
 	if err != nil {
-		return fmt.Errorf("failed to get LockedHint from path %s: %w", sessionPath, err)
+		return false, fmt.Errorf("failed to get LockedHint from path %s: %w", sessionPath, err)
 	}
 
 	isLocked := lockedVariant.Value().(bool)
 	if isLocked {
-		log.Printf("Session for %s is already locked, skipping", username)
-		return nil
+		slog.Debug("Session already locked, skipping", "user", username, "session_id", sessionPath)
+		return false, nil
 	}
 
 	// Get the actual session ID from the session object
 	idVariant, err := sessionObj.GetProperty("org.freedesktop.login1.Session.Id")
 	if err != nil {
-		return fmt.Errorf("failed to get session ID from path %s: %w", sessionPath, err)
+		return false, fmt.Errorf("failed to get session ID from path %s: %w", sessionPath, err)
 	}
 
 	sessionID := idVariant.Value().(string)
 
 	// Lock the session using the actual ID
-	managerObj := e.conn.Object("org.freedesktop.login1", "/org/freedesktop/login1")
+	managerObj := e.logindObject("/org/freedesktop/login1")
 	call := managerObj.Call("org.freedesktop.login1.Manager.LockSession", 0, sessionID)
 
 	if call.Err != nil {
-		return fmt.Errorf("failed to lock session %s for %s: %w", sessionID, username, call.Err)
+		return false, fmt.Errorf("failed to lock session %s for %s: %w", sessionID, username, call.Err)
 	}
 
-	log.Printf("Successfully locked session %s for user %s", sessionID, username)
-	return nil
+	slog.Info("Locked session", "user", username, "session_id", sessionID, "decision", config.ActionLock)
+	return true, nil
 }
@@ -4,6 +4,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/SoarinFerret/SessionWarden/internal/config"
+	"github.com/SoarinFerret/SessionWarden/internal/session"
+	"github.com/godbus/dbus/v5"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -52,8 +55,54 @@ func TestFormatTimeRemaining(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := formatTimeRemaining(tt.duration)
+			result := FormatTimeRemaining(tt.duration)
 			assert.Equal(t, tt.expected, result)
 		})
 	}
 }
+
+// fakeLogind stands in for logind's session and manager objects
+type fakeLogind struct {
+	dbus.BusObject
+	locked bool
+	calls  []string
+}
+
+func (f *fakeLogind) GetProperty(p string) (dbus.Variant, error) {
+	if p == "org.freedesktop.login1.Session.LockedHint" {
+		return dbus.MakeVariant(f.locked), nil
+	}
+	return dbus.MakeVariant("1"), nil
+}
+
+func (f *fakeLogind) Call(method string, flags dbus.Flags, args ...interface{}) *dbus.Call {
+	f.calls = append(f.calls, method)
+	if method == "org.freedesktop.login1.Manager.LockSession" {
+		f.locked = true
+	}
+	return &dbus.Call{}
+}
+
+func TestEnforceSession_CountsOnlyRealLocks(t *testing.T) {
+	logind := &fakeLogind{}
+	var actions []string
+	e := &Engine{login1: func(dbus.ObjectPath) dbus.BusObject { return logind }}
+	e.SetEnforceHook(func(username, action string) { actions = append(actions, action) })
+
+	sess := &session.SessionRecord{SessionId: "/org/freedesktop/login1/session/_31"}
+	lock := true
+	cfg := config.UserConfig{LockScreen: &lock}
+
+	// The first check locks the session; later ones find it still locked
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, e.enforceSession("alice", sess, cfg))
+	}
+	assert.Equal(t, []string{"org.freedesktop.login1.Manager.LockSession"}, logind.calls)
+	assert.Equal(t, []string{config.ActionLock}, actions)
+
+	// Nor is anything counted with locking turned off
+	lock = false
+	logind.locked = false
+	assert.NoError(t, e.enforceSession("alice", sess, cfg))
+	assert.Len(t, actions, 1)
+}
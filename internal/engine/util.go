@@ -4,9 +4,112 @@ import (
 	"bufio"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 )
 
+// procRoot is where the proc filesystem is mounted (replaced in tests)
+var procRoot = "/proc"
+
+// process is a running process, as read from /proc
+type process struct {
+	PID  int
+	Name string // from /proc/<pid>/comm, truncated by the kernel to 15 bytes
+	Exe  string // path of the executable, or "" if it can't be read
+}
+
+func (p process) String() string {
+	if p.Exe != "" {
+		return fmt.Sprintf("%d (%s)", p.PID, p.Exe)
+	}
+	return fmt.Sprintf("%d (%s)", p.PID, p.Name)
+}
+
+// userProcesses lists the processes whose real user ID is uid
+func userProcesses(uid int) ([]process, error) {
+	entries, err := os.ReadDir(procRoot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", procRoot, err)
+	}
+
+	var procs []process
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue // not a process
+		}
+		dir := filepath.Join(procRoot, entry.Name())
+
+		// Processes can exit while we read them, so skip any we can't
+		status, err := os.ReadFile(filepath.Join(dir, "status"))
+		if err != nil || procUID(string(status)) != uid {
+			continue
+		}
+		comm, err := os.ReadFile(filepath.Join(dir, "comm"))
+		if err != nil {
+			continue
+		}
+		exe, _ := os.Readlink(filepath.Join(dir, "exe"))
+		procs = append(procs, process{
+			PID:  pid,
+			Name: strings.TrimSpace(string(comm)),
+			Exe:  strings.TrimSuffix(exe, " (deleted)"),
+		})
+	}
+	return procs, nil
+}
+
+// procUID returns the real user ID from the contents of /proc/<pid>/status,
+// or -1 if it has none
+func procUID(status string) int {
+	for _, line := range strings.Split(status, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "Uid:" {
+			if uid, err := strconv.Atoi(fields[1]); err == nil {
+				return uid
+			}
+		}
+	}
+	return -1
+}
+
+// processExited reports whether p is gone, or dead and waiting for its
+// parent to reap it
+func processExited(p process) bool {
+	status, err := os.ReadFile(filepath.Join(procRoot, strconv.Itoa(p.PID), "status"))
+	if err != nil {
+		return true
+	}
+	state := procState(string(status))
+	return state == "Z" || state == "X"
+}
+
+// procState returns the state letter (e.g. "R", "S" or "Z") from the
+// contents of /proc/<pid>/status
+func procState(status string) string {
+	for _, line := range strings.Split(status, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "State:" {
+			return fields[1]
+		}
+	}
+	return ""
+}
+
+// matchesApp reports whether p is the app called name: by executable path
+// if name is a path, otherwise by process name or the base name of its
+// executable, ignoring case
+func (p process) matchesApp(name string) bool {
+	if strings.Contains(name, "/") {
+		return p.Exe != "" && p.Exe == filepath.Clean(name)
+	}
+	if strings.EqualFold(p.Name, name) {
+		return true
+	}
+	return p.Exe != "" && strings.EqualFold(filepath.Base(p.Exe), name)
+}
+
 // getEnvFromProc reads an environment variable from /proc/<pid>/environ
 func getEnvFromProc(pid int, envVar string) (string, error) {
 	path := fmt.Sprintf("/proc/%d/environ", pid)
@@ -2,8 +2,11 @@ package engine
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/SoarinFerret/SessionWarden/internal/config"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -126,3 +129,50 @@ func TestScanNullTerminated_Integration(t *testing.T) {
 
 	assert.Equal(t, expected, tokens, "Should correctly parse all environment variables")
 }
+
+func TestUserProcesses(t *testing.T) {
+	root := t.TempDir()
+	addProc := func(pid, uid, comm, exe string) {
+		dir := filepath.Join(root, pid)
+		assert.NoError(t, os.Mkdir(dir, 0755))
+		status := "Name:\t" + comm + "\nUid:\t" + uid + "\t" + uid + "\t" + uid + "\t" + uid + "\n"
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "status"), []byte(status), 0644))
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "comm"), []byte(comm+"\n"), 0644))
+		if exe != "" {
+			assert.NoError(t, os.Symlink(exe, filepath.Join(dir, "exe")))
+		}
+	}
+	addProc("100", "1000", "java", "/usr/lib/jvm/bin/java")
+	addProc("101", "1000", "minecraft-launc", "/opt/minecraft/minecraft-launcher")
+	addProc("102", "1001", "discord", "/usr/bin/discord")
+	addProc("103", "1000", "kworker", "")
+	assert.NoError(t, os.Mkdir(filepath.Join(root, "self"), 0755))
+
+	old := procRoot
+	procRoot = root
+	defer func() { procRoot = old }()
+
+	procs, err := userProcesses(1000)
+	assert.NoError(t, err)
+	assert.Len(t, procs, 3)
+
+	running := runningApps(procs, map[string]config.Duration{
+		"minecraft-launcher": config.Duration(time.Hour),
+		"Java":               config.Duration(time.Hour),
+		"discord":            config.Duration(time.Hour),
+	})
+	assert.Len(t, running, 2)
+	assert.Equal(t, 101, running["minecraft-launcher"][0].PID) // by executable, since comm is truncated
+	assert.Equal(t, 100, running["Java"][0].PID)               // ignoring case
+	assert.NotContains(t, running, "discord")                  // another user's
+}
+
+func TestProcUID(t *testing.T) {
+	assert.Equal(t, 1000, procUID("Name:\tbash\nUid:\t1000\t1000\t1000\t1000\nGid:\t100\n"))
+	assert.Equal(t, -1, procUID("Name:\tbash\n"))
+}
+
+func TestProcState(t *testing.T) {
+	assert.Equal(t, "Z", procState("Name:\tsleep\nState:\tZ (zombie)\n"))
+	assert.Equal(t, "", procState("Name:\tsleep\n"))
+}
@@ -5,23 +5,73 @@ import (
 	"time"
 
 	"github.com/SoarinFerret/SessionWarden/internal/config"
+	"github.com/SoarinFerret/SessionWarden/internal/session"
 	"github.com/SoarinFerret/SessionWarden/internal/state"
 )
 
+// Reason codes reported with a login decision
+const (
+	ReasonAllowed       = "allowed"
+	ReasonOutsideHours  = "outside_hours"
+	ReasonLimitReached  = "limit_reached"
+	ReasonPaused        = "paused"
+	ReasonBlocked       = "blocked"
+	ReasonBreak         = "break"
+	ReasonSessionDenied = "session_denied"
+)
+
+// Decision is the outcome of a login check, with enough detail to explain a
+// denial to the user.
+type Decision struct {
+	Allowed     bool
+	Reason      string
+	NextAllowed time.Time // zero if unknown (e.g. paused until resumed)
+	Message     string
+}
+
 func PermitLogin(username string, state state.State, config config.Config, now time.Time) bool {
+	return PermitSession(username, session.SessionInfo{}, state, config, now)
+}
+
+// PermitSession is like PermitLogin, but also applies the user's session
+// policy matching info (e.g. denying remote logins outside their hours, or
+// exempting SSH sessions from the daily limit).
+func PermitSession(username string, info session.SessionInfo, state state.State, config config.Config, now time.Time) bool {
+	return CheckLogin(username, info, state, config, now).Allowed
+}
+
+// CheckLogin decides whether username may start (or unlock) a session
+// described by info, and if not, why and when they next can.
+func CheckLogin(username string, info session.SessionInfo, state state.State, cfg config.Config, now time.Time) Decision {
 	if now.IsZero() {
 		now = time.Now()
 	}
 
+	allowed := Decision{Allowed: true, Reason: ReasonAllowed}
+
 	// get user config
-	userConfig, exists := config.Users[username]
+	userConfig, exists := cfg.Users[username]
 	if !exists {
 		// No specific config for user
 		// If default is enabled, use default config; otherwise allow
-		if config.Default.Enabled != nil && *config.Default.Enabled {
-			userConfig = config.Default
+		if cfg.Default.Enabled != nil && *cfg.Default.Enabled {
+			userConfig = cfg.Default
 		} else {
-			return true
+			return allowed
+		}
+	}
+
+	policy, hasPolicy := userConfig.SessionPolicyFor(info.Type, info.Remote, info.Service)
+	if hasPolicy {
+		if policy.Deny {
+			return Decision{
+				Reason:  ReasonSessionDenied,
+				Message: "This type of login is not allowed for your account",
+			}
+		}
+		if !policy.AllowedHours.IsEmpty() && !policy.AllowedHours.WithinRange(now) {
+			next := nextWindowStart(now, func(time.Time) config.TimeRange { return policy.AllowedHours })
+			return outsideHours(now, next)
 		}
 	}
 
@@ -31,55 +81,351 @@ func PermitLogin(username string, state state.State, config config.Config, now t
 		userNotFound = true // process this later
 	}
 
-	if !userNotFound && userState.AllowedHoursOverrideIsSet() {
+	if !userNotFound && userState.AllowedHoursOverrideIsActive(now) {
 		if !userState.AllowedHoursOverrideWithinRange(now) {
-			return false
+			return outsideHours(now, nextWindowStart(now, func(day time.Time) config.TimeRange {
+				return allowedHoursFor(userConfig, userState, day, now)
+			}))
 		}
 	} else {
 		// check allowed hours
-		if userConfig.IsWeekend(now) {
-			if !userConfig.WeekendHours.WithinRange(now) {
-				return false
-			}
-		} else {
-			if !userConfig.AllowedHours.WithinRange(now) {
-				return false
-			}
+		hours := configHoursFor(userConfig, now)
+		if !hours.IsEmpty() && !hours.WithinRange(now) {
+			return outsideHours(now, nextWindowStart(now, func(day time.Time) config.TimeRange {
+				return configHoursFor(userConfig, day)
+			}))
 		}
 	}
 
 	if userNotFound {
 		// User not found, apply default policy
-		return true
+		return allowed
 	}
 
 	if userState.Paused {
-		return false
+		return Decision{
+			Reason:  ReasonPaused,
+			Message: "Your account has been paused by an administrator",
+		}
+	}
+
+	if until := blockedUntil(userState, now); !until.IsZero() {
+		return Decision{
+			Reason:      ReasonBlocked,
+			NextAllowed: until,
+			Message:     "Your account is blocked until " + formatNextAllowed(now, until),
+		}
+	}
+
+	// Sessions that don't count toward the limit aren't restricted by it
+	if hasPolicy && !policy.CountsUsage() {
+		return allowed
+	}
+
+	// Check daily limit (with overrides and the time bank applied)
+	if dailyLimit, limited := dailyLimitFor(userConfig, userState, now); limited && timeUsedToday(userConfig, userState) >= dailyLimit+autoSpendBalance(userConfig, userState, now) {
+		// The limit resets at midnight; the next login is the first
+		// allowed moment of tomorrow
+		tomorrow := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+		next := tomorrow
+		if hours := configHoursFor(userConfig, tomorrow); !hours.IsEmpty() {
+			next = atTimeOfDay(tomorrow, hours.Start)
+		}
+		return Decision{
+			Reason:      ReasonLimitReached,
+			NextAllowed: next,
+			Message:     "Daily limit reached, next login allowed at " + formatNextAllowed(now, next),
+		}
+	}
+
+	if until := breakUntil(userConfig, userState, now); !until.IsZero() {
+		return Decision{
+			Reason:      ReasonBreak,
+			NextAllowed: until,
+			Message:     "Time for a break, next login allowed at " + formatNextAllowed(now, until),
+		}
+	}
+
+	return allowed
+}
+
+func outsideHours(now, next time.Time) Decision {
+	message := "Login is not allowed at this time"
+	if !next.IsZero() {
+		message += ", next login allowed at " + formatNextAllowed(now, next)
+	}
+	return Decision{
+		Reason:      ReasonOutsideHours,
+		NextAllowed: next,
+		Message:     message,
 	}
+}
 
-	// Check daily limit (with ExtraTime overrides applied)
-	todayUsage := userState.GetTimeUsed()
-	dailyLimit := time.Duration(userConfig.DailyLimit).Seconds()
+// configHoursFor returns the configured allowed hours for day, taking
+// calendar policies and weekend days into account
+func configHoursFor(userConfig config.UserConfig, day time.Time) config.TimeRange {
+	if p, ok := userConfig.DayPolicyFor(day); ok && !p.AllowedHours.IsEmpty() {
+		return p.AllowedHours
+	}
+	if userConfig.IsWeekend(day) {
+		return userConfig.WeekendHours
+	}
+	return userConfig.AllowedHours
+}
 
-	// Apply ExtraTime from active overrides
+// allowedHoursFor returns the allowed hours on day, preferring an
+// AllowedHours override that is active when its window starts that day
+func allowedHoursFor(userConfig config.UserConfig, userState *session.User, day, now time.Time) config.TimeRange {
 	for _, override := range userState.Overrides {
-		if !override.IsExpired(now) && override.ExtraTime > 0 {
-			dailyLimit += float64(override.ExtraTime * 60) // ExtraTime is in minutes
+		if override.AllowedHours.IsEmpty() || override.IsExpired(now) {
+			continue
+		}
+		if override.IsActive(atTimeOfDay(day, override.AllowedHours.Start)) {
+			return override.AllowedHours
 		}
 	}
+	return configHoursFor(userConfig, day)
+}
 
-	if dailyLimit > 0 && float64(todayUsage) >= dailyLimit {
-		return false
+// dailyLimitFor returns the daily limit in seconds at now, applying active
+// overrides: the newest one that sets a daily limit replaces the configured
+// one (or the calendar policy's), and the extra time of each is added to it,
+// as are the rewards and penalties in the ledger (for week-scoped ones,
+// what is left of them this week). limited is false if the
+// user has no daily limit, in which case there is nothing to adjust.
+func dailyLimitFor(userConfig config.UserConfig, userState *session.User, now time.Time) (limit int64, limited bool) {
+	limit = int64(time.Duration(userConfig.DailyLimit).Seconds())
+	if p, ok := userConfig.DayPolicyFor(now); ok && p.DailyLimit > 0 {
+		limit = int64(time.Duration(p.DailyLimit).Seconds())
+	}
+	for _, override := range userState.Overrides {
+		if override.IsActive(now) && override.DailyLimit > 0 {
+			limit = int64(override.DailyLimit * 60) // DailyLimit is in minutes
+		}
+	}
+	if limit == 0 {
+		return 0, false
+	}
+
+	for _, override := range userState.Overrides {
+		if override.IsActive(now) {
+			limit += int64(override.ExtraTime * 60) // ExtraTime is in minutes
+		}
+	}
+	limit += int64(userState.LedgerMinutes(now)*60) + userState.LedgerWeekSeconds(now)
+	if limit < 0 {
+		limit = 0
+	}
+	return limit, true
+}
+
+// autoSpendBalance returns the time bank balance in seconds if the user's
+// bank is spent automatically once the daily limit is reached, or 0
+func autoSpendBalance(userConfig config.UserConfig, userState *session.User, now time.Time) int64 {
+	if !userConfig.Bank.Enabled() || !userConfig.Bank.AutoSpend || userState.Bank == nil {
+		return 0
+	}
+	return userState.Bank.Balance(now)
+}
+
+// BankPending returns how much of today's daily limit username has left
+// unused so far, to be saved in their time bank at the end of the day. It
+// is negative if they have drawn on the bank with auto-spend, and 0 if they
+// have no bank or no daily limit.
+func BankPending(username string, state state.State, cfg config.Config, now time.Time) int64 {
+	userConfig, exists := cfg.Users[username]
+	if !exists || !userConfig.Bank.Enabled() {
+		return 0
+	}
+	userState, err := state.GetUser(username)
+	if err != nil {
+		return 0
+	}
+
+	limit, limited := dailyLimitFor(userConfig, userState, now)
+	if !limited {
+		return 0
+	}
+	// Rewards left for the week carry over by themselves rather than
+	// being banked, and are spent before the bank
+	week := max(userState.LedgerWeekSeconds(now), 0)
+	pending := limit - week - timeUsedToday(userConfig, userState)
+	if pending < 0 {
+		pending = min(pending+week, 0)
+	}
+	if pending < 0 && !userConfig.Bank.AutoSpend {
+		// Without auto-spend, going over the limit (e.g. before a lock
+		// took effect) doesn't draw on the bank
+		return 0
+	}
+	return pending
+}
+
+// LedgerWeekPending returns how much of this week's week-scoped ledger
+// entries username has spent today, to be settled at the end of the day so
+// that each entry counts once across the week. Rewards are spent by using
+// time past the rest of the daily limit; penalties are taken in full on
+// the first day they apply. It is 0 if the user has no daily limit.
+func LedgerWeekPending(username string, state state.State, cfg config.Config, now time.Time) int64 {
+	userConfig, exists := cfg.Users[username]
+	if !exists {
+		return 0
+	}
+	userState, err := state.GetUser(username)
+	if err != nil {
+		return 0
+	}
+
+	limit, limited := dailyLimitFor(userConfig, userState, now)
+	if !limited {
+		return 0
 	}
+	week := userState.LedgerWeekSeconds(now)
+	if week <= 0 {
+		return week
+	}
+	spent := timeUsedToday(userConfig, userState) - (limit - week)
+	return min(max(spent, 0), week)
+}
+
+// breakUntil returns when a user who has been active for MaxContinuous
+// without a break may log in again, or the zero time if no break is due
+func breakUntil(userConfig config.UserConfig, userState *session.User, now time.Time) time.Time {
+	if userConfig.MaxContinuous <= 0 {
+		return time.Time{}
+	}
+	breakLength := time.Duration(userConfig.BreakLength)
+	start, end, ok := userState.ContinuousUse(now, breakLength)
+	if !ok || end.Sub(start) < time.Duration(userConfig.MaxContinuous) {
+		return time.Time{}
+	}
+	return end.Add(breakLength)
+}
+
+// GetBreakRemaining returns the seconds username may stay active before
+// they must take a break. ok is false if they have no max_continuous
+// setting.
+func GetBreakRemaining(username string, state state.State, cfg config.Config, now time.Time) (remaining int64, ok bool) {
+	userConfig, exists := cfg.Users[username]
+	if !exists || userConfig.MaxContinuous <= 0 {
+		return 0, false
+	}
+	maxContinuous := time.Duration(userConfig.MaxContinuous)
+	userState, err := state.GetUser(username)
+	if err != nil {
+		return int64(maxContinuous.Seconds()), true
+	}
+
+	start, end, active := userState.ContinuousUse(now, time.Duration(userConfig.BreakLength))
+	if !active {
+		return int64(maxContinuous.Seconds()), true
+	}
+	return max(int64((maxContinuous - end.Sub(start)).Seconds()), 0), true
+}
+
+// GetAppRemaining returns the seconds username has left today in each app
+// with a budget, which are negative once the budget is exceeded
+func GetAppRemaining(username string, state state.State, cfg config.Config, now time.Time) map[string]int64 {
+	userConfig, exists := cfg.Users[username]
+	if !exists || len(userConfig.Apps) == 0 {
+		return nil
+	}
+	var usage *session.AppUsage
+	if userState, err := state.GetUser(username); err == nil {
+		usage = userState.Apps
+	}
+
+	remaining := make(map[string]int64, len(userConfig.Apps))
+	for app, budget := range userConfig.Apps {
+		remaining[app] = int64(time.Duration(budget).Seconds()) - usage.Used(app, now)
+	}
+	return remaining
+}
+
+// blockedUntil returns when the user's active Block overrides stop blocking
+// them, following on from one override to the next. Returns the zero time if
+// the user isn't blocked at now.
+func blockedUntil(userState *session.User, now time.Time) time.Time {
+	var until time.Time
+	// Bounded in case of a long chain of repeating overrides
+	for i := 0; i < 366; i++ {
+		end, blocked := blockEnd(userState, now)
+		if !blocked {
+			break
+		}
+		until, now = end, end
+	}
+	return until
+}
+
+// blockEnd returns the end of the latest-ending Block override active at
+// now. Repeating overrides end at midnight, since their next day may not be
+// one they repeat on.
+func blockEnd(userState *session.User, now time.Time) (time.Time, bool) {
+	var end time.Time
+	blocked := false
+	for _, override := range userState.Overrides {
+		if !override.Block || !override.IsActive(now) {
+			continue
+		}
+		// IsExpired is exclusive of ExpiresAt
+		e := override.ExpiresAt.Add(time.Nanosecond)
+		if len(override.Repeat) > 0 {
+			midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+			if midnight.Before(e) {
+				e = midnight
+			}
+		}
+		if e.After(end) {
+			end = e
+		}
+		blocked = true
+	}
+	return end, blocked
+}
+
+// nextWindowStart finds the next start of an allowed hours window after now,
+// looking up to a week ahead. Days without a window are unrestricted, so
+// they start at midnight. Returns the zero time if no window was found.
+func nextWindowStart(now time.Time, hoursFor func(day time.Time) config.TimeRange) time.Time {
+	for i := 0; i <= 7; i++ {
+		day := time.Date(now.Year(), now.Month(), now.Day()+i, 0, 0, 0, 0, now.Location())
+		hours := hoursFor(day)
+		if hours.IsEmpty() {
+			if i > 0 {
+				return day
+			}
+			continue
+		}
+		if start := atTimeOfDay(day, hours.Start); start.After(now) {
+			return start
+		}
+	}
+	return time.Time{}
+}
 
-	// Placeholder logic: allow all users to log in
-	return true
+// atTimeOfDay returns day at the hour and minute of clock
+func atTimeOfDay(day, clock time.Time) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), clock.Hour(), clock.Minute(), 0, 0, day.Location())
+}
+
+// formatNextAllowed formats next relative to now: just the time if it is
+// within a day, otherwise with the weekday or date
+func formatNextAllowed(now, next time.Time) string {
+	switch {
+	case next.Sub(now) < 24*time.Hour:
+		return next.Format("15:04")
+	case next.Sub(now) < 6*24*time.Hour:
+		return next.Format("Mon 15:04")
+	default:
+		return next.Format("2006-01-02 15:04")
+	}
 }
 
 // GetTimeRemaining calculates the time remaining (in seconds) until a user's session
 // should be locked, considering both daily time limits and allowed hours restrictions.
-// Returns the minimum of:
-//   - Time remaining from daily limit (with ExtraTime overrides applied)
+// Returns 0 while a Block override is active, otherwise the minimum of:
+//   - Time remaining from daily limit (with DailyLimit and ExtraTime overrides applied)
 //   - Time until end of allowed hours window (with AllowedHours overrides applied)
 //
 // Returns math.MaxInt64 if there are no restrictions.
@@ -107,20 +453,15 @@ func GetTimeRemaining(username string, state state.State, cfg config.Config, now
 		return math.MaxInt64
 	}
 
+	if !blockedUntil(userState, now).IsZero() {
+		return 0
+	}
+
 	// Calculate time remaining from daily limit
 	var timeRemainingFromLimit int64 = math.MaxInt64
-	if userConfig.DailyLimit > 0 {
-		timeUsedSeconds := userState.GetTimeUsed()
-		dailyLimitSeconds := int64(time.Duration(userConfig.DailyLimit).Seconds())
-
-		// Apply ExtraTime from active overrides
-		for _, override := range userState.Overrides {
-			if !override.IsExpired(now) && override.ExtraTime > 0 {
-				dailyLimitSeconds += int64(override.ExtraTime * 60) // ExtraTime is in minutes
-			}
-		}
-
-		timeRemainingFromLimit = dailyLimitSeconds - timeUsedSeconds
+	if dailyLimitSeconds, limited := dailyLimitFor(userConfig, userState, now); limited {
+		timeUsedSeconds := timeUsedToday(userConfig, userState)
+		timeRemainingFromLimit = dailyLimitSeconds + autoSpendBalance(userConfig, userState, now) - timeUsedSeconds
 		if timeRemainingFromLimit < 0 {
 			timeRemainingFromLimit = 0
 		}
@@ -133,7 +474,7 @@ func GetTimeRemaining(username string, state state.State, cfg config.Config, now
 	var allowedHours config.TimeRange
 	hasOverride := false
 	for _, override := range userState.Overrides {
-		if !override.IsExpired(now) && !override.AllowedHours.IsEmpty() {
+		if override.IsActive(now) && !override.AllowedHours.IsEmpty() {
 			allowedHours = override.AllowedHours
 			hasOverride = true
 			break
@@ -142,12 +483,7 @@ func GetTimeRemaining(username string, state state.State, cfg config.Config, now
 
 	// If no override, use config-based allowed hours
 	if !hasOverride {
-		isWeekend := userConfig.IsWeekend(now)
-		if isWeekend && !userConfig.WeekendHours.IsEmpty() {
-			allowedHours = userConfig.WeekendHours
-		} else if !isWeekend && !userConfig.AllowedHours.IsEmpty() {
-			allowedHours = userConfig.AllowedHours
-		}
+		allowedHours = configHoursFor(userConfig, now)
 	}
 
 	// Calculate time until end of window if there's a restriction
@@ -170,6 +506,57 @@ func GetTimeRemaining(username string, state state.State, cfg config.Config, now
 	return timeUntilEndOfWindow
 }
 
+// GetWindowEnd returns when today's allowed hours window ends for username,
+// taking AllowedHours overrides into account. Returns the zero time if the
+// user has no window today.
+func GetWindowEnd(username string, state state.State, cfg config.Config, now time.Time) time.Time {
+	userConfig, exists := cfg.Users[username]
+	if !exists {
+		if cfg.Default.Enabled == nil || !*cfg.Default.Enabled {
+			return time.Time{}
+		}
+		userConfig = cfg.Default
+	}
+
+	userState, err := state.GetUser(username)
+	if err != nil {
+		userState = &session.User{}
+	}
+
+	hours := allowedHoursFor(userConfig, userState, now, now)
+	if hours.IsEmpty() {
+		return time.Time{}
+	}
+	return atTimeOfDay(now, hours.End)
+}
+
+// GetTimeUsed returns the seconds username has used today that count toward
+// their daily limit. Users without a config have all of their usage counted.
+func GetTimeUsed(username string, state state.State, cfg config.Config) int64 {
+	userState, err := state.GetUser(username)
+	if err != nil {
+		return 0
+	}
+
+	userConfig, exists := cfg.Users[username]
+	if !exists {
+		userConfig = cfg.Default
+	}
+	return timeUsedToday(userConfig, userState)
+}
+
+// timeUsedToday returns today's usage, leaving out sessions whose policy
+// says they don't count toward the daily limit
+func timeUsedToday(userConfig config.UserConfig, userState *session.User) int64 {
+	if len(userConfig.SessionPolicies) == 0 {
+		return userState.GetTimeUsed()
+	}
+	return userState.GetTimeUsedForDayFiltered(session.Now(), func(s session.SessionRecord) bool {
+		policy, ok := userConfig.SessionPolicyFor(s.Type, s.Remote, s.Service)
+		return !ok || policy.CountsUsage()
+	})
+}
+
 // CheckSendNotification determines if a notification should be sent based on
 // the time remaining and configured notification thresholds.
 // Returns true if timeRemainingSeconds is within any notification window.
@@ -192,3 +579,24 @@ func CheckSendNotification(timeRemainingSeconds int64, notifyBefore []config.Dur
 
 	return false
 }
+
+// CheckWindDown determines if a wind-down notification should be sent with
+// secondsToWindowEnd left before the allowed hours window ends: every
+// Interval from Start on, and every minute once it is critical (within
+// CriticalAt of the end). Like CheckSendNotification, each notification has
+// a 1 minute window to account for the check interval.
+func CheckWindDown(secondsToWindowEnd int64, wd config.WindDownConfig) (send, critical bool) {
+	if !wd.Enabled() || secondsToWindowEnd <= 0 {
+		return false, false
+	}
+
+	remaining := time.Duration(secondsToWindowEnd) * time.Second
+	start := time.Duration(wd.Start)
+	if remaining > start {
+		return false, false
+	}
+	if remaining <= wd.CriticalAt() {
+		return true, true
+	}
+	return (start-remaining)%wd.Interval() < time.Minute, false
+}
@@ -290,6 +290,30 @@ func TestGetTimeRemaining_AllowedHoursOverride(t *testing.T) {
 	}
 }
 
+func TestGetWindowEnd(t *testing.T) {
+	st := state.State{Users: map[string]session.User{"alice": {}}}
+	cfg := exampleConfig()
+	now := time.Date(2024, 6, 3, 16, 30, 0, 0, time.UTC) // Monday at 16:30
+
+	if end := GetWindowEnd("alice", st, cfg, now); !end.Equal(time.Date(2024, 6, 3, 17, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected window to end at 17:00, got %v", end)
+	}
+
+	// An AllowedHours override moves the end
+	alice := st.Users["alice"]
+	allowedHours, _ := config.ParseTimeRange("08:00-20:00")
+	alice.AddOverride(session.NewAllowedHoursOverride("Working late", allowedHours, now.Add(24*time.Hour)))
+	st.Users["alice"] = alice
+	if end := GetWindowEnd("alice", st, cfg, now); !end.Equal(time.Date(2024, 6, 3, 20, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected window to end at 20:00 with override, got %v", end)
+	}
+
+	// Users without a config are unrestricted
+	if end := GetWindowEnd("bobby", st, cfg, now); !end.IsZero() {
+		t.Errorf("expected no window for unconfigured user, got %v", end)
+	}
+}
+
 func TestGetTimeRemaining_ExpiredOverride(t *testing.T) {
 	st := state.State{Users: map[string]session.User{"alice": {}}}
 	cfg := exampleConfig()
@@ -340,6 +364,37 @@ func TestGetTimeRemaining_MultipleOverrides(t *testing.T) {
 	}
 }
 
+func TestGetTimeRemaining_ScheduledOverrides(t *testing.T) {
+	st := state.State{Users: map[string]session.User{"alice": {}}}
+	cfg := exampleConfig()
+	now := time.Date(2024, 6, 3, 10, 0, 0, 0, time.UTC) // Monday at 10:00
+
+	// Alice has used 2.5 hours of her 3h limit
+	alice := st.Users["alice"]
+	start := time.Now().Add(-3 * time.Hour)
+	alice.AddSession(start, "sess1")
+	alice.EndSession(start.Add(2*time.Hour+30*time.Minute), "sess1")
+
+	// Only the Monday override applies: the others repeat on Saturdays or
+	// haven't started yet
+	monday := session.NewExtraTimeOverride("Mondays", 30, now.Add(30*24*time.Hour))
+	monday.Repeat = []string{"Monday"}
+	saturday := session.NewExtraTimeOverride("Saturdays", 60, now.Add(30*24*time.Hour))
+	saturday.Repeat = []string{"Saturday"}
+	later := session.NewExtraTimeOverride("Next week", 60, now.Add(30*24*time.Hour))
+	later.StartsAt = now.Add(7 * 24 * time.Hour)
+	alice.AddOverride(monday)
+	alice.AddOverride(saturday)
+	alice.AddOverride(later)
+	st.Users["alice"] = alice
+
+	remaining := GetTimeRemaining("alice", st, cfg, now)
+	expected := int64(60 * 60) // 30m original + 30m Monday override
+	if remaining != expected {
+		t.Errorf("expected %d seconds remaining, got %d", expected, remaining)
+	}
+}
+
 func TestGetTimeRemaining_NegativeTimeRemaining(t *testing.T) {
 	st := state.State{Users: map[string]session.User{"alice": {}}}
 	cfg := exampleConfig()
@@ -359,6 +414,40 @@ func TestGetTimeRemaining_NegativeTimeRemaining(t *testing.T) {
 	}
 }
 
+func TestCheckWindDown(t *testing.T) {
+	wd := config.WindDownConfig{
+		Start: config.Duration(30 * time.Minute),
+		Every: config.Duration(10 * time.Minute),
+	}
+	tests := []struct {
+		remaining      time.Duration
+		send, critical bool
+	}{
+		{31 * time.Minute, false, false},
+		{30 * time.Minute, true, false},
+		{29*time.Minute + 30*time.Second, true, false},
+		{29 * time.Minute, false, false},
+		{20 * time.Minute, true, false},
+		{15 * time.Minute, false, false},
+		{10 * time.Minute, true, false},
+		{6 * time.Minute, false, false},
+		// Critical from 5 minutes (the default), every minute
+		{5 * time.Minute, true, true},
+		{3 * time.Minute, true, true},
+		{0, false, false},
+	}
+	for _, tt := range tests {
+		send, critical := CheckWindDown(int64(tt.remaining.Seconds()), wd)
+		if send != tt.send || critical != tt.critical {
+			t.Errorf("CheckWindDown(%v) = %v, %v, want %v, %v", tt.remaining, send, critical, tt.send, tt.critical)
+		}
+	}
+
+	if send, _ := CheckWindDown(60, config.WindDownConfig{}); send {
+		t.Errorf("expected no wind-down notifications when disabled")
+	}
+}
+
 func TestCheckSendNotification_EmptyThresholds(t *testing.T) {
 	notifyBefore := []config.Duration{}
 	timeRemaining := int64(10 * 60) // 10 minutes
@@ -527,3 +616,491 @@ enabled = true
 		t.Errorf("GetTimeRemaining = %d, want %d (weekend window on configured weekend day)", remaining, 3*60*60)
 	}
 }
+
+func sessionPolicyConfig() config.Config {
+	tomlData := `
+[users.alice]
+enabled = true
+daily_limit = "1h"
+allowed_hours = "08:00-22:00"
+weekend_hours = "08:00-22:00"
+[users.alice.sessions.sshd]
+count_usage = false
+[users.alice.sessions.remote]
+allowed_hours = "16:00-20:00"
+[users.alice.sessions.tty]
+deny = true
+`
+	cfg, err := config.LoadConfigFromBytes([]byte(tomlData))
+	if err != nil {
+		panic(err)
+	}
+	return cfg
+}
+
+func TestPermitSession_UncountedSessions(t *testing.T) {
+	cfg := sessionPolicyConfig()
+	now := time.Date(2024, 6, 3, 17, 0, 0, 0, time.UTC)
+	session.SetClock(func() time.Time { return now })
+	defer session.SetClock(nil)
+
+	alice := session.User{}
+	start := now.Add(-3 * time.Hour)
+	alice.AddSessionWithInfo(start, "ssh1", session.SessionInfo{Type: "tty", Remote: true, Service: "sshd"})
+	alice.EndSession(start.Add(2*time.Hour), "ssh1")
+	st := state.State{Users: map[string]session.User{"alice": alice}}
+
+	// Two hours over SSH don't count toward the one hour limit
+	desktop := session.SessionInfo{Type: "wayland", Service: "gdm-password"}
+	if !PermitSession("alice", desktop, st, cfg, now) {
+		t.Errorf("expected desktop session to be permitted when only SSH time was used")
+	}
+	if remaining := GetTimeRemaining("alice", st, cfg, now); remaining != 3600 {
+		t.Errorf("expected SSH time to be excluded from time remaining, got %d", remaining)
+	}
+
+	// Use up the limit on the desktop; SSH is still allowed
+	alice.AddSessionWithInfo(start.Add(2*time.Hour), "gui1", desktop)
+	alice.EndSession(start.Add(3*time.Hour), "gui1")
+	st.Users["alice"] = alice
+	if PermitSession("alice", desktop, st, cfg, now) {
+		t.Errorf("expected desktop session to be denied once the limit is used")
+	}
+	ssh := session.SessionInfo{Type: "tty", Remote: true, Service: "sshd"}
+	if !PermitSession("alice", ssh, st, cfg, now) {
+		t.Errorf("expected SSH session to ignore the daily limit")
+	}
+}
+
+func TestPermitSession_RemoteHoursAndDeny(t *testing.T) {
+	cfg := sessionPolicyConfig()
+	st := state.State{Users: map[string]session.User{"alice": {}}}
+	remote := session.SessionInfo{Type: "tty", Remote: true, Service: "telnet"}
+
+	if PermitSession("alice", remote, st, cfg, time.Date(2024, 6, 3, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected remote session to be denied outside remote hours")
+	}
+	if !PermitSession("alice", remote, st, cfg, time.Date(2024, 6, 3, 17, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected remote session to be allowed within remote hours")
+	}
+
+	local := session.SessionInfo{Type: "tty", Service: "login"}
+	if PermitSession("alice", local, st, cfg, time.Date(2024, 6, 3, 17, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected denied session type to be refused")
+	}
+
+	// No session info falls back to the plain login rules
+	if !PermitLogin("alice", st, cfg, time.Date(2024, 6, 3, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected PermitLogin to ignore session policies")
+	}
+}
+
+func TestCheckLogin_Reasons(t *testing.T) {
+	cfg := exampleConfig()
+	monday := func(hour, minute int) time.Time {
+		return time.Date(2024, 6, 3, hour, minute, 0, 0, time.UTC)
+	}
+	session.SetClock(func() time.Time { return monday(12, 0) })
+	defer session.SetClock(nil)
+
+	st := state.State{Users: map[string]session.User{"alice": {}}}
+
+	d := CheckLogin("alice", session.SessionInfo{}, st, cfg, monday(12, 0))
+	if !d.Allowed || d.Reason != ReasonAllowed {
+		t.Errorf("expected login to be allowed, got %+v", d)
+	}
+
+	// Before the 09:00 window opens
+	d = CheckLogin("alice", session.SessionInfo{}, st, cfg, monday(7, 30))
+	if d.Allowed || d.Reason != ReasonOutsideHours {
+		t.Errorf("expected outside_hours, got %+v", d)
+	}
+	if !d.NextAllowed.Equal(monday(9, 0)) {
+		t.Errorf("expected next login at 09:00, got %v", d.NextAllowed)
+	}
+	if d.Message != "Login is not allowed at this time, next login allowed at 09:00" {
+		t.Errorf("unexpected message: %q", d.Message)
+	}
+
+	// Friday evening: the next window is Saturday's weekend hours
+	d = CheckLogin("alice", session.SessionInfo{}, st, cfg, time.Date(2024, 6, 7, 18, 0, 0, 0, time.UTC))
+	if !d.NextAllowed.Equal(time.Date(2024, 6, 8, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected next login Saturday 10:00, got %v", d.NextAllowed)
+	}
+
+	// Daily limit (3h) used up
+	alice := session.User{}
+	alice.AddSession(monday(8, 0), "sess1")
+	alice.EndSession(monday(11, 0), "sess1")
+	st.Users["alice"] = alice
+	d = CheckLogin("alice", session.SessionInfo{}, st, cfg, monday(12, 0))
+	if d.Allowed || d.Reason != ReasonLimitReached {
+		t.Errorf("expected limit_reached, got %+v", d)
+	}
+	if !d.NextAllowed.Equal(time.Date(2024, 6, 4, 9, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected next login tomorrow at 09:00, got %v", d.NextAllowed)
+	}
+	if d.Message != "Daily limit reached, next login allowed at 09:00" {
+		t.Errorf("unexpected message: %q", d.Message)
+	}
+
+	// Paused users have no known next login
+	st.Users["alice"] = session.User{Paused: true}
+	d = CheckLogin("alice", session.SessionInfo{}, st, cfg, monday(12, 0))
+	if d.Allowed || d.Reason != ReasonPaused || !d.NextAllowed.IsZero() {
+		t.Errorf("expected paused with no next login, got %+v", d)
+	}
+}
+
+func TestCheckLogin_CombinedOverrides(t *testing.T) {
+	cfg := exampleConfig()
+	monday := func(hour, minute int) time.Time {
+		return time.Date(2024, 6, 3, hour, minute, 0, 0, time.UTC)
+	}
+	session.SetClock(func() time.Time { return monday(12, 0) })
+	defer session.SetClock(nil)
+
+	// 2h used of alice's 3h limit
+	alice := session.User{}
+	alice.AddSession(monday(9, 0), "sess1")
+	alice.EndSession(monday(11, 0), "sess1")
+
+	// Taking 30m away and allowing the evening in one override
+	alice.AddOverride(session.Override{
+		ExtraTime:    -30,
+		AllowedHours: config.TimeRange{Start: time.Date(0, 1, 1, 9, 0, 0, 0, time.UTC), End: time.Date(0, 1, 1, 21, 0, 0, 0, time.UTC)},
+		ExpiresAt:    monday(23, 59),
+	})
+	st := state.State{Users: map[string]session.User{"alice": alice}}
+	if remaining := GetTimeRemaining("alice", st, cfg, monday(12, 0)); remaining != 30*60 {
+		t.Errorf("expected 30m remaining, got %ds", remaining)
+	}
+	if d := CheckLogin("alice", session.SessionInfo{}, st, cfg, monday(18, 0)); !d.Allowed {
+		t.Errorf("expected login at 18:00 to be allowed by the override, got %+v", d)
+	}
+
+	// A daily limit override replaces the configured limit, and extra time
+	// still applies on top of it
+	alice.AddOverride(session.Override{DailyLimit: 120, ExpiresAt: monday(23, 59)})
+	st.Users["alice"] = alice
+	d := CheckLogin("alice", session.SessionInfo{}, st, cfg, monday(12, 0))
+	if d.Allowed || d.Reason != ReasonLimitReached {
+		t.Errorf("expected limit_reached with a 2h limit less 30m, got %+v", d)
+	}
+
+	// Blocked for the rest of the week
+	blocked := session.User{}
+	blocked.AddOverride(session.Override{Block: true, StartsAt: monday(0, 0), ExpiresAt: time.Date(2024, 6, 7, 23, 59, 59, 0, time.UTC)})
+	st.Users["alice"] = blocked
+	d = CheckLogin("alice", session.SessionInfo{}, st, cfg, monday(12, 0))
+	if d.Allowed || d.Reason != ReasonBlocked {
+		t.Errorf("expected blocked, got %+v", d)
+	}
+	if !d.NextAllowed.Truncate(time.Second).Equal(time.Date(2024, 6, 7, 23, 59, 59, 0, time.UTC)) {
+		t.Errorf("expected next login when the block expires, got %v", d.NextAllowed)
+	}
+	if GetTimeRemaining("alice", st, cfg, monday(12, 0)) != 0 {
+		t.Errorf("expected no time remaining while blocked")
+	}
+	if d := CheckLogin("alice", session.SessionInfo{}, st, cfg, time.Date(2024, 6, 8, 12, 0, 0, 0, time.UTC)); !d.Allowed {
+		t.Errorf("expected login after the block to be allowed, got %+v", d)
+	}
+
+	// Blocked on Mondays and Tuesdays: the block ends Wednesday at midnight
+	repeating := session.User{}
+	repeating.AddOverride(session.Override{Block: true, Repeat: []string{"Monday", "Tuesday"}, ExpiresAt: monday(0, 0).AddDate(0, 1, 0)})
+	st.Users["alice"] = repeating
+	d = CheckLogin("alice", session.SessionInfo{}, st, cfg, monday(12, 0))
+	if !d.NextAllowed.Equal(time.Date(2024, 6, 5, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected next login Wednesday at midnight, got %+v", d)
+	}
+}
+
+func TestCheckLogin_CalendarPolicy(t *testing.T) {
+	cfg, err := config.LoadConfigFromBytes([]byte(`
+[calendar.days]
+holiday = ["2024-06-03"]
+
+[users.alice]
+enabled = true
+daily_limit = "2h"
+allowed_hours = "16:00-19:00"
+weekend_hours = "10:00-20:00"
+
+[users.alice.calendar.holiday]
+weekend = true
+daily_limit = "4h"
+`))
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	holiday := func(hour, minute int) time.Time {
+		return time.Date(2024, 6, 3, hour, minute, 0, 0, time.Local) // a Monday
+	}
+	session.SetClock(func() time.Time { return holiday(13, 0) })
+	defer session.SetClock(nil)
+
+	// 3h used: over the usual limit, but not the holiday's
+	alice := session.User{}
+	alice.AddSession(holiday(9, 0), "sess1")
+	alice.EndSession(holiday(12, 0), "sess1")
+	st := state.State{Users: map[string]session.User{"alice": alice}}
+
+	// The weekend hours apply, rather than the weekday 16:00-19:00
+	if d := CheckLogin("alice", session.SessionInfo{}, st, cfg, holiday(13, 0)); !d.Allowed {
+		t.Errorf("expected login on the holiday to be allowed, got %+v", d)
+	}
+	if remaining := GetTimeRemaining("alice", st, cfg, holiday(13, 0)); remaining != 60*60 {
+		t.Errorf("expected 1h remaining of the holiday's 4h limit, got %ds", remaining)
+	}
+
+	// The next day is a normal Tuesday
+	d := CheckLogin("alice", session.SessionInfo{}, st, cfg, time.Date(2024, 6, 4, 13, 0, 0, 0, time.Local))
+	if d.Allowed || d.Reason != ReasonOutsideHours {
+		t.Errorf("expected outside_hours on Tuesday, got %+v", d)
+	}
+}
+
+func TestTimeBank(t *testing.T) {
+	cfg, err := config.LoadConfigFromBytes([]byte(`
+[users.alice]
+enabled = true
+daily_limit = "2h"
+
+[users.alice.bank]
+max = "3h"
+auto_spend = true
+
+[users.bob]
+enabled = true
+daily_limit = "2h"
+
+[users.bob.bank]
+max = "3h"
+`))
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	now := time.Date(2024, 6, 3, 12, 0, 0, 0, time.UTC)
+	session.SetClock(func() time.Time { return now })
+	defer session.SetClock(nil)
+
+	// Both have used 2.5h of their 2h limit, and have 1h saved
+	user := func() session.User {
+		u := session.User{Bank: &session.TimeBank{Deposits: []session.BankDeposit{{Day: now.AddDate(0, 0, -1), Seconds: 3600}}}}
+		u.AddSession(now.Add(-150*time.Minute), "sess1")
+		u.EndSession(now, "sess1")
+		return u
+	}
+	st := state.State{Users: map[string]session.User{"alice": user(), "bob": user()}}
+
+	// With auto-spend, the bank extends the limit
+	if remaining := GetTimeRemaining("alice", st, cfg, now); remaining != 30*60 {
+		t.Errorf("expected 30m of alice's bank left, got %ds", remaining)
+	}
+	if !PermitLogin("alice", st, cfg, now) {
+		t.Errorf("expected alice to be allowed while she has banked time")
+	}
+	if pending := BankPending("alice", st, cfg, now); pending != -30*60 {
+		t.Errorf("expected alice to have drawn 30m from the bank, got %ds", pending)
+	}
+
+	// Without it, the bank must be spent by hand
+	if remaining := GetTimeRemaining("bob", st, cfg, now); remaining != 0 {
+		t.Errorf("expected no time remaining for bob, got %ds", remaining)
+	}
+	if pending := BankPending("bob", st, cfg, now); pending != 0 {
+		t.Errorf("expected nothing pending for bob, got %ds", pending)
+	}
+
+	// Unused time is pending for the bank
+	st.Users["bob"] = session.User{}
+	if pending := BankPending("bob", st, cfg, now); pending != 2*3600 {
+		t.Errorf("expected bob's whole limit to be pending, got %ds", pending)
+	}
+}
+
+func TestLedger(t *testing.T) {
+	cfg, err := config.LoadConfigFromBytes([]byte(`
+[users.alice]
+enabled = true
+daily_limit = "1h"
+`))
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	now := time.Date(2024, 6, 5, 12, 0, 0, 0, time.UTC)
+	session.SetClock(func() time.Time { return now })
+	defer session.SetClock(nil)
+
+	u := session.User{}
+	u.AddSession(now.Add(-70*time.Minute), "sess1")
+	u.EndSession(now, "sess1")
+	st := state.State{Users: map[string]session.User{"alice": u}}
+
+	if PermitLogin("alice", st, cfg, now) {
+		t.Errorf("expected alice to be over her limit")
+	}
+
+	u.AddHistory(session.HistoryEntry{Kind: session.HistoryLedger, Minutes: 30, Scope: session.LedgerDay})
+	st.Users["alice"] = u
+	if remaining := GetTimeRemaining("alice", st, cfg, now); remaining != 20*60 {
+		t.Errorf("expected a reward of 30m to leave 20m, got %ds", remaining)
+	}
+
+	u.AddHistory(session.HistoryEntry{Kind: session.HistoryLedger, Minutes: -90, Scope: session.LedgerWeek})
+	st.Users["alice"] = u
+	if remaining := GetTimeRemaining("alice", st, cfg, now); remaining != 0 {
+		t.Errorf("expected a penalty to leave nothing, got %ds", remaining)
+	}
+	if d := CheckLogin("alice", session.SessionInfo{}, st, cfg, now); d.Allowed || d.Reason != ReasonLimitReached {
+		t.Errorf("expected a limit_reached denial, got %+v", d)
+	}
+}
+
+func TestLedger_WeekCountsOnce(t *testing.T) {
+	cfg, err := config.LoadConfigFromBytes([]byte(`
+[users.alice]
+enabled = true
+daily_limit = "1h"
+
+[users.alice.bank]
+max = "3h"
+`))
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	monday := time.Date(2024, 6, 3, 20, 0, 0, 0, time.UTC)
+	session.SetClock(func() time.Time { return monday })
+	defer session.SetClock(nil)
+
+	u := session.User{}
+	u.AddHistory(session.HistoryEntry{Time: monday.Add(-10 * time.Hour), Kind: session.HistoryLedger, Minutes: 30, Scope: session.LedgerWeek})
+	u.AddSession(monday.Add(-80*time.Minute), "sess1")
+	u.EndSession(monday, "sess1")
+	st := state.State{Users: map[string]session.User{"alice": u}}
+
+	// 20 of the 30 minutes were used on Monday, and none of the rest is
+	// banked since it carries over anyway
+	if got := LedgerWeekPending("alice", st, cfg, monday); got != 20*60 {
+		t.Errorf("expected 20m of the reward spent, got %ds", got)
+	}
+	if got := BankPending("alice", st, cfg, monday); got != 0 {
+		t.Errorf("expected nothing to bank, got %ds", got)
+	}
+
+	// On Tuesday only the remaining 10 minutes are added
+	tuesday := monday.AddDate(0, 0, 1)
+	session.SetClock(func() time.Time { return tuesday })
+	u.LedgerUse = &session.LedgerUse{}
+	u.LedgerUse.SetPending(monday, 20*60)
+	st.Users["alice"] = u
+	if remaining := GetTimeRemaining("alice", st, cfg, tuesday); remaining != 70*60 {
+		t.Errorf("expected 1h10m on Tuesday, got %ds", remaining)
+	}
+}
+
+func TestCheckLogin_Break(t *testing.T) {
+	cfg, err := config.LoadConfigFromBytes([]byte(`
+[users.alice]
+enabled = true
+max_continuous = "45m"
+break_length = "10m"
+`))
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	now := time.Date(2024, 6, 3, 12, 0, 0, 0, time.UTC)
+	session.SetClock(func() time.Time { return now })
+	defer session.SetClock(nil)
+
+	// 45 minutes in two sessions, with a 5 minute gap that isn't a break
+	u := session.User{}
+	u.AddSession(now.Add(-45*time.Minute), "sess1")
+	u.EndSession(now.Add(-30*time.Minute), "sess1")
+	u.AddSession(now.Add(-25*time.Minute), "sess2")
+	st := state.State{Users: map[string]session.User{"alice": u}}
+
+	if !PermitLogin("alice", st, cfg, now.Add(-time.Minute)) {
+		t.Errorf("expected alice to be allowed before max_continuous")
+	}
+	if PermitLogin("alice", st, cfg, now) {
+		t.Errorf("expected alice to be denied at max_continuous")
+	}
+	if remaining, ok := GetBreakRemaining("alice", st, cfg, now); !ok || remaining != 0 {
+		t.Errorf("expected a break to be due now, got %ds, %v", remaining, ok)
+	}
+	if remaining, _ := GetBreakRemaining("alice", st, cfg, now.Add(-5*time.Minute)); remaining != 5*60 {
+		t.Errorf("expected 5m before a break, got %ds", remaining)
+	}
+
+	// Locked at 45 minutes: denied until the break is over
+	u.EndSession(now, "sess2")
+	st.Users["alice"] = u
+	d := CheckLogin("alice", session.SessionInfo{}, st, cfg, now.Add(3*time.Minute))
+	if d.Allowed || d.Reason != ReasonBreak || !d.NextAllowed.Equal(now.Add(10*time.Minute)) {
+		t.Errorf("expected a break until 12:10, got %+v", d)
+	}
+	if !PermitLogin("alice", st, cfg, now.Add(10*time.Minute)) {
+		t.Errorf("expected alice to be allowed after her break")
+	}
+
+	// Users without max_continuous are never sent on a break
+	if _, ok := GetBreakRemaining("bob", st, cfg, now); ok {
+		t.Errorf("expected no break limit for bob")
+	}
+}
+
+func TestGetAppRemaining(t *testing.T) {
+	cfg, err := config.LoadConfigFromBytes([]byte(`
+[users.alice]
+enabled = true
+
+[users.alice.apps]
+minecraft = "1h"
+discord = "10m"
+`))
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	now := time.Date(2024, 6, 3, 12, 0, 0, 0, time.UTC)
+	u := session.User{Apps: &session.AppUsage{
+		Day:     time.Date(2024, 6, 3, 0, 0, 0, 0, time.UTC),
+		Seconds: map[string]int64{"minecraft": 1800, "discord": 900},
+	}}
+	st := state.State{Users: map[string]session.User{"alice": u}}
+
+	remaining := GetAppRemaining("alice", st, cfg, now)
+	if remaining["minecraft"] != 1800 || remaining["discord"] != -300 {
+		t.Errorf("unexpected remaining app time: %v", remaining)
+	}
+	// Usage is per day
+	if remaining := GetAppRemaining("alice", st, cfg, now.AddDate(0, 0, 1)); remaining["discord"] != 600 {
+		t.Errorf("expected discord's full budget the next day, got %ds", remaining["discord"])
+	}
+	if remaining := GetAppRemaining("bob", st, cfg, now); remaining != nil {
+		t.Errorf("expected no app budgets for bob, got %v", remaining)
+	}
+}
+
+func TestCheckLogin_SessionDenied(t *testing.T) {
+	cfg := sessionPolicyConfig()
+	st := state.State{Users: map[string]session.User{"alice": {}}}
+	d := CheckLogin("alice", session.SessionInfo{Type: "tty"}, st, cfg, time.Date(2024, 6, 3, 17, 0, 0, 0, time.UTC))
+	if d.Allowed || d.Reason != ReasonSessionDenied || d.Message == "" {
+		t.Errorf("expected session_denied with a message, got %+v", d)
+	}
+}
+
+func TestPermitLogin_NoAllowedHours(t *testing.T) {
+	// Without allowed_hours configured, any time of day is permitted
+	cfg, _ := config.LoadConfigFromBytes([]byte(`
+[users.alice]
+enabled = true
+daily_limit = "2h"
+`))
+	st := state.State{Users: map[string]session.User{"alice": {}}}
+	if !PermitLogin("alice", st, cfg, time.Date(2024, 6, 3, 23, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected login to be permitted when no allowed hours are configured")
+	}
+}
@@ -0,0 +1,212 @@
+package ipc
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+	"github.com/godbus/dbus/v5/prop"
+)
+
+// manager2XML documents the Manager2 interface with argument names, which
+// can't be derived from the Go methods. Properties are added from the
+// exported property map.
+const manager2XML = `
+<interface name="io.github.soarinferret.sessionwarden.Manager2">
+	<method name="Ping">
+		<arg name="reply" type="s" direction="out"/>
+	</method>
+	<method name="CheckLogin">
+		<arg name="user" type="s" direction="in"/>
+		<arg name="allowed" type="b" direction="out"/>
+	</method>
+	<method name="CheckLoginDetailed">
+		<arg name="user" type="s" direction="in"/>
+		<arg name="pam_context" type="a{ss}" direction="in"/>
+		<arg name="allowed" type="b" direction="out"/>
+		<arg name="reason" type="s" direction="out"/>
+		<arg name="next_allowed" type="x" direction="out"/>
+		<arg name="message" type="s" direction="out"/>
+	</method>
+	<method name="GetExemptGroups">
+		<arg name="groups" type="as" direction="out"/>
+	</method>
+	<method name="ListUsers">
+		<arg name="users" type="as" direction="out"/>
+	</method>
+	<method name="GetUserObject">
+		<arg name="user" type="s" direction="in"/>
+		<arg name="path" type="o" direction="out"/>
+	</method>
+	<method name="GetUserStatus">
+		<arg name="user" type="s" direction="in"/>
+		<!-- (paused, time_used, time_remaining (-1 if unrestricted),
+		     sessions (id, start, end, type, remote, service, active_seconds, idle),
+		     overrides (id, reason, extra_minutes, allowed_hours, expires_at, created_at, created_by, starts_at, repeat,
+		     daily_limit_minutes, block),
+		     ledger (time, minutes, scope, reason, by)) -->
+		<arg name="status" type="(bxxa(sxxsbsxb)a(ssisxxsxsib)a(xisss))" direction="out"/>
+	</method>
+	<method name="ListOverrides">
+		<arg name="user" type="s" direction="in"/>
+		<arg name="overrides" type="a{sa(ssisxxsxsib)}" direction="out"/>
+	</method>
+	<method name="ListLoginAttempts">
+		<arg name="user" type="s" direction="in"/>
+		<!-- (time, reason, service, phase, detail) -->
+		<arg name="attempts" type="a{sa(xssss)}" direction="out"/>
+	</method>
+	<method name="PauseUser">
+		<arg name="user" type="s" direction="in"/>
+	</method>
+	<method name="ResumeUser">
+		<arg name="user" type="s" direction="in"/>
+	</method>
+	<!-- fields are as for EditOverride; without expires_at the override ends at midnight -->
+	<method name="AddOverride">
+		<arg name="user" type="s" direction="in"/>
+		<arg name="fields" type="a{sv}" direction="in"/>
+		<arg name="id" type="s" direction="out"/>
+	</method>
+	<method name="RemoveOverride">
+		<arg name="id" type="s" direction="in"/>
+	</method>
+	<!-- changes may set reason (s), extra_minutes (i, negative to take time away),
+	     daily_limit_minutes (i), block (b), allowed_hours (s), starts_at (x), expires_at (x)
+	     and repeat (s, weekdays such as "sat,sun", or empty for every day) -->
+	<method name="EditOverride">
+		<arg name="id" type="s" direction="in"/>
+		<arg name="changes" type="a{sv}" direction="in"/>
+	</method>
+	<!-- minutes are negative for a penalty; scope is "day" (the default) or "week" -->
+	<method name="AddLedgerEntry">
+		<arg name="user" type="s" direction="in"/>
+		<arg name="minutes" type="i" direction="in"/>
+		<arg name="scope" type="s" direction="in"/>
+		<arg name="reason" type="s" direction="in"/>
+	</method>
+	<method name="ListLedger">
+		<arg name="user" type="s" direction="in"/>
+		<!-- (time, minutes, scope, reason, by) -->
+		<arg name="entries" type="a(xisss)" direction="out"/>
+	</method>
+	<method name="GetAppUsage">
+		<arg name="user" type="s" direction="in"/>
+		<!-- (app, used, budget), in seconds -->
+		<arg name="apps" type="a(sxx)" direction="out"/>
+	</method>
+	<method name="GetBank">
+		<arg name="user" type="s" direction="in"/>
+		<!-- (balance, today (unused so far, negative if drawn on), auto_spend), in seconds -->
+		<arg name="bank" type="(xxb)" direction="out"/>
+	</method>
+	<!-- moves minutes from the bank into an extra time override for today -->
+	<method name="SpendBank">
+		<arg name="user" type="s" direction="in"/>
+		<arg name="minutes" type="i" direction="in"/>
+		<arg name="id" type="s" direction="out"/>
+	</method>
+	<method name="SendNotification">
+		<arg name="user" type="s" direction="in"/>
+		<arg name="message" type="s" direction="in"/>
+	</method>
+	<!-- urgency is 0 (low), 1 (normal) or 2 (critical); notifications with
+	     the same non-empty tag replace each other and don't expire -->
+	<signal name="NotificationSignal">
+		<arg name="user" type="s"/>
+		<arg name="title" type="s"/>
+		<arg name="message" type="s"/>
+		<arg name="urgency" type="y"/>
+		<arg name="tag" type="s"/>
+	</signal>
+</interface>`
+
+// Export publishes the Manager and Manager2 interfaces on conn, along with
+// their properties and introspection data, and an object for each user
+// under users/<uid>.
+func (s *SessionManager) Export(conn *dbus.Conn) error {
+	path := dbus.ObjectPath(ObjectPath)
+
+	if err := conn.Export(s, path, InterfaceName); err != nil {
+		return fmt.Errorf("failed to export %s: %w", InterfaceName, err)
+	}
+	if err := conn.Export(NewManager2(s), path, Interface2Name); err != nil {
+		return fmt.Errorf("failed to export %s: %w", Interface2Name, err)
+	}
+
+	props, err := prop.Export(conn, path, s.propertyMap())
+	if err != nil {
+		return fmt.Errorf("failed to export properties: %w", err)
+	}
+
+	node, err := s.introspection(props)
+	if err != nil {
+		return err
+	}
+	if err := conn.Export(introspect.NewIntrospectable(node), path, "org.freedesktop.DBus.Introspectable"); err != nil {
+		return fmt.Errorf("failed to export introspection: %w", err)
+	}
+
+	s.SetConnection(conn)
+	s.users = newUserObjects(s, conn)
+	s.Manager.SetChangeHook(s.users.changed)
+	return nil
+}
+
+// ServeUserObjects keeps the per-user objects up to date until ctx is
+// cancelled. Export must have been called first.
+func (s *SessionManager) ServeUserObjects(ctx context.Context) {
+	s.users.run(ctx)
+}
+
+func (s *SessionManager) propertyMap() prop.Map {
+	groups, _ := s.GetExemptGroups()
+	return prop.Map{
+		Interface2Name: {
+			"Version":      {Value: APIVersion, Emit: prop.EmitConst},
+			"ExemptGroups": {Value: groups, Emit: prop.EmitConst},
+		},
+	}
+}
+
+// introspection describes the object: the original interface is generated
+// from the SessionManager's methods, Manager2 comes from manager2XML.
+func (s *SessionManager) introspection(props *prop.Properties) (*introspect.Node, error) {
+	var manager2 introspect.Interface
+	if err := xml.Unmarshal([]byte(manager2XML), &manager2); err != nil {
+		return nil, fmt.Errorf("invalid %s introspection data: %w", Interface2Name, err)
+	}
+	manager2.Properties = props.Introspection(Interface2Name)
+
+	// The original interface's signal lacks the urgency and tag
+	notification := findSignal(manager2, "NotificationSignal")
+	if len(notification.Args) > 3 {
+		notification.Args = notification.Args[:3:3]
+	}
+
+	return &introspect.Node{
+		Name: ObjectPath,
+		Interfaces: []introspect.Interface{
+			introspect.IntrospectData,
+			prop.IntrospectData,
+			{
+				Name:    InterfaceName,
+				Methods: introspect.Methods(s),
+				Signals: []introspect.Signal{notification},
+			},
+			manager2,
+		},
+		Children: []introspect.Node{{Name: "users"}},
+	}, nil
+}
+
+func findSignal(iface introspect.Interface, name string) introspect.Signal {
+	for _, sig := range iface.Signals {
+		if sig.Name == name {
+			return sig
+		}
+	}
+	return introspect.Signal{Name: name}
+}
@@ -0,0 +1,568 @@
+package ipc
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SoarinFerret/SessionWarden/internal/config"
+	"github.com/SoarinFerret/SessionWarden/internal/eval"
+	"github.com/SoarinFerret/SessionWarden/internal/session"
+	"github.com/godbus/dbus/v5"
+)
+
+// Interface2Name is the typed version of the Manager interface. It is
+// exported on the same object, alongside the original JSON-based interface.
+const Interface2Name = "io.github.soarinferret.sessionwarden.Manager2"
+
+// APIVersion is published as the Version property of Manager2
+const APIVersion uint32 = 2
+
+// UserStatus is a user's current state, as returned by Manager2.GetUserStatus
+// (D-Bus signature (bxxa(sxxsbsxb)a(ssisxxsxsib)a(xisss))).
+type UserStatus struct {
+	Paused        bool
+	TimeUsed      int64 // seconds counted toward today's limit
+	TimeRemaining int64 // seconds, or -1 if the user is unrestricted
+	Sessions      []SessionStatus
+	Overrides     []OverrideInfo
+	Ledger        []LedgerEntry // rewards and penalties that apply today
+}
+
+// SessionStatus describes one of today's sessions (D-Bus signature
+// (sxxsbsxb)). Times are unix seconds; End is 0 while the session is open.
+type SessionStatus struct {
+	Id            string
+	Start         int64
+	End           int64
+	Type          string
+	Remote        bool
+	Service       string
+	ActiveSeconds int64
+	Idle          bool
+}
+
+// OverrideInfo describes an override (D-Bus signature (ssisxxsxsib)).
+// AllowedHours is "HH:MM-HH:MM" or empty, and times are unix seconds
+// (CreatedAt is 0 for overrides from before creation times were recorded,
+// StartsAt is 0 if the override took effect when it was added). Repeat is
+// a comma-separated list of weekdays, or empty for every day.
+// DailyLimitMinutes is 0 if the override doesn't replace the daily limit.
+type OverrideInfo struct {
+	Id                string
+	Reason            string
+	ExtraMinutes      int32
+	AllowedHours      string
+	ExpiresAt         int64
+	CreatedAt         int64
+	CreatedBy         string
+	StartsAt          int64
+	Repeat            string
+	DailyLimitMinutes int32
+	Block             bool
+}
+
+// BankStatus is a user's time bank (D-Bus signature (xxb)), in seconds.
+// Today is the allowance left unused today so far, which is saved at the
+// end of the day (negative if auto-spend has drawn on the bank).
+type BankStatus struct {
+	Balance   int64
+	Today     int64
+	AutoSpend bool
+}
+
+// AppStatus is a user's usage of an app with a daily budget (D-Bus
+// signature (sxx)), in seconds
+type AppStatus struct {
+	Name   string
+	Used   int64
+	Budget int64
+}
+
+// LedgerEntry is a reward or penalty (D-Bus signature (xisss)), with Time
+// in unix seconds and Scope "day" or "week".
+type LedgerEntry struct {
+	Time    int64
+	Minutes int32
+	Scope   string
+	Reason  string
+	By      string
+}
+
+// LoginAttempt is a denied login (D-Bus signature (xssss)), with Time in
+// unix seconds.
+type LoginAttempt struct {
+	Time    int64
+	Reason  string
+	Service string
+	Phase   string
+	Detail  string
+}
+
+// Manager2 serves the Manager2 interface. Methods that don't return JSON
+// are passed through to the SessionManager unchanged.
+type Manager2 struct {
+	sm *SessionManager
+}
+
+func NewManager2(sm *SessionManager) *Manager2 {
+	return &Manager2{sm: sm}
+}
+
+func (m *Manager2) Ping() (string, *dbus.Error) {
+	return m.sm.Ping()
+}
+
+func (m *Manager2) CheckLogin(user string) (bool, *dbus.Error) {
+	return m.sm.CheckLogin(user)
+}
+
+func (m *Manager2) CheckLoginDetailed(user string, pamContext map[string]string) (bool, string, int64, string, *dbus.Error) {
+	return m.sm.CheckLoginDetailed(user, pamContext)
+}
+
+func (m *Manager2) GetExemptGroups() ([]string, *dbus.Error) {
+	return m.sm.GetExemptGroups()
+}
+
+// ListUsers returns every user with state or a config section, sorted
+func (m *Manager2) ListUsers() ([]string, *dbus.Error) {
+	st := m.sm.Manager.Snapshot()
+	seen := make(map[string]bool)
+	users := []string{}
+	for name := range m.sm.Config.Users {
+		seen[name] = true
+		users = append(users, name)
+	}
+	for name := range st.Users {
+		if !seen[name] {
+			users = append(users, name)
+		}
+	}
+	sort.Strings(users)
+	return users, nil
+}
+
+// GetUserObject returns the path of user's object, which has the user's
+// status as properties
+func (m *Manager2) GetUserObject(user string) (dbus.ObjectPath, *dbus.Error) {
+	if m.sm.users == nil {
+		return "", dbus.MakeFailedError(fmt.Errorf("user objects are not exported"))
+	}
+	o, err := m.sm.users.object(user)
+	if err != nil {
+		return "", dbus.MakeFailedError(err)
+	}
+	return o.path, nil
+}
+
+func (m *Manager2) GetUserStatus(user string) (UserStatus, *dbus.Error) {
+	st := m.sm.Manager.Snapshot()
+	u, err := st.GetUser(user)
+	if err != nil {
+		return UserStatus{}, dbus.MakeFailedError(err)
+	}
+
+	now := time.Now()
+	remaining := eval.GetTimeRemaining(user, st, *m.sm.Config, now)
+	if remaining == math.MaxInt64 {
+		remaining = -1
+	}
+
+	status := UserStatus{
+		Paused:        u.Paused,
+		TimeUsed:      eval.GetTimeUsed(user, st, *m.sm.Config),
+		TimeRemaining: remaining,
+		Sessions:      []SessionStatus{},
+		Overrides:     overrideInfos(u.Overrides),
+		Ledger:        ledgerEntries(u.LedgerEntries(now)),
+	}
+	// Today's sessions, plus any still open from earlier days
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	for _, s := range u.Sessions {
+		if s.IsActive() || !s.StartTime.Before(midnight) {
+			status.Sessions = append(status.Sessions, sessionStatus(s))
+		}
+	}
+	return status, nil
+}
+
+// ListOverrides returns user's overrides, or those of every user with
+// overrides if user is empty
+func (m *Manager2) ListOverrides(user string) (map[string][]OverrideInfo, *dbus.Error) {
+	st := m.sm.Manager.Snapshot()
+	result := make(map[string][]OverrideInfo)
+
+	if user != "" {
+		u, err := st.GetUser(user)
+		if err != nil {
+			return nil, dbus.MakeFailedError(err)
+		}
+		result[user] = overrideInfos(u.Overrides)
+		return result, nil
+	}
+
+	for username, userData := range st.Users {
+		if len(userData.Overrides) > 0 {
+			result[username] = overrideInfos(userData.Overrides)
+		}
+	}
+	return result, nil
+}
+
+// ListLoginAttempts returns user's denied logins, or those of every user
+// with denials if user is empty
+func (m *Manager2) ListLoginAttempts(user string) (map[string][]LoginAttempt, *dbus.Error) {
+	st := m.sm.Manager.Snapshot()
+	result := make(map[string][]LoginAttempt)
+
+	if user != "" {
+		u, err := st.GetUser(user)
+		if err != nil {
+			return nil, dbus.MakeFailedError(err)
+		}
+		result[user] = loginAttempts(u.GetHistory(session.HistoryLoginDenied, time.Time{}))
+		return result, nil
+	}
+
+	for username, userData := range st.Users {
+		if attempts := userData.GetHistory(session.HistoryLoginDenied, time.Time{}); len(attempts) > 0 {
+			result[username] = loginAttempts(attempts)
+		}
+	}
+	return result, nil
+}
+
+func (m *Manager2) PauseUser(user string) *dbus.Error {
+	return m.sm.PauseUser(user)
+}
+
+func (m *Manager2) ResumeUser(user string) *dbus.Error {
+	return m.sm.ResumeUser(user)
+}
+
+// AddOverride adds an override with the given fields, which are the same as
+// EditOverride's changes, and returns its ID. Without expires_at it expires
+// at the end of the day.
+func (m *Manager2) AddOverride(sender dbus.Sender, user string, fields map[string]dbus.Variant) (string, *dbus.Error) {
+	var override session.Override
+	if err := applyOverrideChanges(&override, fields); err != nil {
+		return "", dbus.MakeFailedError(err)
+	}
+	if override.ExpiresAt.IsZero() {
+		now := session.Now()
+		override.ExpiresAt = time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location()).Add(-time.Nanosecond)
+	}
+	return m.sm.addOverride(sender, user, override)
+}
+
+// RemoveOverride removes the override with the given ID
+func (m *Manager2) RemoveOverride(id string) *dbus.Error {
+	slog.Info("RemoveOverride called via D-Bus", "override_id", id)
+
+	username, err := m.sm.overrideOwner(id)
+	if err != nil {
+		return dbus.MakeFailedError(err)
+	}
+	err = m.sm.Manager.UpdateUser(username, false, func(u *session.User) error {
+		return u.RemoveOverride(id)
+	})
+	if err != nil {
+		return dbus.MakeFailedError(err)
+	}
+	return nil
+}
+
+// EditOverride changes the override with the given ID. changes may set
+// "reason" (s), "extra_minutes" (i, negative to take time away),
+// "daily_limit_minutes" (i, 0 to keep the configured limit), "block" (b),
+// "allowed_hours" (s), "starts_at" and "expires_at" (x, unix seconds,
+// starts_at 0 to start immediately) and "repeat" (s, empty for every day);
+// other fields are left as they are.
+func (m *Manager2) EditOverride(id string, changes map[string]dbus.Variant) *dbus.Error {
+	slog.Info("EditOverride called via D-Bus", "override_id", id, "changes", changes)
+
+	username, err := m.sm.overrideOwner(id)
+	if err != nil {
+		return dbus.MakeFailedError(err)
+	}
+	err = m.sm.Manager.UpdateUser(username, false, func(u *session.User) error {
+		o, err := u.GetOverride(id)
+		if err != nil {
+			return err
+		}
+		if err := applyOverrideChanges(o, changes); err != nil {
+			return err
+		}
+		return o.Validate()
+	})
+	if err != nil {
+		return dbus.MakeFailedError(err)
+	}
+	return nil
+}
+
+// AddLedgerEntry records a reward (positive minutes) or penalty (negative)
+// for user, applying to today's limit or, with scope "week", once to the
+// rest of the week
+func (m *Manager2) AddLedgerEntry(sender dbus.Sender, user string, minutes int32, scope, reason string) *dbus.Error {
+	by := m.sm.callerName(sender)
+	slog.Info("AddLedgerEntry called via D-Bus", "user", user, "minutes", minutes, "scope", scope, "reason", reason, "created_by", by)
+
+	if minutes == 0 {
+		return dbus.MakeFailedError(fmt.Errorf("minutes must not be 0"))
+	}
+	switch scope {
+	case "":
+		scope = session.LedgerDay
+	case session.LedgerDay, session.LedgerWeek:
+	default:
+		return dbus.MakeFailedError(fmt.Errorf("invalid scope %q: expected %q or %q", scope, session.LedgerDay, session.LedgerWeek))
+	}
+
+	err := m.sm.Manager.UpdateUser(user, true, func(u *session.User) error {
+		u.AddHistory(session.HistoryEntry{
+			Kind:    session.HistoryLedger,
+			Reason:  reason,
+			Minutes: int(minutes),
+			Scope:   scope,
+			By:      by,
+		})
+		return nil
+	})
+	if err != nil {
+		return dbus.MakeFailedError(err)
+	}
+	return nil
+}
+
+// ListLedger returns user's rewards and penalties from the last 30 days,
+// including those that no longer apply
+func (m *Manager2) ListLedger(user string) ([]LedgerEntry, *dbus.Error) {
+	st := m.sm.Manager.Snapshot()
+	u, err := st.GetUser(user)
+	if err != nil {
+		return nil, dbus.MakeFailedError(err)
+	}
+	return ledgerEntries(u.GetHistory(session.HistoryLedger, time.Time{})), nil
+}
+
+// GetBank returns user's time bank
+func (m *Manager2) GetBank(user string) (BankStatus, *dbus.Error) {
+	userConfig, ok := m.sm.Config.Users[user]
+	if !ok || !userConfig.Bank.Enabled() {
+		return BankStatus{}, dbus.MakeFailedError(fmt.Errorf("user %s has no time bank", user))
+	}
+
+	st := m.sm.Manager.Snapshot()
+	now := time.Now()
+	status := BankStatus{
+		Today:     eval.BankPending(user, st, *m.sm.Config, now),
+		AutoSpend: userConfig.Bank.AutoSpend,
+	}
+	if u, err := st.GetUser(user); err == nil && u.Bank != nil {
+		status.Balance = u.Bank.Balance(now)
+	}
+	return status, nil
+}
+
+// GetAppUsage returns user's usage today of each app with a budget, sorted
+// by name
+func (m *Manager2) GetAppUsage(user string) ([]AppStatus, *dbus.Error) {
+	userConfig, ok := m.sm.Config.Users[user]
+	if !ok {
+		return []AppStatus{}, nil
+	}
+
+	var usage *session.AppUsage
+	st := m.sm.Manager.Snapshot()
+	if u, err := st.GetUser(user); err == nil {
+		usage = u.Apps
+	}
+	now := time.Now()
+	apps := make([]AppStatus, 0, len(userConfig.Apps))
+	for app, budget := range userConfig.Apps {
+		apps = append(apps, AppStatus{
+			Name:   app,
+			Used:   usage.Used(app, now),
+			Budget: int64(time.Duration(budget).Seconds()),
+		})
+	}
+	sort.Slice(apps, func(i, j int) bool { return apps[i].Name < apps[j].Name })
+	return apps, nil
+}
+
+// SpendBank takes minutes from user's time bank and grants them as extra
+// time today, returning the ID of the override that grants it
+func (m *Manager2) SpendBank(sender dbus.Sender, user string, minutes int32) (string, *dbus.Error) {
+	slog.Info("SpendBank called via D-Bus", "user", user, "minutes", minutes)
+
+	if userConfig, ok := m.sm.Config.Users[user]; !ok || !userConfig.Bank.Enabled() {
+		return "", dbus.MakeFailedError(fmt.Errorf("user %s has no time bank", user))
+	}
+	if minutes <= 0 {
+		return "", dbus.MakeFailedError(fmt.Errorf("minutes must be positive"))
+	}
+
+	now := session.Now()
+	override := session.NewExtraTimeOverride("time bank", int(minutes),
+		time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location()).Add(-time.Nanosecond))
+	override.ID = session.NewOverrideID()
+	override.CreatedBy = m.sm.callerName(sender)
+
+	err := m.sm.Manager.UpdateUser(user, false, func(u *session.User) error {
+		if u.Bank == nil {
+			return fmt.Errorf("time bank is empty")
+		}
+		want := int64(minutes) * 60
+		if balance := u.Bank.Balance(now); balance < want {
+			return fmt.Errorf("only %d minutes in the time bank", balance/60)
+		}
+		u.Bank.Withdraw(want, now)
+		u.AddOverride(override)
+		return nil
+	})
+	if err != nil {
+		return "", dbus.MakeFailedError(err)
+	}
+	return override.ID, nil
+}
+
+func (m *Manager2) SendNotification(user, message string) *dbus.Error {
+	return m.sm.SendNotification(user, message)
+}
+
+func sessionStatus(s session.SessionRecord) SessionStatus {
+	status := SessionStatus{
+		Id:            s.SessionId,
+		Start:         s.StartTime.Unix(),
+		Type:          s.Type,
+		Remote:        s.Remote,
+		Service:       s.Service,
+		ActiveSeconds: s.Duration(),
+		Idle:          s.IsIdle(),
+	}
+	if !s.EndTime.IsZero() {
+		status.End = s.EndTime.Unix()
+	}
+	return status
+}
+
+// applyOverrideChanges sets the fields of o named in changes
+func applyOverrideChanges(o *session.Override, changes map[string]dbus.Variant) error {
+	for key, value := range changes {
+		var ok bool
+		switch key {
+		case "reason":
+			o.Reason, ok = value.Value().(string)
+		case "extra_minutes":
+			var minutes int32
+			minutes, ok = value.Value().(int32)
+			o.ExtraTime = int(minutes)
+		case "daily_limit_minutes":
+			var minutes int32
+			minutes, ok = value.Value().(int32)
+			o.DailyLimit = int(minutes)
+		case "block":
+			o.Block, ok = value.Value().(bool)
+		case "allowed_hours":
+			var hours string
+			if hours, ok = value.Value().(string); ok {
+				o.AllowedHours = config.TimeRange{}
+				if hours != "" {
+					timeRange, err := config.ParseTimeRange(hours)
+					if err != nil {
+						return fmt.Errorf("invalid time range: %w", err)
+					}
+					o.AllowedHours = timeRange
+				}
+			}
+		case "starts_at":
+			var startsAt int64
+			if startsAt, ok = value.Value().(int64); ok {
+				o.StartsAt = time.Time{}
+				if startsAt != 0 {
+					o.StartsAt = time.Unix(startsAt, 0)
+				}
+			}
+		case "expires_at":
+			var expiresAt int64
+			expiresAt, ok = value.Value().(int64)
+			o.ExpiresAt = time.Unix(expiresAt, 0)
+		case "repeat":
+			var repeat string
+			if repeat, ok = value.Value().(string); ok {
+				o.Repeat = nil
+				if repeat != "" {
+					days, err := session.ParseRepeat(repeat)
+					if err != nil {
+						return err
+					}
+					o.Repeat = days
+				}
+			}
+		default:
+			return fmt.Errorf("unknown override field %q", key)
+		}
+		if !ok {
+			return fmt.Errorf("invalid type %s for override field %q", value.Signature(), key)
+		}
+	}
+	return nil
+}
+
+func overrideInfos(overrides []session.Override) []OverrideInfo {
+	infos := make([]OverrideInfo, 0, len(overrides))
+	for _, o := range overrides {
+		info := OverrideInfo{
+			Id:                o.ID,
+			Reason:            o.Reason,
+			ExtraMinutes:      int32(o.ExtraTime),
+			AllowedHours:      o.AllowedHours.String(),
+			ExpiresAt:         o.ExpiresAt.Unix(),
+			CreatedBy:         o.CreatedBy,
+			Repeat:            strings.Join(o.Repeat, ","),
+			DailyLimitMinutes: int32(o.DailyLimit),
+			Block:             o.Block,
+		}
+		if !o.CreatedAt.IsZero() {
+			info.CreatedAt = o.CreatedAt.Unix()
+		}
+		if !o.StartsAt.IsZero() {
+			info.StartsAt = o.StartsAt.Unix()
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+func ledgerEntries(entries []session.HistoryEntry) []LedgerEntry {
+	ledger := make([]LedgerEntry, 0, len(entries))
+	for _, e := range entries {
+		ledger = append(ledger, LedgerEntry{
+			Time:    e.Time.Unix(),
+			Minutes: int32(e.Minutes),
+			Scope:   e.Scope,
+			Reason:  e.Reason,
+			By:      e.By,
+		})
+	}
+	return ledger
+}
+
+func loginAttempts(entries []session.HistoryEntry) []LoginAttempt {
+	attempts := make([]LoginAttempt, 0, len(entries))
+	for _, e := range entries {
+		attempts = append(attempts, LoginAttempt{
+			Time:    e.Time.Unix(),
+			Reason:  e.Reason,
+			Service: e.Service,
+			Phase:   e.Phase,
+			Detail:  e.Detail,
+		})
+	}
+	return attempts
+}
@@ -0,0 +1,433 @@
+package ipc
+
+import (
+	"encoding/xml"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SoarinFerret/SessionWarden/internal/config"
+	"github.com/SoarinFerret/SessionWarden/internal/session"
+	"github.com/SoarinFerret/SessionWarden/internal/state"
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+	"github.com/godbus/dbus/v5/prop"
+)
+
+func testSessionManager(t *testing.T, toml string) *SessionManager {
+	m, err := state.NewManager(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+	cfg, err := config.LoadConfigFromBytes([]byte(toml))
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	return &SessionManager{Manager: m, Config: &cfg}
+}
+
+// argTypes flattens a method's arguments into "in:out" signatures
+func argTypes(args []introspect.Arg) string {
+	var in, out []string
+	for _, arg := range args {
+		if arg.Direction == "out" {
+			out = append(out, arg.Type)
+		} else {
+			in = append(in, arg.Type)
+		}
+	}
+	return strings.Join(in, "") + ":" + strings.Join(out, "")
+}
+
+func TestManager2XML_MatchesMethods(t *testing.T) {
+	var iface introspect.Interface
+	if err := xml.Unmarshal([]byte(manager2XML), &iface); err != nil {
+		t.Fatalf("invalid introspection XML: %v", err)
+	}
+	if iface.Name != Interface2Name {
+		t.Errorf("expected interface %s, got %s", Interface2Name, iface.Name)
+	}
+
+	documented := make(map[string]string)
+	for _, m := range iface.Methods {
+		documented[m.Name] = argTypes(m.Args)
+	}
+
+	exported := introspect.Methods(&Manager2{})
+	if len(exported) != len(documented) {
+		t.Errorf("XML documents %d methods, Manager2 exports %d", len(documented), len(exported))
+	}
+	for _, m := range exported {
+		want := argTypes(m.Args)
+		if got, ok := documented[m.Name]; !ok {
+			t.Errorf("method %s is not in the introspection XML", m.Name)
+		} else if got != want {
+			t.Errorf("method %s: XML has signature %s, Go method has %s", m.Name, got, want)
+		}
+	}
+}
+
+func TestIntrospection_NotificationSignals(t *testing.T) {
+	sm := testSessionManager(t, ``)
+	node, err := sm.introspection(&prop.Properties{})
+	if err != nil {
+		t.Fatalf("introspection failed: %v", err)
+	}
+
+	// The original interface keeps its three-argument signal for older
+	// clients; only Manager2 adds the urgency and tag
+	want := map[string]string{InterfaceName: "sss:", Interface2Name: "sssys:"}
+	for _, iface := range node.Interfaces {
+		sig, ok := want[iface.Name]
+		if !ok {
+			continue
+		}
+		if got := argTypes(findSignal(iface, "NotificationSignal").Args); got != sig {
+			t.Errorf("%s.NotificationSignal has signature %s, want %s", iface.Name, got, sig)
+		}
+		delete(want, iface.Name)
+	}
+	if len(want) > 0 {
+		t.Errorf("interfaces missing from introspection: %v", want)
+	}
+}
+
+func TestManager2_GetUserStatus(t *testing.T) {
+	sm := testSessionManager(t, `
+[users.alice]
+enabled = true
+daily_limit = "2h"
+`)
+	now := time.Now()
+	err := sm.Manager.UpdateUser("alice", true, func(u *session.User) error {
+		u.AddSessionWithInfo(now.Add(-10*time.Minute), "3", session.SessionInfo{Type: "wayland", Service: "gdm-password"})
+		u.AddOverride(session.NewAllowedHoursOverride("party", config.TimeRange{
+			Start: time.Date(0, 1, 1, 18, 0, 0, 0, time.UTC),
+			End:   time.Date(0, 1, 1, 23, 0, 0, 0, time.UTC),
+		}, now.Add(time.Hour)))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("UpdateUser failed: %v", err)
+	}
+
+	status, dbusErr := NewManager2(sm).GetUserStatus("alice")
+	if dbusErr != nil {
+		t.Fatalf("GetUserStatus failed: %v", dbusErr)
+	}
+	if status.Paused {
+		t.Error("expected user not to be paused")
+	}
+	if status.TimeUsed < 590 || status.TimeUsed > 610 {
+		t.Errorf("expected about 600s used, got %d", status.TimeUsed)
+	}
+	if status.TimeRemaining == -1 {
+		t.Error("expected a limited time remaining")
+	}
+	if len(status.Sessions) != 1 || status.Sessions[0].Id != "3" || status.Sessions[0].Type != "wayland" || status.Sessions[0].End != 0 {
+		t.Errorf("unexpected sessions: %+v", status.Sessions)
+	}
+	if len(status.Overrides) != 1 || status.Overrides[0].AllowedHours != "18:00-23:00" {
+		t.Errorf("unexpected overrides: %+v", status.Overrides)
+	}
+
+	if sig := dbus.SignatureOf(status).String(); sig != "(bxxa(sxxsbsxb)a(ssisxxsxsib)a(xisss))" {
+		t.Errorf("unexpected D-Bus signature %s", sig)
+	}
+
+	if _, dbusErr := NewManager2(sm).GetUserStatus("nobody"); dbusErr == nil {
+		t.Error("expected an error for an unknown user")
+	}
+}
+
+func TestManager2_ListUsers(t *testing.T) {
+	sm := testSessionManager(t, `
+[users.bob]
+enabled = true
+`)
+	if err := sm.Manager.UpdateUser("alice", true, func(u *session.User) error { return nil }); err != nil {
+		t.Fatalf("UpdateUser failed: %v", err)
+	}
+
+	users, dbusErr := NewManager2(sm).ListUsers()
+	if dbusErr != nil {
+		t.Fatalf("ListUsers failed: %v", dbusErr)
+	}
+	if strings.Join(users, ",") != "alice,bob" {
+		t.Errorf("expected alice,bob, got %v", users)
+	}
+}
+
+func TestManager2_OverridesByID(t *testing.T) {
+	sm := testSessionManager(t, `
+[users.alice]
+enabled = true
+`)
+	m := NewManager2(sm)
+	expires := dbus.MakeVariant(time.Now().Add(time.Hour).Unix())
+
+	first, dbusErr := m.AddOverride("", "alice", map[string]dbus.Variant{
+		"reason":        dbus.MakeVariant("homework"),
+		"extra_minutes": dbus.MakeVariant(int32(30)),
+		"expires_at":    expires,
+	})
+	if dbusErr != nil {
+		t.Fatalf("AddOverride failed: %v", dbusErr)
+	}
+	second, dbusErr := m.AddOverride("", "alice", map[string]dbus.Variant{
+		"reason":        dbus.MakeVariant("party"),
+		"allowed_hours": dbus.MakeVariant("18:00-23:00"),
+		"expires_at":    expires,
+	})
+	if dbusErr != nil {
+		t.Fatalf("AddOverride failed: %v", dbusErr)
+	}
+
+	// Removing the first doesn't change which override the second ID names
+	if dbusErr := m.RemoveOverride(first); dbusErr != nil {
+		t.Fatalf("RemoveOverride failed: %v", dbusErr)
+	}
+	if dbusErr := m.RemoveOverride(first); dbusErr == nil {
+		t.Error("expected an error removing an override twice")
+	}
+
+	dbusErr = m.EditOverride(second, map[string]dbus.Variant{
+		"allowed_hours": dbus.MakeVariant(""),
+		"extra_minutes": dbus.MakeVariant(int32(45)),
+	})
+	if dbusErr != nil {
+		t.Fatalf("EditOverride failed: %v", dbusErr)
+	}
+
+	overrides, _ := m.ListOverrides("alice")
+	if len(overrides["alice"]) != 1 {
+		t.Fatalf("expected 1 override, got %+v", overrides)
+	}
+	o := overrides["alice"][0]
+	if o.Id != second || o.Reason != "party" || o.ExtraMinutes != 45 || o.AllowedHours != "" || o.CreatedAt == 0 {
+		t.Errorf("unexpected override after edit: %+v", o)
+	}
+
+	// Invalid edits leave the override unchanged
+	for _, changes := range []map[string]dbus.Variant{
+		{"extra_minutes": dbus.MakeVariant(int32(0))}, // would leave it changing nothing
+		{"extra_minutes": dbus.MakeVariant("lots")},
+		{"colour": dbus.MakeVariant("blue")},
+	} {
+		if dbusErr := m.EditOverride(second, changes); dbusErr == nil {
+			t.Errorf("expected EditOverride(%v) to fail", changes)
+		}
+	}
+	overrides, _ = m.ListOverrides("alice")
+	if overrides["alice"][0] != o {
+		t.Errorf("failed edit changed the override: %+v", overrides["alice"][0])
+	}
+}
+
+func TestManager2_ScheduledOverride(t *testing.T) {
+	sm := testSessionManager(t, `
+[users.alice]
+enabled = true
+`)
+	m := NewManager2(sm)
+	startsAt := time.Now().Add(24 * time.Hour).Unix()
+	expiresAt := time.Now().Add(30 * 24 * time.Hour).Unix()
+
+	id, dbusErr := m.AddOverride("", "alice", map[string]dbus.Variant{
+		"reason":        dbus.MakeVariant("weekends"),
+		"extra_minutes": dbus.MakeVariant(int32(30)),
+		"starts_at":     dbus.MakeVariant(startsAt),
+		"expires_at":    dbus.MakeVariant(expiresAt),
+		"repeat":        dbus.MakeVariant("sat,sun"),
+	})
+	if dbusErr != nil {
+		t.Fatalf("AddOverride failed: %v", dbusErr)
+	}
+	overrides, _ := m.ListOverrides("alice")
+	o := overrides["alice"][0]
+	if o.Id != id || o.StartsAt != startsAt || o.Repeat != "Sunday,Saturday" {
+		t.Errorf("unexpected override: %+v", o)
+	}
+
+	if dbusErr := m.EditOverride(id, map[string]dbus.Variant{
+		"starts_at": dbus.MakeVariant(int64(0)),
+		"repeat":    dbus.MakeVariant(""),
+	}); dbusErr != nil {
+		t.Fatalf("EditOverride failed: %v", dbusErr)
+	}
+	overrides, _ = m.ListOverrides("alice")
+	if o := overrides["alice"][0]; o.StartsAt != 0 || o.Repeat != "" {
+		t.Errorf("expected the schedule to be cleared: %+v", o)
+	}
+
+	for _, fields := range []map[string]dbus.Variant{
+		{"extra_minutes": dbus.MakeVariant(int32(30)), "starts_at": dbus.MakeVariant(expiresAt), "expires_at": dbus.MakeVariant(startsAt)},
+		{"extra_minutes": dbus.MakeVariant(int32(30)), "repeat": dbus.MakeVariant("someday")},
+	} {
+		if _, dbusErr := m.AddOverride("", "alice", fields); dbusErr == nil {
+			t.Errorf("expected AddOverride(%v) to fail", fields)
+		}
+	}
+}
+
+func TestManager2_CombinedOverride(t *testing.T) {
+	sm := testSessionManager(t, `
+[users.alice]
+enabled = true
+daily_limit = "2h"
+`)
+	m := NewManager2(sm)
+
+	// Half an hour less today, and different allowed hours, in one override
+	id, dbusErr := m.AddOverride("", "alice", map[string]dbus.Variant{
+		"reason":        dbus.MakeVariant("chores"),
+		"extra_minutes": dbus.MakeVariant(int32(-30)),
+		"allowed_hours": dbus.MakeVariant("00:00-23:59"),
+	})
+	if dbusErr != nil {
+		t.Fatalf("AddOverride failed: %v", dbusErr)
+	}
+	overrides, _ := m.ListOverrides("alice")
+	o := overrides["alice"][0]
+	if o.Id != id || o.ExtraMinutes != -30 || o.AllowedHours != "00:00-23:59" || o.ExpiresAt <= time.Now().Unix() {
+		t.Errorf("unexpected override: %+v", o)
+	}
+
+	status, _ := m.GetUserStatus("alice")
+	if status.TimeRemaining > 90*60 {
+		t.Errorf("expected at most 90m remaining, got %ds", status.TimeRemaining)
+	}
+
+	if dbusErr := m.EditOverride(id, map[string]dbus.Variant{"block": dbus.MakeVariant(true)}); dbusErr != nil {
+		t.Fatalf("EditOverride failed: %v", dbusErr)
+	}
+	if status, _ := m.GetUserStatus("alice"); status.TimeRemaining != 0 {
+		t.Errorf("expected no time remaining while blocked, got %ds", status.TimeRemaining)
+	}
+
+	if _, dbusErr := m.AddOverride("", "alice", map[string]dbus.Variant{"reason": dbus.MakeVariant("nothing")}); dbusErr == nil {
+		t.Error("expected an error for an override that changes nothing")
+	}
+}
+
+func TestManager2_SpendBank(t *testing.T) {
+	sm := testSessionManager(t, `
+[users.alice]
+enabled = true
+daily_limit = "1h"
+
+[users.alice.bank]
+max = "2h"
+
+[users.bob]
+enabled = true
+`)
+	err := sm.Manager.UpdateUser("alice", true, func(u *session.User) error {
+		u.Bank = &session.TimeBank{Deposits: []session.BankDeposit{{Day: time.Now().AddDate(0, 0, -1), Seconds: 3600}}}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("UpdateUser failed: %v", err)
+	}
+	m := NewManager2(sm)
+
+	id, dbusErr := m.SpendBank("", "alice", 45)
+	if dbusErr != nil {
+		t.Fatalf("SpendBank failed: %v", dbusErr)
+	}
+	bank, _ := m.GetBank("alice")
+	if bank.Balance != 15*60 {
+		t.Errorf("expected 15m left in the bank, got %ds", bank.Balance)
+	}
+	// The spent time is granted today, so none of it is used yet
+	if bank.Today != 105*60 {
+		t.Errorf("expected 1h45m unused today, got %ds", bank.Today)
+	}
+	overrides, _ := m.ListOverrides("alice")
+	if o := overrides["alice"][0]; o.Id != id || o.ExtraMinutes != 45 {
+		t.Errorf("unexpected override: %+v", o)
+	}
+
+	if _, dbusErr := m.SpendBank("", "alice", 30); dbusErr == nil {
+		t.Error("expected an error spending more than the balance")
+	}
+	if _, dbusErr := m.GetBank("bob"); dbusErr == nil {
+		t.Error("expected an error for a user without a time bank")
+	}
+}
+
+func TestManager2_Ledger(t *testing.T) {
+	sm := testSessionManager(t, `
+[users.alice]
+enabled = true
+daily_limit = "1h"
+`)
+	m := NewManager2(sm)
+
+	if err := m.AddLedgerEntry("", "alice", 30, "", "did dishes"); err != nil {
+		t.Fatalf("AddLedgerEntry failed: %v", err)
+	}
+	if err := m.AddLedgerEntry("", "alice", -20, "week", "late to dinner"); err != nil {
+		t.Fatalf("AddLedgerEntry failed: %v", err)
+	}
+	if err := m.AddLedgerEntry("", "alice", 0, "day", ""); err == nil {
+		t.Error("expected an error for a zero-minute entry")
+	}
+	if err := m.AddLedgerEntry("", "alice", 10, "month", ""); err == nil {
+		t.Error("expected an error for an invalid scope")
+	}
+
+	status, dbusErr := m.GetUserStatus("alice")
+	if dbusErr != nil {
+		t.Fatalf("GetUserStatus failed: %v", dbusErr)
+	}
+	if len(status.Ledger) != 2 || status.Ledger[0].Scope != "day" || status.Ledger[0].Reason != "did dishes" {
+		t.Errorf("unexpected ledger in status: %+v", status.Ledger)
+	}
+	if status.TimeRemaining != 70*60 {
+		t.Errorf("expected 1h10m remaining, got %ds", status.TimeRemaining)
+	}
+
+	ledger, _ := m.ListLedger("alice")
+	if len(ledger) != 2 || ledger[1].Minutes != -20 {
+		t.Errorf("unexpected ledger: %+v", ledger)
+	}
+}
+
+func TestManager2_GetAppUsage(t *testing.T) {
+	sm := testSessionManager(t, `
+[users.alice]
+enabled = true
+
+[users.alice.apps]
+minecraft = "1h"
+discord = "30m"
+`)
+	err := sm.Manager.UpdateUser("alice", true, func(u *session.User) error {
+		now := time.Now()
+		u.Apps = &session.AppUsage{}
+		u.Apps.Record(now.Add(-time.Minute), []string{"minecraft"}, 20*time.Minute)
+		u.Apps.Record(now, []string{"minecraft"}, 20*time.Minute)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("UpdateUser failed: %v", err)
+	}
+	m := NewManager2(sm)
+
+	apps, dbusErr := m.GetAppUsage("alice")
+	if dbusErr != nil {
+		t.Fatalf("GetAppUsage failed: %v", dbusErr)
+	}
+	if len(apps) != 2 || apps[0].Name != "discord" || apps[1].Name != "minecraft" {
+		t.Fatalf("unexpected apps: %+v", apps)
+	}
+	if apps[0].Used != 0 || apps[0].Budget != 30*60 {
+		t.Errorf("unexpected discord usage: %+v", apps[0])
+	}
+	// Only the minute between the records counts (less just after midnight)
+	if apps[1].Used <= 0 || apps[1].Used > 60 || apps[1].Budget != 3600 {
+		t.Errorf("unexpected minecraft usage: %+v", apps[1])
+	}
+}
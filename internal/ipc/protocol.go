@@ -3,7 +3,10 @@ package ipc
 import (
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
+	osuser "os/user"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/SoarinFerret/SessionWarden/internal/config"
@@ -30,6 +33,7 @@ type SessionManager struct {
 	Config  *config.Config
 	Engine  Engine
 	conn    *dbus.Conn // D-Bus connection for emitting signals
+	users   *userObjects
 }
 
 // SetConnection sets the D-Bus connection for signal emission
@@ -37,10 +41,19 @@ func (s *SessionManager) SetConnection(conn *dbus.Conn) {
 	s.conn = conn
 }
 
+// Notification urgencies, as in the desktop notifications spec
+const (
+	UrgencyLow      byte = 0
+	UrgencyNormal   byte = 1
+	UrgencyCritical byte = 2
+)
+
 // EmitNotificationSignal sends a notification signal on the system bus
 // This signal will be picked up by user-mode sessionwardend instances
 // The username parameter allows user-mode instances to filter notifications
-func (s *SessionManager) EmitNotificationSignal(username, title, message string) error {
+// Notifications with the same non-empty tag replace each other and don't expire
+// The original interface's signal keeps its three arguments for older clients
+func (s *SessionManager) EmitNotificationSignal(username, title, message string, urgency byte, tag string) error {
 	if s.conn == nil {
 		return fmt.Errorf("D-Bus connection not set")
 	}
@@ -48,8 +61,11 @@ func (s *SessionManager) EmitNotificationSignal(username, title, message string)
 	if err := s.conn.Emit(dbus.ObjectPath(ObjectPath), InterfaceName+".NotificationSignal", username, title, message); err != nil {
 		return fmt.Errorf("failed to emit notification signal: %w", err)
 	}
+	if err := s.conn.Emit(dbus.ObjectPath(ObjectPath), Interface2Name+".NotificationSignal", username, title, message, urgency, tag); err != nil {
+		return fmt.Errorf("failed to emit notification signal: %w", err)
+	}
 
-	log.Printf("Emitted notification signal for user %s: %s - %s", username, title, message)
+	slog.Info("Emitted notification signal", "user", username, "title", title, "message", message, "urgency", urgency, "tag", tag)
 	return nil
 }
 
@@ -58,15 +74,125 @@ func (s *SessionManager) Ping() (string, *dbus.Error) {
 }
 
 func (s *SessionManager) CheckLogin(user string) (bool, *dbus.Error) {
-	log.Println("CheckLogin called via D-Bus for", user)
-	allowed := eval.PermitLogin(user, *s.Manager.GetState(), *s.Config, time.Now())
-	return allowed, nil
+	decision := eval.CheckLogin(user, session.SessionInfo{}, s.Manager.Snapshot(), *s.Config, time.Now())
+	slog.Info("CheckLogin called via D-Bus", "user", user, "decision", decision.Reason)
+	if !decision.Allowed {
+		s.recordDenial(user, decision, nil)
+	}
+	return decision.Allowed, nil
+}
+
+// CheckLoginDetailed is like CheckLogin, but also returns a reason code, the
+// next time a login will be allowed (unix seconds, 0 if unknown) and a message
+// the PAM module can show the user. pamContext carries the PAM "service",
+// "rhost" and "tty" items so session policies can be applied, and the
+// "phase" (e.g. authentication or account) the check was made in.
+func (s *SessionManager) CheckLoginDetailed(user string, pamContext map[string]string) (bool, string, int64, string, *dbus.Error) {
+	info := sessionInfoFromPAM(pamContext)
+	decision := eval.CheckLogin(user, info, s.Manager.Snapshot(), *s.Config, time.Now())
+	slog.Info("CheckLoginDetailed called via D-Bus", "user", user, "decision", decision.Reason,
+		"service", pamContext["service"], "phase", pamContext["phase"], "rhost", pamContext["rhost"], "tty", pamContext["tty"])
+	if !decision.Allowed {
+		s.recordDenial(user, decision, pamContext)
+	}
+
+	var nextAllowed int64
+	if !decision.NextAllowed.IsZero() {
+		nextAllowed = decision.NextAllowed.Unix()
+	}
+
+	return decision.Allowed, decision.Reason, nextAllowed, decision.Message, nil
+}
+
+// recordDenial adds a denied login to the user's history and alerts the
+// configured admins each time the user reaches the threshold for the day.
+// Only users with a config section or existing state are recorded.
+func (s *SessionManager) recordDenial(user string, decision eval.Decision, pamContext map[string]string) {
+	_, configured := s.Config.Users[user]
+	count := s.Manager.RecordDeniedLogin(user, configured, session.HistoryEntry{
+		Reason:  decision.Reason,
+		Service: pamContext["service"],
+		Phase:   pamContext["phase"],
+		Detail:  decision.Message,
+	})
+
+	threshold := s.Config.Alerts.DeniedLoginThreshold
+	if threshold <= 0 || count == 0 || count%threshold != 0 {
+		return
+	}
+
+	message := fmt.Sprintf("%s has been denied login %d times today (last reason: %s)", user, count, decision.Reason)
+	for _, admin := range s.Config.Alerts.Admins {
+		if err := s.EmitNotificationSignal(admin, "SessionWarden: Denied Logins", message, UrgencyNormal, ""); err != nil {
+			slog.Error("Failed to alert admin about denied logins", "admin", admin, "user", user, "error", err)
+		}
+	}
+}
+
+// ListLoginAttempts returns the denied logins recorded for user as JSON, or
+// for every user with denials if user is empty
+func (s *SessionManager) ListLoginAttempts(user string) (string, *dbus.Error) {
+	slog.Debug("ListLoginAttempts called via D-Bus", "user", user)
+
+	st := s.Manager.Snapshot()
+
+	result := make(map[string][]session.HistoryEntry)
+
+	if user != "" {
+		u, err := st.GetUser(user)
+		if err != nil {
+			return "", dbus.MakeFailedError(err)
+		}
+		result[user] = u.GetHistory(session.HistoryLoginDenied, time.Time{})
+	} else {
+		for username, userData := range st.Users {
+			if attempts := userData.GetHistory(session.HistoryLoginDenied, time.Time{}); len(attempts) > 0 {
+				result[username] = attempts
+			}
+		}
+	}
+
+	jsonData, err := json.Marshal(result)
+	if err != nil {
+		return "", dbus.MakeFailedError(err)
+	}
+
+	return string(jsonData), nil
+}
+
+// GetExemptGroups returns the groups the PAM module lets through without
+// checking, so config.toml is the single source of truth for them
+func (s *SessionManager) GetExemptGroups() ([]string, *dbus.Error) {
+	groups := s.Config.Pam.ExemptGroups
+	if groups == nil {
+		groups = []string{}
+	}
+	return groups, nil
+}
+
+// sessionInfoFromPAM approximates the logind session details from PAM items,
+// since the session doesn't exist yet when PAM asks
+func sessionInfoFromPAM(pamContext map[string]string) session.SessionInfo {
+	info := session.SessionInfo{Service: pamContext["service"]}
+
+	switch rhost := pamContext["rhost"]; rhost {
+	case "", "localhost", "127.0.0.1", "::1":
+	default:
+		info.Remote = true
+	}
+
+	tty := strings.TrimPrefix(pamContext["tty"], "/dev/")
+	if strings.HasPrefix(tty, "tty") {
+		info.Type = "tty"
+	}
+
+	return info
 }
 
 func (s *SessionManager) GetUserStatus(user string) (string, *dbus.Error) {
-	log.Println("GetUserStatus called via D-Bus for", user)
+	slog.Debug("GetUserStatus called via D-Bus", "user", user)
 
-	st := s.Manager.GetState()
+	st := s.Manager.Snapshot()
 	u, err := st.GetUser(user)
 	if err != nil {
 		return "", dbus.MakeFailedError(err)
@@ -77,7 +203,7 @@ func (s *SessionManager) GetUserStatus(user string) (string, *dbus.Error) {
 		Paused          bool                   `json:"paused"`
 		TimeUsedSeconds int64                  `json:"time_used_seconds"`
 		Sessions        []session.SessionRecord `json:"sessions"`
-		Overrides       []session.Override      `json:"exceptions"`
+		Overrides       []session.Override      `json:"overrides"`
 	}
 
 	resp := Response{
@@ -96,29 +222,23 @@ func (s *SessionManager) GetUserStatus(user string) (string, *dbus.Error) {
 }
 
 func (s *SessionManager) PauseUser(user string) *dbus.Error {
-	log.Println("PauseUser called via D-Bus for", user)
+	slog.Info("PauseUser called via D-Bus", "user", user)
 
-	st := s.Manager.GetState()
-	u, err := st.GetUser(user)
+	err := s.Manager.UpdateUser(user, false, func(u *session.User) error {
+		u.Pause()
+		return nil
+	})
 	if err != nil {
 		return dbus.MakeFailedError(err)
 	}
 
-	u.Pause()
-	st.Users[user] = *u
-
-	// Persist the change
-	if err := s.Manager.Save(); err != nil {
-		return dbus.MakeFailedError(fmt.Errorf("failed to save state: %w", err))
-	}
-
 	// Lock the user's session if they have an active session
 	if s.Engine != nil {
 		if err := s.Engine.LockUserSession(user); err != nil {
-			log.Printf("Warning: Failed to lock session for %s: %v", user, err)
+			slog.Warn("Failed to lock session for paused user", "user", user, "error", err)
 			// Don't return error - pause was successful even if lock failed
 		} else {
-			log.Printf("Successfully locked session for paused user %s", user)
+			slog.Info("Locked session for paused user", "user", user)
 		}
 	}
 
@@ -126,71 +246,100 @@ func (s *SessionManager) PauseUser(user string) *dbus.Error {
 }
 
 func (s *SessionManager) ResumeUser(user string) *dbus.Error {
-	log.Println("ResumeUser called via D-Bus for", user)
+	slog.Info("ResumeUser called via D-Bus", "user", user)
 
-	st := s.Manager.GetState()
-	u, err := st.GetUser(user)
+	err := s.Manager.UpdateUser(user, false, func(u *session.User) error {
+		u.Resume()
+		return nil
+	})
 	if err != nil {
 		return dbus.MakeFailedError(err)
 	}
 
-	u.Resume()
-	st.Users[user] = *u
+	return nil
+}
 
-	// Persist the change
-	if err := s.Manager.Save(); err != nil {
-		return dbus.MakeFailedError(fmt.Errorf("failed to save state: %w", err))
+// AddOverride adds an override granting extra time (negative to take time
+// away), different allowed hours, or both
+func (s *SessionManager) AddOverride(sender dbus.Sender, user string, reason string, extraTime int, allowedHours string, expiresAtUnix int64) *dbus.Error {
+	override := session.Override{
+		Reason:    reason,
+		ExtraTime: extraTime,
+		ExpiresAt: time.Unix(expiresAtUnix, 0),
+	}
+	if allowedHours != "" {
+		timeRange, err := config.ParseTimeRange(allowedHours)
+		if err != nil {
+			return dbus.MakeFailedError(fmt.Errorf("invalid time range: %w", err))
+		}
+		override.AllowedHours = timeRange
 	}
 
-	return nil
+	_, err := s.addOverride(sender, user, override)
+	return err
 }
 
-func (s *SessionManager) AddOverride(user string, reason string, extraTime int, allowedHours string, expiresAtUnix int64) *dbus.Error {
-	log.Println("AddOverride called via D-Bus for", user)
+// addOverride validates override and adds it for user, recording the
+// caller as its creator, and returns its ID
+func (s *SessionManager) addOverride(sender dbus.Sender, user string, override session.Override) (string, *dbus.Error) {
+	override.CreatedBy = s.callerName(sender)
+	slog.Info("AddOverride called via D-Bus", "user", user, "reason", override.Reason, "extra_minutes", override.ExtraTime,
+		"daily_limit_minutes", override.DailyLimit, "block", override.Block, "allowed_hours", override.AllowedHours.String(),
+		"starts_at", override.StartsAt, "expires_at", override.ExpiresAt, "repeat", override.Repeat, "created_by", override.CreatedBy)
 
-	st := s.Manager.GetState()
-	u, err := st.GetUser(user)
+	if err := override.Validate(); err != nil {
+		return "", dbus.MakeFailedError(err)
+	}
+	override.ID = session.NewOverrideID()
+
+	// Create the user if they don't exist yet
+	err := s.Manager.UpdateUser(user, true, func(u *session.User) error {
+		u.AddOverride(override)
+		return nil
+	})
 	if err != nil {
-		// User doesn't exist yet, create them
-		u = &session.User{
-			Sessions:  []session.SessionRecord{},
-			Overrides: []session.Override{},
-			Paused:    false,
-		}
+		return "", dbus.MakeFailedError(err)
 	}
 
-	expiresAt := time.Unix(expiresAtUnix, 0)
+	return override.ID, nil
+}
 
-	var override session.Override
-	if extraTime > 0 && allowedHours != "" {
-		return dbus.MakeFailedError(fmt.Errorf("cannot specify both extra time and allowed hours"))
-	} else if extraTime > 0 {
-		override = session.NewExtraTimeOverride(reason, extraTime, expiresAt)
-	} else if allowedHours != "" {
-		timeRange, err := config.ParseTimeRange(allowedHours)
-		if err != nil {
-			return dbus.MakeFailedError(fmt.Errorf("invalid time range: %w", err))
+// overrideOwner returns the user the override with the given ID belongs to
+func (s *SessionManager) overrideOwner(id string) (string, error) {
+	st := s.Manager.Snapshot()
+	for username, u := range st.Users {
+		if _, err := u.GetOverride(id); err == nil {
+			return username, nil
 		}
-		override = session.NewAllowedHoursOverride(reason, timeRange, expiresAt)
-	} else {
-		return dbus.MakeFailedError(fmt.Errorf("must specify either extra time or allowed hours"))
 	}
+	return "", fmt.Errorf("no override with ID %s", id)
+}
 
-	u.AddOverride(override)
-	st.Users[user] = *u
+// callerName returns the name of the user that sent a D-Bus call, or "" if
+// it can't be determined
+func (s *SessionManager) callerName(sender dbus.Sender) string {
+	if s.conn == nil || sender == "" {
+		return ""
+	}
 
-	// Persist the change
-	if err := s.Manager.Save(); err != nil {
-		return dbus.MakeFailedError(fmt.Errorf("failed to save state: %w", err))
+	var uid uint32
+	err := s.conn.BusObject().Call("org.freedesktop.DBus.GetConnectionUnixUser", 0, string(sender)).Store(&uid)
+	if err != nil {
+		slog.Debug("Failed to look up D-Bus caller", "sender", sender, "error", err)
+		return ""
 	}
 
-	return nil
+	u, err := osuser.LookupId(strconv.FormatUint(uint64(uid), 10))
+	if err != nil {
+		return strconv.FormatUint(uint64(uid), 10)
+	}
+	return u.Username
 }
 
 func (s *SessionManager) ListOverrides(user string) (string, *dbus.Error) {
-	log.Println("ListOverrides called via D-Bus for", user)
+	slog.Debug("ListOverrides called via D-Bus", "user", user)
 
-	st := s.Manager.GetState()
+	st := s.Manager.Snapshot()
 
 	result := make(map[string][]session.Override)
 
@@ -219,34 +368,28 @@ func (s *SessionManager) ListOverrides(user string) (string, *dbus.Error) {
 }
 
 func (s *SessionManager) RemoveOverride(user string, index int) *dbus.Error {
-	log.Println("RemoveOverride called via D-Bus for", user, "index", index)
+	slog.Info("RemoveOverride called via D-Bus", "user", user, "index", index)
 
-	st := s.Manager.GetState()
-	u, err := st.GetUser(user)
+	err := s.Manager.UpdateUser(user, false, func(u *session.User) error {
+		if index < 0 || index >= len(u.Overrides) {
+			return fmt.Errorf("invalid index: %d (user has %d overrides)", index, len(u.Overrides))
+		}
+
+		// Remove the override at the specified index
+		u.Overrides = append(u.Overrides[:index], u.Overrides[index+1:]...)
+		return nil
+	})
 	if err != nil {
 		return dbus.MakeFailedError(err)
 	}
 
-	if index < 0 || index >= len(u.Overrides) {
-		return dbus.MakeFailedError(fmt.Errorf("invalid index: %d (user has %d overrides)", index, len(u.Overrides)))
-	}
-
-	// Remove the override at the specified index
-	u.Overrides = append(u.Overrides[:index], u.Overrides[index+1:]...)
-	st.Users[user] = *u
-
-	// Persist the change
-	if err := s.Manager.Save(); err != nil {
-		return dbus.MakeFailedError(fmt.Errorf("failed to save state: %w", err))
-	}
-
 	return nil
 }
 
 func (s *SessionManager) SendNotification(user string, message string) *dbus.Error {
-	log.Println("SendNotification called via D-Bus for", user, "message:", message)
+	slog.Info("SendNotification called via D-Bus", "user", user, "message", message)
 
-	st := s.Manager.GetState()
+	st := s.Manager.Snapshot()
 	u, err := st.GetUser(user)
 	if err != nil {
 		return dbus.MakeFailedError(fmt.Errorf("user not found: %w", err))
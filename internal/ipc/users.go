@@ -0,0 +1,282 @@
+package ipc
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"log/slog"
+	"math"
+	"os/user"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/SoarinFerret/SessionWarden/internal/eval"
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+	"github.com/godbus/dbus/v5/prop"
+)
+
+// UserInterfaceName is the interface of the per-user objects
+const UserInterfaceName = "io.github.soarinferret.sessionwarden.User"
+
+// userRefreshInterval is how often the per-user properties are recomputed
+// when nothing has changed, so TimeUsed and TimeRemaining keep up
+const userRefreshInterval = time.Minute
+
+const userXML = `
+<interface name="io.github.soarinferret.sessionwarden.User">
+	<property name="Name" type="s" access="read">
+		<annotation name="org.freedesktop.DBus.Property.EmitsChangedSignal" value="const"/>
+	</property>
+	<property name="Uid" type="u" access="read">
+		<annotation name="org.freedesktop.DBus.Property.EmitsChangedSignal" value="const"/>
+	</property>
+	<!-- Seconds used today toward the daily limit -->
+	<property name="TimeUsed" type="x" access="read"/>
+	<!-- Seconds left, or -1 if the user is unrestricted -->
+	<property name="TimeRemaining" type="x" access="read"/>
+	<property name="Paused" type="b" access="read"/>
+	<!-- Unix time today's allowed hours end, or 0 if there are none -->
+	<property name="WindowEnd" type="x" access="read"/>
+	<!-- (id, reason, extra_minutes, allowed_hours, expires_at, created_at, created_by, starts_at, repeat, daily_limit_minutes, block) -->
+	<property name="Overrides" type="a(ssisxxsxsib)" access="read"/>
+	<!-- Emitted after PropertiesChanged when a login, lock, override or pause changes the user -->
+	<signal name="StateChanged"/>
+</interface>`
+
+// UserObjectPath returns the path of the object for the user with uid
+func UserObjectPath(uid uint32) dbus.ObjectPath {
+	return dbus.ObjectPath(fmt.Sprintf("%s/users/%d", ObjectPath, uid))
+}
+
+// userObject serves org.freedesktop.DBus.Properties for one user, computing
+// the values from the current state on each call.
+type userObject struct {
+	sm       *SessionManager
+	username string
+	uid      uint32
+	path     dbus.ObjectPath
+
+	mu   sync.Mutex
+	last map[string]dbus.Variant // values in the last PropertiesChanged
+}
+
+func (o *userObject) properties() map[string]dbus.Variant {
+	st := o.sm.Manager.Snapshot()
+	now := time.Now()
+
+	remaining := eval.GetTimeRemaining(o.username, st, *o.sm.Config, now)
+	if remaining == math.MaxInt64 {
+		remaining = -1
+	}
+	var windowEnd int64
+	if end := eval.GetWindowEnd(o.username, st, *o.sm.Config, now); !end.IsZero() {
+		windowEnd = end.Unix()
+	}
+	u := st.Users[o.username]
+
+	return map[string]dbus.Variant{
+		"Name":          dbus.MakeVariant(o.username),
+		"Uid":           dbus.MakeVariant(o.uid),
+		"TimeUsed":      dbus.MakeVariant(eval.GetTimeUsed(o.username, st, *o.sm.Config)),
+		"TimeRemaining": dbus.MakeVariant(remaining),
+		"Paused":        dbus.MakeVariant(u.Paused),
+		"WindowEnd":     dbus.MakeVariant(windowEnd),
+		"Overrides":     dbus.MakeVariant(overrideInfos(u.Overrides)),
+	}
+}
+
+func (o *userObject) Get(iface, property string) (dbus.Variant, *dbus.Error) {
+	if iface != UserInterfaceName {
+		return dbus.Variant{}, prop.ErrIfaceNotFound
+	}
+	value, ok := o.properties()[property]
+	if !ok {
+		return dbus.Variant{}, prop.ErrPropNotFound
+	}
+	return value, nil
+}
+
+func (o *userObject) GetAll(iface string) (map[string]dbus.Variant, *dbus.Error) {
+	if iface != UserInterfaceName {
+		return nil, prop.ErrIfaceNotFound
+	}
+	return o.properties(), nil
+}
+
+func (o *userObject) Set(iface, property string, value dbus.Variant) *dbus.Error {
+	return prop.ErrReadOnly
+}
+
+// changes returns the properties that differ from the last call
+func (o *userObject) changes() map[string]dbus.Variant {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	current := o.properties()
+	changed := make(map[string]dbus.Variant)
+	for name, value := range current {
+		if last, ok := o.last[name]; !ok || !reflect.DeepEqual(last.Value(), value.Value()) {
+			changed[name] = value
+		}
+	}
+	o.last = current
+	return changed
+}
+
+// userObjects keeps an object on the bus for each user with state, and
+// announces changes to them.
+type userObjects struct {
+	sm     *SessionManager
+	conn   *dbus.Conn
+	export func(o *userObject) error // puts a new object on the bus
+
+	mu      sync.Mutex
+	objects map[string]*userObject
+	pending map[string]bool // "" means every user
+	wake    chan struct{}
+}
+
+func newUserObjects(sm *SessionManager, conn *dbus.Conn) *userObjects {
+	uo := &userObjects{
+		sm:      sm,
+		conn:    conn,
+		objects: make(map[string]*userObject),
+		pending: make(map[string]bool),
+		wake:    make(chan struct{}, 1),
+	}
+	uo.export = uo.exportObject
+	return uo
+}
+
+// changed queues username for a refresh. It doesn't block, since it is
+// called from the state manager's change hook.
+func (uo *userObjects) changed(username string) {
+	uo.mu.Lock()
+	uo.pending[username] = true
+	uo.mu.Unlock()
+
+	select {
+	case uo.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run refreshes queued users until ctx is cancelled, and every user each
+// userRefreshInterval.
+func (uo *userObjects) run(ctx context.Context) {
+	ticker := time.NewTicker(userRefreshInterval)
+	defer ticker.Stop()
+
+	uo.refresh(map[string]bool{"": true}, false)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			uo.refresh(map[string]bool{"": true}, false)
+		case <-uo.wake:
+			uo.mu.Lock()
+			pending := uo.pending
+			uo.pending = make(map[string]bool)
+			uo.mu.Unlock()
+			uo.refresh(pending, true)
+		}
+	}
+}
+
+// refresh emits PropertiesChanged for the users whose properties changed,
+// followed by StateChanged if the state itself changed (rather than just
+// time passing).
+func (uo *userObjects) refresh(usernames map[string]bool, stateChanged bool) {
+	if usernames[""] {
+		st := uo.sm.Manager.Snapshot()
+		usernames = make(map[string]bool, len(st.Users))
+		for name := range st.Users {
+			usernames[name] = true
+		}
+	}
+
+	for name := range usernames {
+		o, err := uo.object(name)
+		if err != nil {
+			slog.Debug("No D-Bus object for user", "user", name, "error", err)
+			continue
+		}
+
+		changed := o.changes()
+		if len(changed) == 0 {
+			continue
+		}
+		if err := uo.conn.Emit(o.path, "org.freedesktop.DBus.Properties.PropertiesChanged",
+			UserInterfaceName, changed, []string{}); err != nil {
+			slog.Warn("Failed to emit PropertiesChanged", "user", name, "error", err)
+			continue
+		}
+		if !stateChanged {
+			continue
+		}
+		if err := uo.conn.Emit(o.path, UserInterfaceName+".StateChanged"); err != nil {
+			slog.Warn("Failed to emit StateChanged", "user", name, "error", err)
+		}
+	}
+}
+
+// object returns the user's object, exporting it the first time
+func (uo *userObjects) object(username string) (*userObject, error) {
+	uo.mu.Lock()
+	o, ok := uo.objects[username]
+	if !ok {
+		var err error
+		if o, err = uo.newObject(username); err != nil {
+			uo.mu.Unlock()
+			return nil, err
+		}
+		uo.objects[username] = o
+	}
+	uo.mu.Unlock()
+
+	if !ok {
+		// Clients read the initial values themselves, so only later
+		// changes are announced. This reads the state, so it must not
+		// hold uo.mu: the state manager calls changed with its lock held.
+		o.changes()
+	}
+	return o, nil
+}
+
+func (uo *userObjects) newObject(username string) (*userObject, error) {
+	u, err := user.Lookup(username)
+	if err != nil {
+		return nil, err
+	}
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid uid %q: %w", u.Uid, err)
+	}
+
+	o := &userObject{sm: uo.sm, username: username, uid: uint32(uid), path: UserObjectPath(uint32(uid))}
+	if err := uo.export(o); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// exportObject serves o's properties and introspection data on the bus
+func (uo *userObjects) exportObject(o *userObject) error {
+	if err := uo.conn.Export(o, o.path, "org.freedesktop.DBus.Properties"); err != nil {
+		return err
+	}
+
+	var iface introspect.Interface
+	if err := xml.Unmarshal([]byte(userXML), &iface); err != nil {
+		return fmt.Errorf("invalid %s introspection data: %w", UserInterfaceName, err)
+	}
+	node := &introspect.Node{
+		Name:       string(o.path),
+		Interfaces: []introspect.Interface{prop.IntrospectData, iface},
+	}
+	return uo.conn.Export(introspect.NewIntrospectable(node), o.path, "org.freedesktop.DBus.Introspectable")
+}
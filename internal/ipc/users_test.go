@@ -0,0 +1,134 @@
+package ipc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SoarinFerret/SessionWarden/internal/session"
+)
+
+func TestUserObject_Properties(t *testing.T) {
+	sm := testSessionManager(t, `
+[users.alice]
+enabled = true
+daily_limit = "2h"
+allowed_hours = "00:00-23:59"
+weekend_hours = "00:00-23:59"
+`)
+	if err := sm.Manager.UpdateUser("alice", true, func(u *session.User) error { return nil }); err != nil {
+		t.Fatalf("UpdateUser failed: %v", err)
+	}
+	o := &userObject{sm: sm, username: "alice", uid: 1000}
+
+	props, dbusErr := o.GetAll(UserInterfaceName)
+	if dbusErr != nil {
+		t.Fatalf("GetAll failed: %v", dbusErr)
+	}
+	for _, name := range []string{"Name", "Uid", "TimeUsed", "TimeRemaining", "Paused", "WindowEnd", "Overrides"} {
+		if _, ok := props[name]; !ok {
+			t.Errorf("missing property %s", name)
+		}
+	}
+	if end := props["WindowEnd"].Value().(int64); time.Unix(end, 0).Format("15:04") != "23:59" {
+		t.Errorf("unexpected WindowEnd %d", end)
+	}
+
+	if _, dbusErr := o.Get("org.example.Other", "Paused"); dbusErr == nil {
+		t.Error("expected an error for an unknown interface")
+	}
+	if _, dbusErr := o.Get(UserInterfaceName, "Missing"); dbusErr == nil {
+		t.Error("expected an error for an unknown property")
+	}
+	if dbusErr := o.Set(UserInterfaceName, "Paused", props["Paused"]); dbusErr == nil {
+		t.Error("expected properties to be read-only")
+	}
+}
+
+func TestUserObject_Changes(t *testing.T) {
+	sm := testSessionManager(t, `
+[users.alice]
+enabled = true
+`)
+	if err := sm.Manager.UpdateUser("alice", true, func(u *session.User) error { return nil }); err != nil {
+		t.Fatalf("UpdateUser failed: %v", err)
+	}
+	o := &userObject{sm: sm, username: "alice"}
+
+	// Everything is new the first time
+	if changed := o.changes(); len(changed) != 7 {
+		t.Errorf("expected all 7 properties on first call, got %d", len(changed))
+	}
+	if changed := o.changes(); len(changed) != 0 {
+		t.Errorf("expected no changes, got %v", changed)
+	}
+
+	sm.Manager.UpdateUser("alice", false, func(u *session.User) error {
+		u.Pause()
+		return nil
+	})
+	changed := o.changes()
+	if len(changed) != 1 || changed["Paused"].Value() != true {
+		t.Errorf("expected only Paused to change, got %v", changed)
+	}
+}
+
+func TestUserObjects_ChangedCoalesces(t *testing.T) {
+	uo := newUserObjects(nil, nil)
+
+	// Queuing never blocks, even with nobody draining the queue
+	uo.changed("alice")
+	uo.changed("bob")
+	uo.changed("alice")
+
+	if len(uo.wake) != 1 {
+		t.Errorf("expected a single wake-up, got %d", len(uo.wake))
+	}
+	if len(uo.pending) != 2 || !uo.pending["alice"] || !uo.pending["bob"] {
+		t.Errorf("unexpected pending users: %v", uo.pending)
+	}
+}
+
+func TestUserObjects_CreateWhileStateChanges(t *testing.T) {
+	sm := testSessionManager(t, `
+[users.root]
+enabled = true
+`)
+	uo := newUserObjects(sm, nil)
+	uo.export = func(*userObject) error { return nil }
+	sm.Manager.SetChangeHook(uo.changed)
+
+	// Creating an object reads the state while saves call back into uo,
+	// so the two must not wait on each other's locks
+	created := make(chan struct{})
+	go func() {
+		defer close(created)
+		for i := 0; i < 200; i++ {
+			uo.mu.Lock()
+			delete(uo.objects, "root")
+			uo.mu.Unlock()
+			if _, err := uo.object("root"); err != nil {
+				t.Errorf("object failed: %v", err)
+				return
+			}
+		}
+	}()
+	updated := make(chan struct{})
+	go func() {
+		defer close(updated)
+		for i := 0; i < 200; i++ {
+			sm.Manager.UpdateUser("root", true, func(u *session.User) error {
+				u.Paused = i%2 == 0
+				return nil
+			})
+		}
+	}()
+
+	timeout := time.After(10 * time.Second)
+	for _, done := range []chan struct{}{created, updated} {
+		select {
+		case <-done:
+		case <-timeout:
+			t.Fatal("creating user objects deadlocked with state changes")
+		}
+	}
+}
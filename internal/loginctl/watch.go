@@ -3,13 +3,16 @@ package loginctl
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 
+	"github.com/SoarinFerret/SessionWarden/internal/session"
 	"github.com/SoarinFerret/SessionWarden/internal/state"
 	"github.com/godbus/dbus/v5"
 )
 
-func Watch(ctx context.Context, sm *state.Manager) error {
+// Watch records logind session events in sm until ctx is cancelled. ready
+// (if not nil) is called once the signal subscriptions are in place.
+func Watch(ctx context.Context, sm *state.Manager, ready func()) error {
 	conn, err := dbus.ConnectSystemBus()
 	if err != nil {
 		return fmt.Errorf("failed to connect to system bus: %w", err)
@@ -45,6 +48,10 @@ func Watch(ctx context.Context, sm *state.Manager) error {
 	c := make(chan *dbus.Signal, 10)
 	conn.Signal(c)
 
+	if ready != nil {
+		ready()
+	}
+
 	for {
 		select {
 		case sig := <-c:
@@ -53,13 +60,13 @@ func Watch(ctx context.Context, sm *state.Manager) error {
 				if len(sig.Body) >= 2 {
 					sessionPath, ok := sig.Body[1].(dbus.ObjectPath)
 					if !ok {
-						log.Println("SessionNew: failed to get session object path")
+						slog.Warn("SessionNew: failed to get session object path")
 						break
 					}
 
 					class, err := getSessionClass(conn, sessionPath)
 					if err != nil {
-						log.Println("SessionNew: failed to get session class:", err)
+						slog.Warn("SessionNew: failed to get session class", "session_id", sessionPath, "error", err)
 						break
 					}
 					if class != "user" {
@@ -68,31 +75,36 @@ func Watch(ctx context.Context, sm *state.Manager) error {
 
 					username, err := getUsernameFromSession(conn, sessionPath)
 					if err != nil {
-						log.Println("SessionNew: failed to get username:", err)
+						slog.Warn("SessionNew: failed to get username", "session_id", sessionPath, "error", err)
 						break
 					}
 
-					log.Println("SessionNew for user", username, "session", sessionPath)
-					sm.HandleLogin(username, string(sessionPath))
+					info, err := getSessionInfo(conn, sessionPath)
+					if err != nil {
+						slog.Warn("SessionNew: failed to get session info", "user", username, "session_id", sessionPath, "error", err)
+					}
+
+					slog.Info("Session started", "user", username, "session_id", sessionPath, "session_type", info.Type, "remote", info.Remote, "service", info.Service)
+					sm.HandleLoginWithInfo(username, string(sessionPath), info)
 				}
 			case "org.freedesktop.login1.Manager.SessionRemoved":
 				if len(sig.Body) >= 2 {
 					sessionPath, ok := sig.Body[1].(dbus.ObjectPath)
 					if !ok {
-						log.Println("SessionNew: failed to get session object path")
+						slog.Warn("SessionRemoved: failed to get session object path")
 						break
 					}
-					log.Println("SessionRemoved for", sessionPath)
+					slog.Info("Session removed", "session_id", sessionPath)
 					sm.HandleLogout(string(sessionPath))
 				}
 			case "org.freedesktop.login1.Manager.PrepareForSleep":
 				if len(sig.Body) > 0 {
 					sleeping, _ := sig.Body[0].(bool)
 					if sleeping {
-						log.Println("System is going to sleep")
+						slog.Info("System is going to sleep")
 						sm.HandleSleep()
 					} else {
-						log.Println("System has woken up")
+						slog.Info("System has woken up")
 						sm.HandleWake()
 					}
 				}
@@ -115,7 +127,7 @@ func Watch(ctx context.Context, sm *state.Manager) error {
 					sessionPath := sig.Path
 					username, err := getUsernameFromSession(conn, sessionPath)
 					if err != nil {
-						log.Println("LockedHint: failed to get username:", err)
+						slog.Warn("LockedHint: failed to get username", "session_id", sessionPath, "error", err)
 						break
 					}
 					if locked {
@@ -156,10 +168,7 @@ func getUsernameFromSession(conn *dbus.Conn, sessionPath dbus.ObjectPath) (strin
 }
 
 func getSessionClass(conn *dbus.Conn, sessionPath dbus.ObjectPath) (string, error) {
-	obj := conn.Object("org.freedesktop.login1", sessionPath)
-	var class dbus.Variant
-	err := obj.Call("org.freedesktop.DBus.Properties.Get", 0,
-		"org.freedesktop.login1.Session", "Class").Store(&class)
+	class, err := getSessionProperty(conn, sessionPath, "Class")
 	if err != nil {
 		return "", err
 	}
@@ -169,3 +178,37 @@ func getSessionClass(conn *dbus.Conn, sessionPath dbus.ObjectPath) (string, erro
 	}
 	return "", fmt.Errorf("unexpected type for session class")
 }
+
+// getSessionInfo reads the Type, Remote and Service properties that session
+// policies are keyed on. Whatever could be read is returned alongside any error.
+func getSessionInfo(conn *dbus.Conn, sessionPath dbus.ObjectPath) (session.SessionInfo, error) {
+	var info session.SessionInfo
+
+	sessionType, err := getSessionProperty(conn, sessionPath, "Type")
+	if err != nil {
+		return info, err
+	}
+	info.Type, _ = sessionType.Value().(string)
+
+	remote, err := getSessionProperty(conn, sessionPath, "Remote")
+	if err != nil {
+		return info, err
+	}
+	info.Remote, _ = remote.Value().(bool)
+
+	service, err := getSessionProperty(conn, sessionPath, "Service")
+	if err != nil {
+		return info, err
+	}
+	info.Service, _ = service.Value().(string)
+
+	return info, nil
+}
+
+func getSessionProperty(conn *dbus.Conn, sessionPath dbus.ObjectPath, name string) (dbus.Variant, error) {
+	obj := conn.Object("org.freedesktop.login1", sessionPath)
+	var value dbus.Variant
+	err := obj.Call("org.freedesktop.DBus.Properties.Get", 0,
+		"org.freedesktop.login1.Session", name).Store(&value)
+	return value, err
+}
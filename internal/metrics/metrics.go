@@ -0,0 +1,203 @@
+// Package metrics exposes the daemon's per-user usage and engine statistics
+// in the Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SoarinFerret/SessionWarden/internal/config"
+	"github.com/SoarinFerret/SessionWarden/internal/eval"
+	"github.com/SoarinFerret/SessionWarden/internal/session"
+	"github.com/SoarinFerret/SessionWarden/internal/state"
+)
+
+// ContentType is the content type of the text exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+type enforcement struct {
+	user   string
+	action string
+}
+
+// Collector renders per-user gauges from the state and config on each
+// scrape, plus counters fed by the engine's hooks.
+type Collector struct {
+	Manager *state.Manager
+	Config  *config.Config
+
+	mu            sync.Mutex
+	enforcements  map[enforcement]uint64
+	checks        uint64
+	checkDuration time.Duration
+	lastCheck     time.Time
+}
+
+func NewCollector(m *state.Manager, cfg *config.Config) *Collector {
+	return &Collector{
+		Manager:      m,
+		Config:       cfg,
+		enforcements: make(map[enforcement]uint64),
+	}
+}
+
+// ObserveCheck records a completed engine check and how long it took
+func (c *Collector) ObserveCheck(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks++
+	c.checkDuration += d
+	c.lastCheck = session.Now()
+}
+
+// ObserveEnforcement records a session being locked or terminated, or an
+// app being killed
+func (c *Collector) ObserveEnforcement(username, action string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.enforcements[enforcement{user: username, action: action}]++
+}
+
+// ServeHTTP writes the current metrics
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", ContentType)
+	if err := c.Write(w, session.Now()); err != nil {
+		slog.Warn("Failed to write metrics", "error", err)
+	}
+}
+
+// Write renders every metric as of now
+func (c *Collector) Write(w io.Writer, now time.Time) error {
+	bw := bufio.NewWriter(w)
+	snapshot := c.Manager.Snapshot()
+	users := c.users(snapshot)
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	header(bw, "sessionwarden_time_used_seconds", "gauge", "Time used today that counts toward the daily limit.")
+	for _, name := range users {
+		sample(bw, "sessionwarden_time_used_seconds", userLabel(name), float64(eval.GetTimeUsed(name, snapshot, *c.Config)))
+	}
+
+	// Unrestricted users have no meaningful remaining time, so they are left
+	// out rather than reported as a huge number
+	header(bw, "sessionwarden_time_remaining_seconds", "gauge", "Time left before the user's sessions are locked, for restricted users.")
+	for _, name := range users {
+		remaining := eval.GetTimeRemaining(name, snapshot, *c.Config, now)
+		if remaining == math.MaxInt64 {
+			continue
+		}
+		sample(bw, "sessionwarden_time_remaining_seconds", userLabel(name), float64(remaining))
+	}
+
+	header(bw, "sessionwarden_active_sessions", "gauge", "Sessions currently open.")
+	for _, name := range users {
+		u := snapshot.Users[name]
+		sample(bw, "sessionwarden_active_sessions", userLabel(name), float64(len(u.GetActiveSessions())))
+	}
+
+	header(bw, "sessionwarden_paused", "gauge", "Whether the user's account is paused (1) or not (0).")
+	for _, name := range users {
+		paused := 0.0
+		if snapshot.Users[name].Paused {
+			paused = 1
+		}
+		sample(bw, "sessionwarden_paused", userLabel(name), paused)
+	}
+
+	header(bw, "sessionwarden_active_overrides", "gauge", "Overrides that have not yet expired.")
+	for _, name := range users {
+		active := 0
+		for _, o := range snapshot.Users[name].Overrides {
+			if o.IsActive(now) {
+				active++
+			}
+		}
+		sample(bw, "sessionwarden_active_overrides", userLabel(name), float64(active))
+	}
+
+	header(bw, "sessionwarden_denied_logins_today", "gauge", "Logins refused since midnight.")
+	for _, name := range users {
+		u := snapshot.Users[name]
+		sample(bw, "sessionwarden_denied_logins_today", userLabel(name), float64(len(u.GetHistory(session.HistoryLoginDenied, midnight))))
+	}
+
+	c.mu.Lock()
+	keys := make([]enforcement, 0, len(c.enforcements))
+	for k := range c.enforcements {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].user != keys[j].user {
+			return keys[i].user < keys[j].user
+		}
+		return keys[i].action < keys[j].action
+	})
+	header(bw, "sessionwarden_enforcements_total", "counter", "Sessions locked or terminated, and apps killed, since the daemon started.")
+	for _, k := range keys {
+		labels := fmt.Sprintf(`user="%s",action="%s"`, escapeLabel(k.user), escapeLabel(k.action))
+		sample(bw, "sessionwarden_enforcements_total", labels, float64(c.enforcements[k]))
+	}
+
+	header(bw, "sessionwarden_engine_check_duration_seconds", "summary", "Time taken by the engine's periodic session checks.")
+	sample(bw, "sessionwarden_engine_check_duration_seconds_sum", "", c.checkDuration.Seconds())
+	sample(bw, "sessionwarden_engine_check_duration_seconds_count", "", float64(c.checks))
+
+	if !c.lastCheck.IsZero() {
+		header(bw, "sessionwarden_engine_last_check_timestamp_seconds", "gauge", "Unix time the engine last completed a check.")
+		sample(bw, "sessionwarden_engine_last_check_timestamp_seconds", "", float64(c.lastCheck.UnixNano())/1e9)
+	}
+	c.mu.Unlock()
+
+	return bw.Flush()
+}
+
+// users returns every configured user and every user with state, sorted
+func (c *Collector) users(s state.State) []string {
+	seen := make(map[string]bool)
+	var users []string
+	for name := range c.Config.Users {
+		seen[name] = true
+		users = append(users, name)
+	}
+	for name := range s.Users {
+		if !seen[name] {
+			users = append(users, name)
+		}
+	}
+	sort.Strings(users)
+	return users
+}
+
+func header(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func sample(w io.Writer, name, labels string, value float64) {
+	if labels != "" {
+		name += "{" + labels + "}"
+	}
+	fmt.Fprintf(w, "%s %g\n", name, value)
+}
+
+func userLabel(username string) string {
+	return `user="` + escapeLabel(username) + `"`
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
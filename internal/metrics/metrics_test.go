@@ -0,0 +1,120 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SoarinFerret/SessionWarden/internal/config"
+	"github.com/SoarinFerret/SessionWarden/internal/session"
+	"github.com/SoarinFerret/SessionWarden/internal/state"
+)
+
+func testCollector(t *testing.T, now time.Time) *Collector {
+	session.SetClock(func() time.Time { return now })
+	t.Cleanup(func() { session.SetClock(nil) })
+
+	m, err := state.NewManager(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+
+	cfg, err := config.LoadConfigFromBytes([]byte(`
+[users.alice]
+enabled = true
+daily_limit = "2h"
+[users.bob]
+enabled = true
+`))
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	return NewCollector(m, &cfg)
+}
+
+func TestCollector_Write(t *testing.T) {
+	now := time.Date(2024, 6, 3, 12, 0, 0, 0, time.Local)
+	c := testCollector(t, now)
+
+	err := c.Manager.UpdateUser("alice", true, func(u *session.User) error {
+		u.AddSession(now.Add(-30*time.Minute), "1")
+		u.AddOverride(session.NewExtraTimeOverride("homework", 15, now.Add(time.Hour)))
+		u.AddHistory(session.HistoryEntry{Time: now.Add(-time.Hour), Kind: session.HistoryLoginDenied})
+		u.AddHistory(session.HistoryEntry{Time: now.Add(-24 * time.Hour), Kind: session.HistoryLoginDenied})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("UpdateUser failed: %v", err)
+	}
+	err = c.Manager.UpdateUser("carol", true, func(u *session.User) error {
+		u.Pause()
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("UpdateUser failed: %v", err)
+	}
+
+	c.ObserveCheck(250 * time.Millisecond)
+	c.ObserveCheck(250 * time.Millisecond)
+	c.ObserveEnforcement("alice", config.ActionLock)
+
+	var out strings.Builder
+	if err := c.Write(&out, now); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	got := out.String()
+
+	for _, want := range []string{
+		"# TYPE sessionwarden_time_used_seconds gauge\n",
+		`sessionwarden_time_used_seconds{user="alice"} 1800` + "\n",
+		`sessionwarden_time_used_seconds{user="bob"} 0` + "\n",
+		`sessionwarden_time_used_seconds{user="carol"} 0` + "\n",
+		// 2h limit plus 15 minutes extra, less 30 minutes used
+		`sessionwarden_time_remaining_seconds{user="alice"} 6300` + "\n",
+		`sessionwarden_active_sessions{user="alice"} 1` + "\n",
+		`sessionwarden_paused{user="alice"} 0` + "\n",
+		`sessionwarden_paused{user="carol"} 1` + "\n",
+		`sessionwarden_active_overrides{user="alice"} 1` + "\n",
+		`sessionwarden_denied_logins_today{user="alice"} 1` + "\n",
+		`sessionwarden_enforcements_total{user="alice",action="lock"} 1` + "\n",
+		"sessionwarden_engine_check_duration_seconds_sum 0.5\n",
+		"sessionwarden_engine_check_duration_seconds_count 2\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("metrics missing %q\n%s", want, got)
+		}
+	}
+
+	// bob and carol are unrestricted
+	if strings.Contains(got, `sessionwarden_time_remaining_seconds{user="bob"}`) {
+		t.Errorf("expected no remaining time for unrestricted user\n%s", got)
+	}
+}
+
+func TestCollector_ServeHTTP(t *testing.T) {
+	c := testCollector(t, time.Date(2024, 6, 3, 12, 0, 0, 0, time.Local))
+
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != ContentType {
+		t.Errorf("unexpected content type %q", ct)
+	}
+
+	rec = httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/metrics", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405 for POST, got %d", rec.Code)
+	}
+}
+
+func TestEscapeLabel(t *testing.T) {
+	if got := escapeLabel("a\"b\\c\nd"); got != `a\"b\\c\nd` {
+		t.Errorf("unexpected escaping: %s", got)
+	}
+}
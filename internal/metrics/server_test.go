@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestListen_RejectsNonLoopback(t *testing.T) {
+	for _, addr := range []string{"0.0.0.0:9100", ":9100", "192.168.1.10:9100", "example.com:9100", "unix:", "9100"} {
+		if l, err := Listen(addr); err == nil {
+			l.Close()
+			t.Errorf("expected %q to be refused", addr)
+		}
+	}
+}
+
+func TestListen_Loopback(t *testing.T) {
+	for _, addr := range []string{"127.0.0.1:0", "localhost:0"} {
+		l, err := Listen(addr)
+		if err != nil {
+			t.Errorf("Listen(%q) failed: %v", addr, err)
+			continue
+		}
+		l.Close()
+	}
+}
+
+func TestServe_UnixSocket(t *testing.T) {
+	c := testCollector(t, time.Date(2024, 6, 3, 12, 0, 0, 0, time.Local))
+	path := filepath.Join(t.TempDir(), "metrics.sock")
+
+	// A stale socket from a previous run is replaced
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := Listen("unix:" + path)
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- Serve(ctx, l, c, nil) }()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+	resp, err := client.Get("http://localhost/metrics")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || len(body) == 0 {
+		t.Errorf("unexpected response %d: %s", resp.StatusCode, body)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Serve returned %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package sdnotify
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// fakeSocket listens on a notify socket and points NOTIFY_SOCKET at it
+func fakeSocket(t *testing.T) *net.UnixConn {
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	t.Setenv("NOTIFY_SOCKET", path)
+	return conn
+}
+
+func receive(t *testing.T, conn *net.UnixConn) string {
+	buf := make([]byte, 256)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("no notification received: %v", err)
+	}
+	return string(buf[:n])
+}
+
+func TestNotify(t *testing.T) {
+	conn := fakeSocket(t)
+
+	sent, err := Notify(Ready)
+	if err != nil || !sent {
+		t.Fatalf("Notify() = %v, %v", sent, err)
+	}
+	if got := receive(t, conn); got != Ready {
+		t.Errorf("received %q, want %q", got, Ready)
+	}
+
+	if _, err := Status("checking sessions"); err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if got := receive(t, conn); got != "STATUS=checking sessions" {
+		t.Errorf("received %q", got)
+	}
+}
+
+func TestNotify_NoSocket(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	sent, err := Notify(Ready)
+	if sent || err != nil {
+		t.Errorf("Notify() without a socket = %v, %v; want false, nil", sent, err)
+	}
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	t.Setenv("WATCHDOG_USEC", "")
+	if d, err := WatchdogInterval(); d != 0 || err != nil {
+		t.Errorf("expected watchdog disabled, got %v, %v", d, err)
+	}
+
+	t.Setenv("WATCHDOG_USEC", "180000000")
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+	if d, err := WatchdogInterval(); d != 3*time.Minute || err != nil {
+		t.Errorf("WatchdogInterval() = %v, %v; want 3m", d, err)
+	}
+
+	// Meant for another process
+	t.Setenv("WATCHDOG_PID", "1")
+	if d, _ := WatchdogInterval(); d != 0 {
+		t.Errorf("expected watchdog for another pid to be ignored, got %v", d)
+	}
+}
@@ -0,0 +1,47 @@
+package session
+
+import "time"
+
+// AppUsage is the time a user has spent in each application today, in
+// seconds, keyed by the app's name in the config
+type AppUsage struct {
+	Day        time.Time        `json:"day"`
+	Seconds    map[string]int64 `json:"seconds,omitempty"`
+	LastRecord time.Time        `json:"last_record,omitempty"`
+}
+
+// Record counts the time since the last record toward each of apps, which
+// were found running at now. Nothing is counted for the first record, or
+// after a gap longer than maxGap (e.g. while the daemon was stopped), as
+// there's no telling how long the apps have been running. Usage resets at
+// midnight.
+func (a *AppUsage) Record(now time.Time, apps []string, maxGap time.Duration) {
+	if !isSameDay(a.Day, now) {
+		a.Day = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		a.Seconds = nil
+	}
+
+	elapsed := now.Sub(a.LastRecord)
+	if since := now.Sub(a.Day); elapsed > since {
+		elapsed = since // don't count yesterday's time
+	}
+	if elapsed > maxGap || elapsed < 0 {
+		elapsed = 0
+	}
+	a.LastRecord = now
+
+	for _, app := range apps {
+		if a.Seconds == nil {
+			a.Seconds = make(map[string]int64)
+		}
+		a.Seconds[app] += int64(elapsed.Seconds())
+	}
+}
+
+// Used returns the seconds spent in app on now's day
+func (a *AppUsage) Used(app string, now time.Time) int64 {
+	if a == nil || !isSameDay(a.Day, now) {
+		return 0
+	}
+	return a.Seconds[app]
+}
@@ -0,0 +1,42 @@
+package session
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAppUsage_Record(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2024, 6, 3, hour, minute, 0, 0, time.UTC)
+	}
+
+	var a AppUsage
+	a.Record(at(10, 0), []string{"minecraft"}, time.Minute) // the first record counts nothing
+	a.Record(at(10, 1), []string{"minecraft", "discord"}, time.Minute)
+	a.Record(at(10, 2), nil, time.Minute)
+	a.Record(at(10, 30), []string{"minecraft"}, time.Minute) // nor does a long gap
+	a.Record(at(10, 31), []string{"minecraft"}, time.Minute)
+
+	if got := a.Used("minecraft", at(10, 31)); got != 120 {
+		t.Errorf("expected 2m in minecraft, got %ds", got)
+	}
+	if got := a.Used("discord", at(10, 31)); got != 60 {
+		t.Errorf("expected 1m in discord, got %ds", got)
+	}
+
+	// Usage resets the next day, and yesterday's time doesn't carry over
+	a.Record(at(23, 59).Add(30*time.Second), []string{"minecraft"}, time.Minute)
+	next := at(0, 0).AddDate(0, 0, 1).Add(20 * time.Second)
+	if got := a.Used("minecraft", next); got != 0 {
+		t.Errorf("expected no usage the next day, got %ds", got)
+	}
+	a.Record(next, []string{"minecraft"}, time.Minute)
+	if got := a.Used("minecraft", next); got != 20 {
+		t.Errorf("expected 20s since midnight, got %ds", got)
+	}
+
+	var none *AppUsage
+	if none.Used("minecraft", next) != 0 {
+		t.Errorf("expected no usage without a record")
+	}
+}
@@ -0,0 +1,129 @@
+package session
+
+import "time"
+
+// TimeBank holds daily allowance a user didn't use, to spend on a later day.
+type TimeBank struct {
+	Deposits []BankDeposit `json:"deposits,omitempty"`
+	// Pending is the allowance left unused on PendingDay so far (negative
+	// if the bank was drawn on). It is settled once the day is over.
+	PendingDay time.Time `json:"pending_day,omitempty"`
+	Pending    int64     `json:"pending,omitempty"`
+}
+
+// BankDeposit is the unused allowance of one day, in seconds
+type BankDeposit struct {
+	Day       time.Time `json:"day"`
+	Seconds   int64     `json:"seconds"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"` // zero if it never expires
+}
+
+func (d BankDeposit) isExpired(now time.Time) bool {
+	return !d.ExpiresAt.IsZero() && now.After(d.ExpiresAt)
+}
+
+// Balance returns the seconds in the bank at now, not counting today's
+// pending allowance
+func (b *TimeBank) Balance(now time.Time) int64 {
+	var balance int64
+	for _, d := range b.Deposits {
+		if !d.isExpired(now) {
+			balance += d.Seconds
+		}
+	}
+	return balance
+}
+
+// HasPending reports whether seconds are already recorded as pending on
+// now's day
+func (b *TimeBank) HasPending(now time.Time, seconds int64) bool {
+	return isSameDay(b.PendingDay, now) && b.Pending == seconds
+}
+
+// SetPending records the allowance left unused (or drawn from the bank, if
+// negative) on now's day, first settling any previous day
+func (b *TimeBank) SetPending(now time.Time, seconds, max int64, expiry time.Duration) {
+	b.Settle(now, max, expiry)
+	b.PendingDay = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	b.Pending = seconds
+}
+
+// Settle deposits or withdraws the pending allowance of a day before now's,
+// and drops expired deposits. Deposits keep the balance at or below max
+// seconds, and expire expiry after the end of their day (never, if zero).
+func (b *TimeBank) Settle(now time.Time, max int64, expiry time.Duration) {
+	if !b.PendingDay.IsZero() && !isSameDay(b.PendingDay, now) {
+		if b.Pending > 0 {
+			var expiresAt time.Time
+			if expiry > 0 {
+				expiresAt = b.PendingDay.AddDate(0, 0, 1).Add(expiry)
+			}
+			b.deposit(BankDeposit{Day: b.PendingDay, Seconds: b.Pending, ExpiresAt: expiresAt}, max, now)
+		} else if b.Pending < 0 {
+			// The time was spent on that day, so it comes from the
+			// deposits valid then, including any that expired at its end
+			b.Withdraw(-b.Pending, b.PendingDay.AddDate(0, 0, 1).Add(-time.Nanosecond))
+		}
+		b.PendingDay = time.Time{}
+		b.Pending = 0
+	}
+
+	var kept []BankDeposit
+	for _, d := range b.Deposits {
+		if !d.isExpired(now) && d.Seconds > 0 {
+			kept = append(kept, d)
+		}
+	}
+	b.Deposits = kept
+}
+
+func (b *TimeBank) deposit(d BankDeposit, max int64, now time.Time) {
+	if room := max - b.Balance(now); d.Seconds > room {
+		d.Seconds = room
+	}
+	if d.Seconds > 0 {
+		b.Deposits = append(b.Deposits, d)
+	}
+}
+
+// Withdraw takes up to seconds from the bank, from the deposits that expire
+// first, and returns how much was taken
+func (b *TimeBank) Withdraw(seconds int64, now time.Time) int64 {
+	var taken int64
+	for seconds > taken {
+		i := b.nextToExpire(now)
+		if i < 0 {
+			break
+		}
+		amount := min(b.Deposits[i].Seconds, seconds-taken)
+		b.Deposits[i].Seconds -= amount
+		taken += amount
+	}
+	return taken
+}
+
+// nextToExpire returns the index of the unexpired, non-empty deposit that
+// expires first, or -1 if there is none
+func (b *TimeBank) nextToExpire(now time.Time) int {
+	next := -1
+	for i, d := range b.Deposits {
+		if d.isExpired(now) || d.Seconds <= 0 {
+			continue
+		}
+		if next < 0 || expiresBefore(d, b.Deposits[next]) {
+			next = i
+		}
+	}
+	return next
+}
+
+func expiresBefore(a, b BankDeposit) bool {
+	switch {
+	case a.ExpiresAt.IsZero():
+		return false
+	case b.ExpiresAt.IsZero():
+		return true
+	default:
+		return a.ExpiresAt.Before(b.ExpiresAt)
+	}
+}
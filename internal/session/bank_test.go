@@ -0,0 +1,75 @@
+package session
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimeBank_Settle(t *testing.T) {
+	day := func(d, hour int) time.Time {
+		return time.Date(2024, 6, d, hour, 0, 0, 0, time.UTC)
+	}
+	const max = 2 * 3600
+	expiry := 2 * 24 * time.Hour
+
+	b := &TimeBank{}
+	b.SetPending(day(3, 10), 1800, max, expiry)
+	b.SetPending(day(3, 20), 3600, max, expiry) // later the same day replaces it
+	if b.Balance(day(3, 20)) != 0 {
+		t.Errorf("pending time shouldn't count until the day is over")
+	}
+
+	// The next day settles the 3rd
+	b.SetPending(day(4, 10), 5400, max, expiry)
+	if got := b.Balance(day(4, 10)); got != 3600 {
+		t.Errorf("expected 3600s banked, got %d", got)
+	}
+	if !b.HasPending(day(4, 12), 5400) || b.HasPending(day(5, 12), 5400) {
+		t.Errorf("HasPending should match only the pending day and amount")
+	}
+
+	// Deposits are capped at max
+	b.Settle(day(5, 0), max, expiry)
+	if got := b.Balance(day(5, 0)); got != max {
+		t.Errorf("expected the balance capped at %d, got %d", max, got)
+	}
+
+	// Withdrawals take from the deposit expiring first
+	if got := b.Withdraw(1800, day(5, 0)); got != 1800 {
+		t.Errorf("expected to withdraw 1800s, got %d", got)
+	}
+	if b.Deposits[0].Seconds != 1800 || b.Deposits[1].Seconds != 3600 {
+		t.Errorf("unexpected deposits after withdrawal: %+v", b.Deposits)
+	}
+
+	// The 3rd's deposit expires two days after the day ends
+	if got := b.Balance(day(6, 1)); got != 3600 {
+		t.Errorf("expected the first deposit to have expired, got %d", got)
+	}
+
+	// Overdrawn days are withdrawn when settled, as far as the bank goes
+	b.SetPending(day(6, 1), -7200, max, expiry)
+	b.Settle(day(7, 0), max, expiry)
+	if got := b.Balance(day(7, 0)); got != 0 || len(b.Deposits) != 0 {
+		t.Errorf("expected an empty bank, got %d in %+v", got, b.Deposits)
+	}
+}
+
+func TestTimeBank_SettleDrawsOnDepositsExpiringThatNight(t *testing.T) {
+	day := func(d, hour int) time.Time {
+		return time.Date(2024, 6, d, hour, 0, 0, 0, time.UTC)
+	}
+	const max = 4 * 3600
+	b := &TimeBank{Deposits: []BankDeposit{
+		{Day: day(1, 0), Seconds: 1800, ExpiresAt: day(4, 0)}, // expires at the end of the 3rd
+		{Day: day(2, 0), Seconds: 3600, ExpiresAt: day(5, 0)},
+	}}
+
+	// Time spent on the 3rd comes from the deposit expiring that night
+	// first, even though it is settled on the 4th
+	b.SetPending(day(3, 20), -2400, max, 0)
+	b.Settle(day(4, 10), max, 0)
+	if got := b.Balance(day(4, 10)); got != 3000 {
+		t.Errorf("expected 3000s left, got %d in %+v", got, b.Deposits)
+	}
+}
@@ -0,0 +1,43 @@
+package session
+
+import (
+	"sort"
+	"time"
+)
+
+// ContinuousUse returns the start and end of the user's latest stretch of
+// activity, counting the segments of all their sessions. Gaps shorter than
+// minBreak don't end a stretch, and a stretch with an active segment ends at
+// now. ok is false if the latest stretch ended at least minBreak before now,
+// i.e. the user has had their break since.
+func (u *User) ContinuousUse(now time.Time, minBreak time.Duration) (start, end time.Time, ok bool) {
+	var segments []SegmentRecord
+	for _, s := range u.Sessions {
+		for _, seg := range s.Segments {
+			if seg.StartTime.After(now) {
+				continue
+			}
+			if seg.EndTime.IsZero() || seg.EndTime.After(now) {
+				seg.EndTime = now
+			}
+			segments = append(segments, seg)
+		}
+	}
+	if len(segments) == 0 {
+		return start, end, false
+	}
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].StartTime.Before(segments[j].StartTime)
+	})
+
+	start, end = segments[0].StartTime, segments[0].EndTime
+	for _, seg := range segments[1:] {
+		if seg.StartTime.Sub(end) >= minBreak {
+			start = seg.StartTime
+		}
+		if seg.EndTime.After(end) {
+			end = seg.EndTime
+		}
+	}
+	return start, end, now.Sub(end) < minBreak
+}
@@ -0,0 +1,42 @@
+package session
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUser_ContinuousUse(t *testing.T) {
+	now := time.Date(2024, 6, 3, 12, 0, 0, 0, time.UTC)
+	SetClock(func() time.Time { return now })
+	defer SetClock(nil)
+	at := func(minutes int) time.Time { return now.Add(time.Duration(minutes) * time.Minute) }
+
+	u := User{}
+	// An hour ending 30 minutes ago, then a 5 minute gap in another
+	// session, then activity until now
+	u.AddSession(at(-120), "sess1")
+	u.EndSession(at(-60), "sess1")
+	u.AddSession(at(-50), "sess2")
+	u.EndSession(at(-25), "sess2")
+	u.AddSession(at(-20), "sess3")
+
+	start, end, ok := u.ContinuousUse(now, 10*time.Minute)
+	if !ok || !start.Equal(at(-50)) || !end.Equal(now) {
+		t.Errorf("ContinuousUse() = %v, %v, %v, want the stretch since -50m", start, end, ok)
+	}
+
+	// A short gap doesn't count as a break if the minimum is longer
+	start, _, _ = u.ContinuousUse(now, 15*time.Minute)
+	if !start.Equal(at(-120)) {
+		t.Errorf("expected a 10 minute gap not to break a stretch with a 15 minute minimum, got start %v", start)
+	}
+
+	// Once the latest stretch is over for long enough, there is none
+	u.EndSession(now, "sess3")
+	if _, _, ok := u.ContinuousUse(at(10), 10*time.Minute); ok {
+		t.Errorf("expected no stretch after a full break")
+	}
+	if _, end, ok := u.ContinuousUse(at(5), 10*time.Minute); !ok || !end.Equal(now) {
+		t.Errorf("expected the stretch to end at now during the break, got %v, %v", end, ok)
+	}
+}
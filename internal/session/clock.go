@@ -0,0 +1,20 @@
+package session
+
+import "time"
+
+// clock is the time source for open segments and "today" lookups. It can be
+// replaced to replay recorded events against a simulated clock.
+var clock = time.Now
+
+// Now returns the current time according to the package clock.
+func Now() time.Time {
+	return clock()
+}
+
+// SetClock replaces the package clock. Passing nil restores time.Now.
+func SetClock(fn func() time.Time) {
+	if fn == nil {
+		fn = time.Now
+	}
+	clock = fn
+}
@@ -0,0 +1,79 @@
+package session
+
+import "time"
+
+// HistoryRetention is how long history entries are kept
+const HistoryRetention = 30 * 24 * time.Hour
+
+func (u *User) AddHistory(entry HistoryEntry) {
+	if entry.Time.IsZero() {
+		entry.Time = Now()
+	}
+	u.History = append(u.History, entry)
+}
+
+// GetHistory returns entries of the given kind at or after since
+func (u *User) GetHistory(kind string, since time.Time) []HistoryEntry {
+	var entries []HistoryEntry
+	for _, entry := range u.History {
+		if entry.Kind == kind && !entry.Time.Before(since) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// PruneHistory removes entries older than HistoryRetention
+func (u *User) PruneHistory(now time.Time) {
+	cutoff := now.Add(-HistoryRetention)
+	var kept []HistoryEntry
+	for _, entry := range u.History {
+		if !entry.Time.Before(cutoff) {
+			kept = append(kept, entry)
+		}
+	}
+	u.History = kept
+}
+
+// LedgerEntries returns the ledger entries that apply at now: those recorded
+// earlier today, and week-scoped ones recorded earlier this week (weeks
+// start on Monday)
+func (u *User) LedgerEntries(now time.Time) []HistoryEntry {
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	var entries []HistoryEntry
+	for _, entry := range u.GetHistory(HistoryLedger, startOfWeek(now)) {
+		if entry.Time.After(now) {
+			continue
+		}
+		if entry.Scope == LedgerWeek || !entry.Time.Before(midnight) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// LedgerMinutes returns the total adjustment of the day-scoped ledger
+// entries that apply at now
+func (u *User) LedgerMinutes(now time.Time) int {
+	var minutes int
+	for _, entry := range u.LedgerEntries(now) {
+		if entry.Scope != LedgerWeek {
+			minutes += entry.Minutes
+		}
+	}
+	return minutes
+}
+
+// LedgerWeekSeconds returns what is left at now of this week's week-scoped
+// ledger entries: their total, less what was spent of them on earlier days.
+// It is negative if penalties outweigh the rewards left.
+func (u *User) LedgerWeekSeconds(now time.Time) int64 {
+	var seconds int64
+	for _, entry := range u.LedgerEntries(now) {
+		if entry.Scope == LedgerWeek {
+			seconds += int64(entry.Minutes) * 60
+		}
+	}
+	return seconds - u.LedgerUse.SpentBefore(now)
+}
@@ -0,0 +1,99 @@
+package session
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUser_History(t *testing.T) {
+	now := time.Date(2024, 6, 3, 12, 0, 0, 0, time.UTC)
+	u := User{}
+	u.AddHistory(HistoryEntry{Time: now.Add(-40 * 24 * time.Hour), Kind: HistoryLoginDenied, Reason: "paused"})
+	u.AddHistory(HistoryEntry{Time: now.Add(-2 * time.Hour), Kind: HistoryLoginDenied, Reason: "outside_hours"})
+	u.AddHistory(HistoryEntry{Time: now.Add(-1 * time.Hour), Kind: "other"})
+
+	denied := u.GetHistory(HistoryLoginDenied, now.Add(-24*time.Hour))
+	if len(denied) != 1 || denied[0].Reason != "outside_hours" {
+		t.Errorf("GetHistory() = %+v, want only the recent denial", denied)
+	}
+
+	u.PruneHistory(now)
+	if len(u.History) != 2 {
+		t.Errorf("expected 2 entries after pruning, got %d", len(u.History))
+	}
+	for _, entry := range u.History {
+		if entry.Reason == "paused" {
+			t.Errorf("entry older than retention was not pruned")
+		}
+	}
+}
+
+func TestUser_AddHistoryDefaultsTime(t *testing.T) {
+	now := time.Date(2024, 6, 3, 12, 0, 0, 0, time.UTC)
+	SetClock(func() time.Time { return now })
+	defer SetClock(nil)
+
+	u := User{}
+	u.AddHistory(HistoryEntry{Kind: HistoryLoginDenied})
+	if !u.History[0].Time.Equal(now) {
+		t.Errorf("expected entry time to default to now, got %v", u.History[0].Time)
+	}
+}
+
+func TestUser_LedgerEntries(t *testing.T) {
+	now := time.Date(2024, 6, 5, 12, 0, 0, 0, time.UTC) // a Wednesday
+	u := User{}
+	ledger := func(at time.Time, minutes int, scope string) {
+		u.AddHistory(HistoryEntry{Time: at, Kind: HistoryLedger, Minutes: minutes, Scope: scope})
+	}
+	ledger(now.Add(-2*time.Hour), 30, LedgerDay)   // today
+	ledger(now.AddDate(0, 0, -1), 60, LedgerDay)   // yesterday
+	ledger(now.AddDate(0, 0, -2), -20, LedgerWeek) // Monday, this week
+	ledger(now.AddDate(0, 0, -3), -45, LedgerWeek) // Sunday, last week
+	u.AddHistory(HistoryEntry{Time: now, Kind: HistoryLoginDenied})
+
+	entries := u.LedgerEntries(now)
+	if len(entries) != 2 {
+		t.Fatalf("expected today's entry and this week's, got %+v", entries)
+	}
+	if got := u.LedgerMinutes(now); got != 30 {
+		t.Errorf("expected +30 minutes today, got %d", got)
+	}
+	if got := u.LedgerWeekSeconds(now); got != -20*60 {
+		t.Errorf("expected -20 minutes for the week, got %ds", got)
+	}
+
+	// Next Monday, nothing applies any more
+	next := now.AddDate(0, 0, 5)
+	if got := u.LedgerMinutes(next); got != 0 || u.LedgerWeekSeconds(next) != 0 {
+		t.Errorf("expected no adjustment the next week, got %d", got)
+	}
+}
+
+func TestUser_LedgerWeekCountsOnce(t *testing.T) {
+	monday := time.Date(2024, 6, 3, 9, 0, 0, 0, time.UTC)
+	u := User{LedgerUse: &LedgerUse{}}
+	u.AddHistory(HistoryEntry{Time: monday, Kind: HistoryLedger, Minutes: 30, Scope: LedgerWeek})
+
+	// 10 of the 30 minutes are spent on Monday, and the rest is left for
+	// the following days
+	u.LedgerUse.SetPending(monday.Add(8*time.Hour), 600)
+	if got := u.LedgerWeekSeconds(monday.Add(8 * time.Hour)); got != 1800 {
+		t.Errorf("expected today's spending not to count yet, got %ds", got)
+	}
+	tuesday := monday.AddDate(0, 0, 1)
+	if got := u.LedgerWeekSeconds(tuesday); got != 1200 {
+		t.Errorf("expected 20m left on Tuesday, got %ds", got)
+	}
+
+	// Settling Tuesday keeps Monday's spending
+	u.LedgerUse.SetPending(tuesday, 1200)
+	if got := u.LedgerWeekSeconds(tuesday.AddDate(0, 0, 1)); got != 0 {
+		t.Errorf("expected the reward to be used up on Wednesday, got %ds", got)
+	}
+
+	// A new week starts over
+	if got := u.LedgerUse.SpentBefore(monday.AddDate(0, 0, 7)); got != 0 {
+		t.Errorf("expected nothing spent in a new week, got %ds", got)
+	}
+}
@@ -0,0 +1,52 @@
+package session
+
+import "time"
+
+// LedgerUse tracks how much of the week-scoped ledger entries a user has
+// spent, so each counts once across the week rather than on every day.
+// Like the time bank, the current day is kept as pending and settled into
+// Spent once it is over.
+type LedgerUse struct {
+	Week       time.Time `json:"week"`            // Monday of the week Spent belongs to
+	Spent      int64     `json:"spent,omitempty"` // seconds spent on settled days of Week
+	PendingDay time.Time `json:"pending_day,omitempty"`
+	Pending    int64     `json:"pending,omitempty"` // seconds spent on PendingDay so far
+}
+
+// HasPending reports whether seconds are already recorded as spent on
+// now's day
+func (l *LedgerUse) HasPending(now time.Time, seconds int64) bool {
+	return l != nil && isSameDay(l.PendingDay, now) && l.Pending == seconds
+}
+
+// SetPending records the seconds of the week's entries spent so far on
+// now's day (negative for penalties taken), first settling any earlier day
+func (l *LedgerUse) SetPending(now time.Time, seconds int64) {
+	l.Spent = l.SpentBefore(now)
+	l.Week = startOfWeek(now)
+	l.PendingDay = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	l.Pending = seconds
+}
+
+// SpentBefore returns the seconds of the entries of now's week spent on
+// the days before now's
+func (l *LedgerUse) SpentBefore(now time.Time) int64 {
+	if l == nil {
+		return 0
+	}
+	week := startOfWeek(now)
+	var spent int64
+	if l.Week.Equal(week) {
+		spent = l.Spent
+	}
+	if !l.PendingDay.IsZero() && !isSameDay(l.PendingDay, now) && startOfWeek(l.PendingDay).Equal(week) {
+		spent += l.Pending
+	}
+	return spent
+}
+
+// startOfWeek returns midnight on the Monday of t's week
+func startOfWeek(t time.Time) time.Time {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	return midnight.AddDate(0, 0, -(int(t.Weekday())+6)%7)
+}
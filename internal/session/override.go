@@ -1,16 +1,28 @@
 package session
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/SoarinFerret/SessionWarden/internal/config"
 )
 
+// NewOverrideID returns a random ID for an override, short enough to type
+func NewOverrideID() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		panic(err) // crypto/rand doesn't fail on Linux
+	}
+	return hex.EncodeToString(b)
+}
+
 func NewExtraTimeOverride(reason string, extraMinutes int, expiresAt time.Time) Override {
 	if expiresAt.IsZero() {
 		// expire at eod today
-		expiresAt = time.Now().Truncate(24 * time.Hour).Add(24*time.Hour - time.Nanosecond)
+		expiresAt = Now().Truncate(24 * time.Hour).Add(24*time.Hour - time.Nanosecond)
 	}
 	return Override{
 		Reason:    reason,
@@ -22,7 +34,7 @@ func NewExtraTimeOverride(reason string, extraMinutes int, expiresAt time.Time)
 func NewAllowedHoursOverride(reason string, allowedHours config.TimeRange, expiresAt time.Time) Override {
 	if expiresAt.IsZero() {
 		// expire at eod today
-		expiresAt = time.Now().Truncate(24 * time.Hour).Add(24*time.Hour - time.Nanosecond)
+		expiresAt = Now().Truncate(24 * time.Hour).Add(24*time.Hour - time.Nanosecond)
 	}
 	return Override{
 		Reason:       reason,
@@ -31,17 +43,100 @@ func NewAllowedHoursOverride(reason string, allowedHours config.TimeRange, expir
 	}
 }
 
+// Validate checks that the override changes something and that its fields
+// are consistent
+func (o Override) Validate() error {
+	if o.ExtraTime == 0 && o.DailyLimit == 0 && !o.Block && o.AllowedHours.IsEmpty() {
+		return fmt.Errorf("override must change the extra time, daily limit, allowed hours or block the user")
+	}
+	if o.DailyLimit < 0 {
+		return fmt.Errorf("daily limit cannot be negative")
+	}
+	if !o.StartsAt.IsZero() && !o.ExpiresAt.After(o.StartsAt) {
+		return fmt.Errorf("override must expire after it starts")
+	}
+	return nil
+}
+
 func (o Override) IsExpired(now time.Time) bool {
 	if now.IsZero() {
-		now = time.Now()
+		now = Now()
 	}
 	return now.After(o.ExpiresAt)
 }
 
+// IsActive reports whether the override is in effect at now: it has
+// started, hasn't expired, and now falls on one of its repeat days
+func (o Override) IsActive(now time.Time) bool {
+	if now.IsZero() {
+		now = Now()
+	}
+	if !o.StartsAt.IsZero() && now.Before(o.StartsAt) {
+		return false
+	}
+	return !o.IsExpired(now) && o.RepeatsOn(now)
+}
+
+// RepeatsOn reports whether t falls on one of the override's repeat days.
+// Overrides without repeat days apply every day.
+func (o Override) RepeatsOn(t time.Time) bool {
+	if len(o.Repeat) == 0 {
+		return true
+	}
+	for _, day := range o.Repeat {
+		if strings.EqualFold(day, t.Weekday().String()) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseRepeat parses a comma-separated list of weekdays, by full name or
+// three-letter abbreviation, or one of "daily", "weekdays" or "weekends".
+// It returns the full weekday names in week order, or nil for "daily".
+func ParseRepeat(s string) ([]string, error) {
+	var days [7]bool
+	for _, field := range strings.Split(s, ",") {
+		field = strings.ToLower(strings.TrimSpace(field))
+		switch field {
+		case "daily":
+			days = [7]bool{true, true, true, true, true, true, true}
+		case "weekdays":
+			for d := time.Monday; d <= time.Friday; d++ {
+				days[d] = true
+			}
+		case "weekends":
+			days[time.Saturday], days[time.Sunday] = true, true
+		default:
+			found := false
+			for d := time.Sunday; d <= time.Saturday; d++ {
+				name := strings.ToLower(d.String())
+				if field == name || field == name[:3] {
+					days[d], found = true, true
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("invalid repeat day %q", field)
+			}
+		}
+	}
+
+	var repeat []string
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if days[d] {
+			repeat = append(repeat, d.String())
+		}
+	}
+	if len(repeat) == 7 {
+		return nil, nil
+	}
+	return repeat, nil
+}
+
 // Eval
 func (o Override) EvalAllowedHours(now time.Time) (bool, error) {
 	if now.IsZero() {
-		now = time.Now()
+		now = Now()
 	}
 
 	if o.AllowedHours.IsEmpty() {
@@ -1,10 +1,8 @@
 package session
 
-import "time"
-
 func (s *SegmentRecord) Duration() int64 {
 	if s.EndTime.IsZero() {
-		return time.Now().Unix() - s.StartTime.Unix()
+		return Now().Unix() - s.StartTime.Unix()
 	}
 	return s.EndTime.Unix() - s.StartTime.Unix()
 }
@@ -7,7 +7,7 @@ import (
 
 func (s *SessionRecord) Start(start time.Time) {
 	if start.IsZero() {
-		start = time.Now()
+		start = Now()
 	}
 	s.StartTime = start
 	// Initialize the first segment
@@ -16,7 +16,7 @@ func (s *SessionRecord) Start(start time.Time) {
 
 func (s *SessionRecord) End(end time.Time) {
 	if end.IsZero() {
-		end = time.Now()
+		end = Now()
 	}
 	s.EndTime = end
 	// End the last segment
@@ -47,7 +47,7 @@ func (s *SessionRecord) AddSegment(start time.Time) error {
 	}
 
 	if start.IsZero() {
-		start = time.Now()
+		start = Now()
 	}
 	segment := SegmentRecord{
 		StartTime: start,
@@ -58,7 +58,7 @@ func (s *SessionRecord) AddSegment(start time.Time) error {
 
 func (s *SessionRecord) EndSegment(end time.Time, reason string) {
 	if end.IsZero() {
-		end = time.Now()
+		end = Now()
 	}
 	if len(s.Segments) == 0 {
 		return
@@ -8,15 +8,55 @@ import (
 
 type User struct {
 	Sessions  []SessionRecord `json:"sessions"`
-	Overrides []Override      `json:"exceptions"`
+	Overrides []Override      `json:"overrides"`
 	Paused    bool            `json:"paused"`
+	History   []HistoryEntry  `json:"history,omitempty"`
+	Bank      *TimeBank       `json:"bank,omitempty"`
+	Apps      *AppUsage       `json:"apps,omitempty"`
+	LedgerUse *LedgerUse      `json:"ledger_use,omitempty"`
 }
 
-// Exception represents a temporary rule override for a user.
+// History entry kinds
+const (
+	HistoryLoginDenied = "login_denied"
+	HistoryLedger      = "ledger"     // a reward or penalty adjusting the daily limit
+	HistoryAppKilled   = "app_killed" // a blocked or over-budget app's process was killed
+)
+
+// Ledger entry scopes
+const (
+	LedgerDay  = "day"  // applies on the day it was recorded
+	LedgerWeek = "week" // counts once toward the rest of the week, wherever it is spent
+)
+
+// HistoryEntry records a policy decision worth keeping after the sessions
+// it relates to are cleaned up, such as a refused login.
+type HistoryEntry struct {
+	Time    time.Time `json:"time"`
+	Kind    string    `json:"kind"`
+	Reason  string    `json:"reason,omitempty"`
+	Service string    `json:"service,omitempty"` // PAM service, e.g. sshd or gdm-password
+	Phase   string    `json:"phase,omitempty"`   // PAM phase, e.g. authentication
+	Detail  string    `json:"detail,omitempty"`
+	Minutes int       `json:"minutes,omitempty"` // ledger adjustment, negative for penalties
+	Scope   string    `json:"scope,omitempty"`   // ledger scope, LedgerDay or LedgerWeek
+	By      string    `json:"by,omitempty"`      // user who recorded it, if known
+	App     string    `json:"app,omitempty"`     // app as named in the config, for app kills
+}
+
+// Override represents a temporary rule override for a user. It may change
+// several parts of the policy at once.
 type Override struct {
+	ID           string           `json:"id"`
+	CreatedAt    time.Time        `json:"created_at,omitempty"`
+	CreatedBy    string           `json:"created_by,omitempty"` // user who granted it, if known
 	Reason       string           `json:"reason,omitempty"`
-	ExtraTime    int              `json:"extra_hours,omitempty"`
+	ExtraTime    int              `json:"extra_minutes,omitempty"`       // added to the daily limit; negative to take time away
+	DailyLimit   int              `json:"daily_limit_minutes,omitempty"` // replaces the configured daily limit, if set
+	Block        bool             `json:"block,omitempty"`               // deny logins entirely
 	AllowedHours config.TimeRange `json:"allowed_hours,omitempty"`
+	StartsAt     time.Time        `json:"starts_at,omitempty"` // not in effect before this, if set
+	Repeat       []string         `json:"repeat,omitempty"`    // weekdays it applies on, or every day if empty
 	ExpiresAt    time.Time        `json:"expires_at"`
 }
 
@@ -27,10 +67,18 @@ type SegmentRecord struct {
 	Reason    string    `json:"reason,omitempty"`
 }
 
+// SessionInfo describes how a session was started, as reported by logind.
+type SessionInfo struct {
+	Type    string `json:"type,omitempty"`    // x11, wayland, tty, mir or unspecified
+	Remote  bool   `json:"remote,omitempty"`  // true for SSH and other remote logins
+	Service string `json:"service,omitempty"` // PAM service, e.g. sshd or gdm-password
+}
+
 // SessionRecord tracks a user's daily session usage.
 type SessionRecord struct {
 	StartTime time.Time       `json:"start"`
 	EndTime   time.Time       `json:"end"`
 	SessionId string          `json:"session_id,omitempty"`
 	Segments  []SegmentRecord `json:"segments,omitempty"`
+	SessionInfo
 }
@@ -6,10 +6,16 @@ import (
 )
 
 func (u *User) AddSession(start time.Time, sessionID string) {
+	u.AddSessionWithInfo(start, sessionID, SessionInfo{})
+}
+
+// AddSessionWithInfo starts a new session, recording how it was started
+func (u *User) AddSessionWithInfo(start time.Time, sessionID string, info SessionInfo) {
 	newSession := SessionRecord{
-		SessionId: sessionID,
-		StartTime: time.Time{},
-		Segments:  []SegmentRecord{},
+		SessionId:   sessionID,
+		StartTime:   time.Time{},
+		Segments:    []SegmentRecord{},
+		SessionInfo: info,
 	}
 	newSession.Start(start)
 
@@ -27,7 +33,7 @@ func (u *User) EndSession(end time.Time, sessionID string) error {
 }
 
 func (u *User) EndAllSegments(reason string) {
-	now := time.Now()
+	now := Now()
 	for i := range u.Sessions {
 		if u.Sessions[i].IsActive() {
 			u.Sessions[i].EndSegment(now, reason)
@@ -36,7 +42,7 @@ func (u *User) EndAllSegments(reason string) {
 }
 
 func (u *User) StartNewSegments() {
-	now := time.Now()
+	now := Now()
 	for i := range u.Sessions {
 		if u.Sessions[i].IsActive() && u.Sessions[i].IsIdle() {
 			u.Sessions[i].AddSegment(now)
@@ -53,6 +59,17 @@ func (u *User) GetActiveSession() *SessionRecord {
 	return nil
 }
 
+// GetActiveSessions returns all sessions that have not ended
+func (u *User) GetActiveSessions() []*SessionRecord {
+	var active []*SessionRecord
+	for i := range u.Sessions {
+		if u.Sessions[i].IsActive() {
+			active = append(active, &u.Sessions[i])
+		}
+	}
+	return active
+}
+
 // GetSessionByID returns the session with the given ID. logind reuses
 // session IDs across reboots, so multiple records can share an ID:
 // prefer the active one, otherwise return the most recent match.
@@ -85,6 +102,47 @@ func (u *User) IsSessionActive(sessionID string) bool {
 	return false
 }
 
+// Clone returns a deep copy of the user, so it can be read or changed
+// without affecting the original
+func (u User) Clone() User {
+	clone := u
+	if u.Sessions != nil {
+		clone.Sessions = make([]SessionRecord, len(u.Sessions))
+		for i, s := range u.Sessions {
+			s.Segments = append([]SegmentRecord(nil), s.Segments...)
+			clone.Sessions[i] = s
+		}
+	}
+	if u.Overrides != nil {
+		clone.Overrides = make([]Override, len(u.Overrides))
+		for i, o := range u.Overrides {
+			o.Repeat = append([]string(nil), o.Repeat...)
+			clone.Overrides[i] = o
+		}
+	}
+	if u.History != nil {
+		clone.History = append([]HistoryEntry{}, u.History...)
+	}
+	if u.Bank != nil {
+		bank := *u.Bank
+		bank.Deposits = append([]BankDeposit(nil), u.Bank.Deposits...)
+		clone.Bank = &bank
+	}
+	if u.LedgerUse != nil {
+		use := *u.LedgerUse
+		clone.LedgerUse = &use
+	}
+	if u.Apps != nil {
+		apps := *u.Apps
+		apps.Seconds = make(map[string]int64, len(u.Apps.Seconds))
+		for app, seconds := range u.Apps.Seconds {
+			apps.Seconds[app] = seconds
+		}
+		clone.Apps = &apps
+	}
+	return clone
+}
+
 func (u *User) Pause() {
 	u.Paused = true
 }
@@ -107,17 +165,27 @@ func (u *User) GetSessionsForDay(day time.Time) []SessionRecord {
 
 // GetTimeUsed returns the total time used for sessions that started today
 func (u *User) GetTimeUsed() int64 {
-	return u.GetTimeUsedForDay(time.Now())
+	return u.GetTimeUsedForDay(Now())
 }
 
 // GetTimeUsedForDay returns the total time used for sessions that started on the given day
 func (u *User) GetTimeUsedForDay(day time.Time) int64 {
+	return u.GetTimeUsedForDayFiltered(day, nil)
+}
+
+// GetTimeUsedForDayFiltered is like GetTimeUsedForDay but only counts sessions
+// for which counts returns true. A nil counts function counts every session.
+func (u *User) GetTimeUsedForDayFiltered(day time.Time, counts func(SessionRecord) bool) int64 {
 	var totalDuration int64
 	for _, session := range u.Sessions {
 		// Only count sessions from the specified day
-		if isSameDay(session.StartTime, day) {
-			totalDuration += session.Duration()
+		if !isSameDay(session.StartTime, day) {
+			continue
+		}
+		if counts != nil && !counts(session) {
+			continue
 		}
+		totalDuration += session.Duration()
 	}
 	return totalDuration
 }
@@ -139,10 +207,21 @@ func (u *User) AllowedHoursOverrideIsSet() bool {
 	return false
 }
 
+// AllowedHoursOverrideIsActive reports whether an AllowedHours override is
+// in effect at now
+func (u *User) AllowedHoursOverrideIsActive(now time.Time) bool {
+	for _, override := range u.Overrides {
+		if !override.AllowedHours.IsEmpty() && override.IsActive(now) {
+			return true
+		}
+	}
+	return false
+}
+
 func (u *User) AllowedHoursOverrideWithinRange(now time.Time) bool {
 	// evaluate all overrides for AllowedHours
 	for _, override := range u.Overrides {
-		if override.IsExpired(now) {
+		if !override.IsActive(now) {
 			continue
 		}
 		allow, err := override.EvalAllowedHours(now)
@@ -156,10 +235,39 @@ func (u *User) AllowedHoursOverrideWithinRange(now time.Time) bool {
 	return true
 }
 
+// AddOverride adds o, giving it an ID and creation time if it doesn't have
+// them yet
 func (u *User) AddOverride(o Override) {
+	if o.ID == "" {
+		o.ID = NewOverrideID()
+	}
+	if o.CreatedAt.IsZero() {
+		o.CreatedAt = Now()
+	}
 	u.Overrides = append(u.Overrides, o)
 }
 
+// GetOverride returns the override with the given ID
+func (u *User) GetOverride(id string) (*Override, error) {
+	for i := range u.Overrides {
+		if u.Overrides[i].ID == id {
+			return &u.Overrides[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no override with ID %s", id)
+}
+
+// RemoveOverride removes the override with the given ID
+func (u *User) RemoveOverride(id string) error {
+	for i := range u.Overrides {
+		if u.Overrides[i].ID == id {
+			u.Overrides = append(u.Overrides[:i], u.Overrides[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("no override with ID %s", id)
+}
+
 // RemoveOldSessions removes all sessions that did not start today
 func (u *User) RemoveOldSessions(now time.Time) {
 	var currentSessions []SessionRecord
@@ -2,6 +2,7 @@ package session
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -328,3 +329,149 @@ func TestUser_GetSessionsForDay(t *testing.T) {
 		t.Errorf("Expected 1 session for today, got %d", len(todaySessions))
 	}
 }
+
+func TestUser_CloneIsDeep(t *testing.T) {
+	now := time.Now()
+	u := User{}
+	u.AddSession(now, "s1")
+	u.AddOverride(Override{Reason: "original", ExpiresAt: now.Add(time.Hour)})
+	u.AddHistory(HistoryEntry{Time: now, Kind: HistoryLoginDenied})
+
+	clone := u.Clone()
+	clone.Sessions[0].Segments[0].Reason = "changed"
+	clone.Overrides[0].Reason = "changed"
+	clone.History[0].Reason = "changed"
+
+	if u.Sessions[0].Segments[0].Reason == "changed" {
+		t.Errorf("clone shares segments with the original")
+	}
+	if u.Overrides[0].Reason != "original" {
+		t.Errorf("clone shares overrides with the original")
+	}
+	if u.History[0].Reason == "changed" {
+		t.Errorf("clone shares history with the original")
+	}
+}
+
+func TestUser_OverrideIDs(t *testing.T) {
+	now := time.Date(2024, 6, 3, 12, 0, 0, 0, time.UTC)
+	SetClock(func() time.Time { return now })
+	defer SetClock(nil)
+
+	u := &User{}
+	u.AddOverride(NewExtraTimeOverride("homework", 30, now.Add(time.Hour)))
+	u.AddOverride(Override{ID: "fixed", Reason: "chores", ExpiresAt: now.Add(time.Hour)})
+
+	first := u.Overrides[0]
+	if len(first.ID) != 8 || first.ID == "fixed" {
+		t.Errorf("expected a generated 8 character ID, got %q", first.ID)
+	}
+	if !first.CreatedAt.Equal(now) {
+		t.Errorf("CreatedAt = %v, want %v", first.CreatedAt, now)
+	}
+
+	o, err := u.GetOverride("fixed")
+	if err != nil || o.Reason != "chores" {
+		t.Fatalf("GetOverride(fixed) = %+v, %v", o, err)
+	}
+	o.ExtraTime = 15
+	if u.Overrides[1].ExtraTime != 15 {
+		t.Errorf("GetOverride should return a pointer into the list")
+	}
+
+	// IDs stay valid when other overrides are removed
+	if err := u.RemoveOverride(first.ID); err != nil {
+		t.Fatalf("RemoveOverride failed: %v", err)
+	}
+	if _, err := u.GetOverride("fixed"); err != nil {
+		t.Errorf("remaining override lost its ID: %v", err)
+	}
+	if err := u.RemoveOverride(first.ID); err == nil {
+		t.Errorf("expected an error removing an override twice")
+	}
+}
+
+func TestOverride_IsActive(t *testing.T) {
+	// Fridays 20:00-23:00 in July, from the second week on
+	o := NewAllowedHoursOverride("summer", config.TimeRange{
+		Start: time.Date(0, 1, 1, 20, 0, 0, 0, time.UTC),
+		End:   time.Date(0, 1, 1, 23, 0, 0, 0, time.UTC),
+	}, time.Date(2024, 7, 31, 23, 59, 0, 0, time.UTC))
+	o.StartsAt = time.Date(2024, 7, 8, 0, 0, 0, 0, time.UTC)
+	o.Repeat = []string{"Friday"}
+
+	tests := []struct {
+		now  time.Time
+		want bool
+	}{
+		{time.Date(2024, 7, 5, 21, 0, 0, 0, time.UTC), false},  // Friday, before it starts
+		{time.Date(2024, 7, 12, 21, 0, 0, 0, time.UTC), true},  // Friday
+		{time.Date(2024, 7, 13, 21, 0, 0, 0, time.UTC), false}, // Saturday
+		{time.Date(2024, 8, 2, 21, 0, 0, 0, time.UTC), false},  // Friday, after it expires
+	}
+	for _, tt := range tests {
+		if got := o.IsActive(tt.now); got != tt.want {
+			t.Errorf("IsActive(%s) = %v, want %v", tt.now.Format("Mon 2006-01-02"), got, tt.want)
+		}
+	}
+
+	u := &User{}
+	u.AddOverride(o)
+	if u.AllowedHoursOverrideIsActive(time.Date(2024, 7, 13, 21, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected no active allowed hours override on Saturday")
+	}
+}
+
+func TestParseRepeat(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"fri", "Friday"},
+		{"Saturday, sun", "Sunday,Saturday"},
+		{"weekdays", "Monday,Tuesday,Wednesday,Thursday,Friday"},
+		{"weekends,mon", "Sunday,Monday,Saturday"},
+		{"daily", ""},
+	}
+	for _, tt := range tests {
+		got, err := ParseRepeat(tt.in)
+		if err != nil {
+			t.Errorf("ParseRepeat(%q) failed: %v", tt.in, err)
+			continue
+		}
+		if strings.Join(got, ",") != tt.want {
+			t.Errorf("ParseRepeat(%q) = %v, want %s", tt.in, got, tt.want)
+		}
+	}
+
+	for _, in := range []string{"", "fortnightly", "fri,"} {
+		if _, err := ParseRepeat(in); err == nil {
+			t.Errorf("expected ParseRepeat(%q) to fail", in)
+		}
+	}
+}
+
+func TestOverride_Validate(t *testing.T) {
+	now := time.Date(2024, 6, 3, 12, 0, 0, 0, time.UTC)
+	valid := []Override{
+		{ExtraTime: -30, ExpiresAt: now},
+		{DailyLimit: 90, ExtraTime: 15, ExpiresAt: now},
+		{Block: true, StartsAt: now, ExpiresAt: now.Add(time.Hour)},
+	}
+	for _, o := range valid {
+		if err := o.Validate(); err != nil {
+			t.Errorf("Validate(%+v) failed: %v", o, err)
+		}
+	}
+
+	invalid := []Override{
+		{Reason: "nothing", ExpiresAt: now},
+		{DailyLimit: -10, ExpiresAt: now},
+		{Block: true, StartsAt: now, ExpiresAt: now},
+	}
+	for _, o := range invalid {
+		if err := o.Validate(); err == nil {
+			t.Errorf("expected Validate(%+v) to fail", o)
+		}
+	}
+}
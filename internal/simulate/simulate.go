@@ -0,0 +1,330 @@
+package simulate
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/SoarinFerret/SessionWarden/internal/config"
+	"github.com/SoarinFerret/SessionWarden/internal/engine"
+	"github.com/SoarinFerret/SessionWarden/internal/eval"
+	"github.com/SoarinFerret/SessionWarden/internal/session"
+	"github.com/SoarinFerret/SessionWarden/internal/state"
+)
+
+// Event types understood by the simulator. They mirror the logind signals
+// handled by loginctl.Watch.
+const (
+	EventLogin  = "login"
+	EventLogout = "logout"
+	EventLock   = "lock"
+	EventUnlock = "unlock"
+	EventSleep  = "sleep"
+	EventWake   = "wake"
+)
+
+// Timeline actions produced by the simulator.
+const (
+	ActionLogin        = "login"
+	ActionLoginDenied  = "login_denied"
+	ActionLogout       = "logout"
+	ActionUserLock     = "user_lock"
+	ActionUnlock       = "unlock"
+	ActionUnlockDenied = "unlock_denied"
+	ActionSleep        = "sleep"
+	ActionWake         = "wake"
+	ActionNotify       = "notify"
+	ActionLock         = "lock"
+	ActionTerminate    = "terminate"
+)
+
+// defaultSession is used for events that don't name a session
+const defaultSession = "sim-1"
+
+// Event is a single scripted or recorded session event.
+type Event struct {
+	Time    time.Time `json:"time"`
+	Type    string    `json:"type"`
+	User    string    `json:"user,omitempty"`
+	Session string    `json:"session,omitempty"`
+
+	// Session details for login events, as logind would report them
+	SessionType string `json:"session_type,omitempty"`
+	Remote      bool   `json:"remote,omitempty"`
+	Service     string `json:"service,omitempty"`
+}
+
+func (ev Event) sessionInfo() session.SessionInfo {
+	return session.SessionInfo{Type: ev.SessionType, Remote: ev.Remote, Service: ev.Service}
+}
+
+// Entry is a single line of the simulated timeline.
+type Entry struct {
+	Time    time.Time `json:"time"`
+	User    string    `json:"user"`
+	Action  string    `json:"action"`
+	Session string    `json:"session,omitempty"`
+	Message string    `json:"message,omitempty"`
+}
+
+// Options controls how the simulated clock advances.
+type Options struct {
+	// Tick is the interval between engine checks (defaults to one minute,
+	// matching engine.Run)
+	Tick time.Duration
+	// Until is the time to stop simulating (defaults to the last event)
+	Until time.Time
+}
+
+// LoadEvents reads a JSON array of events from path, sorted by time.
+func LoadEvents(path string) ([]Event, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []Event
+	if err := json.Unmarshal(data, &events); err != nil {
+		return nil, fmt.Errorf("failed to parse events: %w", err)
+	}
+
+	for i, ev := range events {
+		if ev.Time.IsZero() {
+			return nil, fmt.Errorf("event %d: missing time", i)
+		}
+		switch ev.Type {
+		case EventLogin, EventLogout, EventLock, EventUnlock, EventSleep, EventWake:
+		default:
+			return nil, fmt.Errorf("event %d: unknown type %q", i, ev.Type)
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Time.Before(events[j].Time)
+	})
+	return events, nil
+}
+
+// Run replays events for username through a scratch state.Manager and the
+// eval functions, advancing a simulated clock in place of the wall clock.
+// Events without a user are attributed to username; events for other users
+// are ignored, except sleep and wake which apply to everyone.
+func Run(cfg config.Config, username string, events []Event, opts Options) ([]Entry, error) {
+	if opts.Tick <= 0 {
+		opts.Tick = time.Minute
+	}
+
+	var filtered []Event
+	for _, ev := range events {
+		if ev.User == "" {
+			ev.User = username
+		}
+		if ev.User != username && ev.Type != EventSleep && ev.Type != EventWake {
+			continue
+		}
+		if ev.Session == "" {
+			ev.Session = defaultSession
+		}
+		filtered = append(filtered, ev)
+	}
+	if len(filtered) == 0 {
+		return nil, fmt.Errorf("no events for user %s", username)
+	}
+
+	dir, err := os.MkdirTemp("", "sessionwarden-simulate-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	mgr, err := state.NewManager(filepath.Join(dir, "state.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	// Drive the session package from the simulated clock
+	now := filtered[0].Time
+	session.SetClock(func() time.Time { return now })
+	defer session.SetClock(nil)
+
+	sim := &simulator{
+		cfg:      cfg,
+		username: username,
+		mgr:      mgr,
+		locked:   make(map[string]bool),
+	}
+
+	until := opts.Until
+	if until.IsZero() {
+		until = filtered[len(filtered)-1].Time
+	}
+
+	next := 0
+	for tick := filtered[0].Time.Truncate(opts.Tick); !tick.After(until); tick = tick.Add(opts.Tick) {
+		for next < len(filtered) && !filtered[next].Time.After(tick) {
+			now = filtered[next].Time
+			sim.apply(filtered[next])
+			next++
+		}
+		now = tick
+		sim.check(tick)
+	}
+
+	return sim.timeline, nil
+}
+
+type simulator struct {
+	cfg      config.Config
+	username string
+	mgr      *state.Manager
+	locked   map[string]bool
+	timeline []Entry
+}
+
+func (s *simulator) record(t time.Time, action, sessionID, message string) {
+	s.timeline = append(s.timeline, Entry{
+		Time:    t,
+		User:    s.username,
+		Action:  action,
+		Session: sessionID,
+		Message: message,
+	})
+}
+
+// apply feeds a single event through the state.Manager handlers, running the
+// same CheckLoginDetailed decision the PAM module makes for logins and unlocks.
+func (s *simulator) apply(ev Event) {
+	switch ev.Type {
+	case EventLogin:
+		if decision := eval.CheckLogin(s.username, ev.sessionInfo(), s.mgr.Snapshot(), s.cfg, ev.Time); !decision.Allowed {
+			s.record(ev.Time, ActionLoginDenied, ev.Session, decision.Message)
+			return
+		}
+		s.mgr.HandleLoginWithInfo(s.username, ev.Session, ev.sessionInfo())
+		s.record(ev.Time, ActionLogin, ev.Session, "")
+	case EventLogout:
+		s.mgr.HandleLogout(ev.Session)
+		delete(s.locked, ev.Session)
+		s.record(ev.Time, ActionLogout, ev.Session, "")
+	case EventLock:
+		s.mgr.HandleLock(s.username, ev.Session)
+		s.locked[ev.Session] = true
+		s.record(ev.Time, ActionUserLock, ev.Session, "")
+	case EventUnlock:
+		if decision := eval.CheckLogin(s.username, s.sessionInfo(ev.Session), s.mgr.Snapshot(), s.cfg, ev.Time); !decision.Allowed {
+			s.record(ev.Time, ActionUnlockDenied, ev.Session, decision.Message)
+			return
+		}
+		s.mgr.HandleUnlock(s.username, ev.Session)
+		delete(s.locked, ev.Session)
+		s.record(ev.Time, ActionUnlock, ev.Session, "")
+	case EventSleep:
+		s.mgr.HandleSleep()
+		s.record(ev.Time, ActionSleep, "", "")
+	case EventWake:
+		s.mgr.HandleWake()
+		s.record(ev.Time, ActionWake, "", "")
+	}
+}
+
+// check mirrors Engine.checkSessions for the simulated user.
+func (s *simulator) check(now time.Time) {
+	currentState := s.mgr.Snapshot()
+
+	user, err := currentState.GetUser(s.username)
+	if err != nil || user.Paused {
+		return
+	}
+
+	userConfig, exists := s.cfg.Users[s.username]
+	if !exists {
+		return
+	}
+	if userConfig.Enabled != nil && !*userConfig.Enabled {
+		return
+	}
+
+	activeSession := user.GetActiveSession()
+	if activeSession == nil {
+		return
+	}
+
+	permitted := true
+	for _, sess := range user.GetActiveSessions() {
+		if s.locked[sess.SessionId] {
+			if sess == activeSession {
+				permitted = false
+			}
+			continue
+		}
+		if eval.PermitSession(s.username, sess.SessionInfo, currentState, s.cfg, now) {
+			continue
+		}
+		if sess == activeSession {
+			permitted = false
+		}
+		s.enforce(now, sess, userConfig)
+	}
+	if !permitted {
+		return
+	}
+
+	remaining := eval.GetTimeRemaining(s.username, currentState, s.cfg, now)
+	if eval.CheckSendNotification(remaining, userConfig.NotifyBefore) {
+		message := engine.FormatTimeRemaining(time.Duration(remaining) * time.Second)
+		s.record(now, ActionNotify, activeSession.SessionId, fmt.Sprintf("You have %s of session time remaining", message))
+	}
+
+	if userConfig.WindDown.Enabled() {
+		if windowEnd := eval.GetWindowEnd(s.username, currentState, s.cfg, now); !windowEnd.IsZero() {
+			left := windowEnd.Sub(now)
+			if send, _ := eval.CheckWindDown(int64(left.Seconds()), userConfig.WindDown); send {
+				s.record(now, ActionNotify, activeSession.SessionId, engine.WindDownMessage(windowEnd, left))
+			}
+		}
+	}
+
+	if breakRemaining, ok := eval.GetBreakRemaining(s.username, currentState, s.cfg, now); ok {
+		if eval.CheckSendNotification(breakRemaining, engine.BreakNotifyBefore(userConfig)) {
+			message := engine.FormatTimeRemaining(time.Duration(breakRemaining) * time.Second)
+			s.record(now, ActionNotify, activeSession.SessionId, fmt.Sprintf("Your session will be locked in %s for a break", message))
+		}
+	}
+}
+
+// enforce mirrors Engine.enforceSession, feeding the resulting logind
+// events back through the state manager.
+func (s *simulator) enforce(now time.Time, sess *session.SessionRecord, userConfig config.UserConfig) {
+	sessionID := sess.SessionId
+	policy, _ := userConfig.SessionPolicyFor(sess.Type, sess.Remote, sess.Service)
+	if policy.EnforceAction() == config.ActionTerminate {
+		s.mgr.HandleLogout(sessionID)
+		s.record(now, ActionTerminate, sessionID, "session terminated by policy")
+		return
+	}
+
+	s.locked[sessionID] = true
+	if userConfig.LockScreen != nil && !*userConfig.LockScreen {
+		s.record(now, ActionLock, sessionID, "lock skipped: lock_screen is disabled")
+		return
+	}
+	s.mgr.HandleLock(s.username, sessionID)
+	s.record(now, ActionLock, sessionID, "session locked by policy")
+}
+
+// sessionInfo returns the recorded details of a session, if it exists
+func (s *simulator) sessionInfo(sessionID string) session.SessionInfo {
+	currentState := s.mgr.Snapshot()
+	user, err := currentState.GetUser(s.username)
+	if err != nil {
+		return session.SessionInfo{}
+	}
+	sess, err := user.GetSessionByID(sessionID)
+	if err != nil {
+		return session.SessionInfo{}
+	}
+	return sess.SessionInfo
+}
@@ -0,0 +1,240 @@
+package simulate
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/SoarinFerret/SessionWarden/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func testConfig(t *testing.T) config.Config {
+	cfg, err := config.LoadConfigFromBytes([]byte(`
+[default]
+enabled = false
+
+[users.bob]
+enabled = true
+daily_limit = "1h"
+allowed_hours = "08:00-20:00"
+weekend_hours = "08:00-20:00"
+notify_before = ["10m"]
+lock_screen = true
+`))
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	return cfg
+}
+
+func at(hour, minute int) time.Time {
+	return time.Date(2024, 6, 3, hour, minute, 0, 0, time.UTC)
+}
+
+func actions(timeline []Entry) []string {
+	var out []string
+	for _, e := range timeline {
+		out = append(out, e.Time.Format("15:04")+" "+e.Action)
+	}
+	return out
+}
+
+func TestRun_DailyLimit(t *testing.T) {
+	events := []Event{
+		{Time: at(9, 0), Type: EventLogin},
+		{Time: at(10, 30), Type: EventUnlock},
+		{Time: at(11, 0), Type: EventLogout},
+		{Time: at(12, 0), Type: EventLogin, Session: "sim-2"},
+	}
+
+	timeline, err := Run(testConfig(t), "bob", events, Options{})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	assert.Equal(t, []string{
+		"09:00 login",
+		"09:50 notify",
+		"10:00 lock",
+		"10:30 unlock_denied",
+		"11:00 logout",
+		"12:00 login_denied",
+	}, actions(timeline))
+	assert.Equal(t, "You have 10 minute(s) of session time remaining", timeline[1].Message)
+}
+
+func TestRun_SleepPausesUsage(t *testing.T) {
+	events := []Event{
+		{Time: at(9, 0), Type: EventLogin},
+		{Time: at(9, 30), Type: EventSleep},
+		{Time: at(11, 0), Type: EventWake},
+		{Time: at(11, 0), Type: EventUnlock},
+		{Time: at(11, 45), Type: EventLogout},
+	}
+
+	timeline, err := Run(testConfig(t), "bob", events, Options{})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	// 30 minutes before sleep, so the 10 minute warning comes at 11:20
+	// and the limit is reached at 11:30
+	assert.Equal(t, []string{
+		"09:00 login",
+		"09:30 sleep",
+		"11:00 wake",
+		"11:00 unlock",
+		"11:20 notify",
+		"11:30 lock",
+		"11:45 logout",
+	}, actions(timeline))
+}
+
+func TestRun_IgnoresOtherUsers(t *testing.T) {
+	events := []Event{
+		{Time: at(9, 0), Type: EventLogin, User: "alice"},
+		{Time: at(9, 5), Type: EventLogin, User: "bob"},
+	}
+
+	timeline, err := Run(testConfig(t), "bob", events, Options{})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	assert.Equal(t, []string{"09:05 login"}, actions(timeline))
+
+	if _, err := Run(testConfig(t), "carol", events, Options{}); err == nil {
+		t.Errorf("expected error when no events match the user")
+	}
+}
+
+func TestLoadEvents(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.json")
+	data := `[
+  {"time": "2024-06-03T10:00:00Z", "type": "logout"},
+  {"time": "2024-06-03T09:00:00Z", "type": "login", "session": "s1"}
+]`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := LoadEvents(path)
+	if err != nil {
+		t.Fatalf("LoadEvents failed: %v", err)
+	}
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, EventLogin, events[0].Type)
+		assert.Equal(t, "s1", events[0].Session)
+	}
+
+	if err := os.WriteFile(path, []byte(`[{"time": "2024-06-03T09:00:00Z", "type": "reboot"}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadEvents(path); err == nil {
+		t.Errorf("expected error for unknown event type")
+	}
+}
+
+func TestRun_SessionPolicies(t *testing.T) {
+	cfg, err := config.LoadConfigFromBytes([]byte(`
+[users.bob]
+enabled = true
+daily_limit = "1h"
+allowed_hours = "08:00-20:00"
+lock_screen = true
+[users.bob.sessions.sshd]
+count_usage = false
+[users.bob.sessions.tty]
+action = "terminate"
+`))
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+
+	events := []Event{
+		{Time: at(9, 0), Type: EventLogin, Session: "ssh", SessionType: "tty", Remote: true, Service: "sshd"},
+		{Time: at(9, 30), Type: EventLogin, Session: "console", SessionType: "tty", Service: "login"},
+		{Time: at(10, 45), Type: EventLogout, Session: "ssh"},
+	}
+
+	timeline, err := Run(cfg, "bob", events, Options{})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	// SSH time doesn't count, so the console session reaches the limit an
+	// hour after it started and is terminated since TTYs can't be locked
+	assert.Equal(t, []string{
+		"09:00 login",
+		"09:30 login",
+		"10:30 terminate",
+		"10:45 logout",
+	}, actions(timeline))
+}
+
+func TestRun_MandatoryBreak(t *testing.T) {
+	cfg, err := config.LoadConfigFromBytes([]byte(`
+[users.bob]
+enabled = true
+max_continuous = "45m"
+break_length = "10m"
+lock_screen = true
+`))
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	events := []Event{
+		{Time: at(9, 0), Type: EventLogin},
+		{Time: at(9, 50), Type: EventUnlock},
+		{Time: at(9, 56), Type: EventUnlock},
+	}
+
+	timeline, err := Run(cfg, "bob", events, Options{})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	assert.Equal(t, []string{
+		"09:00 login",
+		"09:40 notify",
+		"09:45 lock",
+		"09:50 unlock_denied",
+		"09:56 unlock",
+	}, actions(timeline))
+	assert.Equal(t, "Your session will be locked in 5 minute(s) for a break", timeline[1].Message)
+}
+
+func TestRun_WindDown(t *testing.T) {
+	cfg, err := config.LoadConfigFromBytes([]byte(`
+[users.bob]
+enabled = true
+allowed_hours = "08:00-21:00"
+lock_screen = true
+
+[users.bob.wind_down]
+start = "20m"
+every = "10m"
+critical = "2m"
+`))
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	events := []Event{
+		{Time: at(20, 30), Type: EventLogin},
+	}
+
+	timeline, err := Run(cfg, "bob", events, Options{Until: at(21, 0)})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	assert.Equal(t, []string{
+		"20:30 login",
+		"20:40 notify",
+		"20:50 notify",
+		"20:58 notify",
+		"20:59 notify",
+	}, actions(timeline))
+	assert.Equal(t, "Your allowed hours end at 21:00, 20 minute(s) left", timeline[1].Message)
+}
@@ -0,0 +1,250 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/SoarinFerret/SessionWarden/internal/session"
+)
+
+// BackupCount is how many rotated backups of the state file are kept, as
+// state.json.1 (newest) to state.json.N (oldest).
+const BackupCount = 3
+
+// backupInterval limits how often the state file is rotated into the
+// backups, so they span more than the last few saves.
+const backupInterval = time.Hour
+
+// ErrCorrupt is returned when a state file exists but cannot be parsed.
+var ErrCorrupt = errors.New("state file is corrupt")
+
+// FileStore keeps the state in a single JSON file, rewritten atomically on
+// every save, with rotating backups next to it.
+type FileStore struct {
+	path       string
+	lastBackup time.Time
+}
+
+// NewFileStore returns a store for the JSON state file at path.
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+// Load reads the state file, upgrading it if it was written by an older
+// version and falling back to the newest valid backup if it is corrupt.
+func (fs *FileStore) Load() (*State, error) {
+	s, data, fromVersion, err := readStateFile(fs.path)
+	if errors.Is(err, ErrCorrupt) {
+		return fs.recover(err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if fromVersion != CurrentVersion {
+		// Keep the original around in case the migration got something wrong
+		backup := fmt.Sprintf("%s.v%d.bak", fs.path, fromVersion)
+		if err := os.WriteFile(backup, data, 0644); err != nil {
+			return nil, fmt.Errorf("failed to back up state before migration: %w", err)
+		}
+		if err := fs.Save(s); err != nil {
+			return nil, err
+		}
+		slog.Info("Migrated state file", "from_version", fromVersion, "to_version", CurrentVersion, "backup", backup)
+	}
+	return s, nil
+}
+
+// recover replaces a corrupt state file with the newest backup that loads,
+// keeping the corrupt file for inspection.
+func (fs *FileStore) recover(loadErr error) (*State, error) {
+	for n := 1; n <= BackupCount; n++ {
+		backup := BackupPath(fs.path, n)
+		s, _, _, err := readStateFile(backup)
+		if err != nil {
+			continue
+		}
+
+		corrupt := fmt.Sprintf("%s.corrupt-%d", fs.path, time.Now().Unix())
+		if err := os.Rename(fs.path, corrupt); err != nil {
+			return nil, fmt.Errorf("failed to move aside corrupt state file: %w", err)
+		}
+		slog.Error("State file is corrupt - restored from backup", "error", loadErr, "backup", backup, "corrupt_file", corrupt)
+
+		// Don't rotate the corrupt file into the backups
+		fs.lastBackup = time.Now()
+		return s, fs.Save(s)
+	}
+	return nil, fmt.Errorf("%w, and no valid backup was found", loadErr)
+}
+
+// Save atomically writes the state file to disk, first rotating the
+// previous file into the backups if the last backup is over an hour old.
+func (fs *FileStore) Save(s *State) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if time.Since(fs.lastBackup) >= backupInterval {
+		if err := rotateBackups(fs.path); err != nil {
+			slog.Error("Failed to rotate state backups", "error", err)
+		} else {
+			fs.lastBackup = time.Now()
+		}
+	}
+
+	return writeFileAtomic(fs.path, data)
+}
+
+// SaveUser rewrites the whole file, since a single user can't be updated
+// in place.
+func (fs *FileStore) SaveUser(s *State, username string) error {
+	return fs.Save(s)
+}
+
+// Touch sets the state file's mtime, which Load reports as the heartbeat.
+func (fs *FileStore) Touch(t time.Time) error {
+	return os.Chtimes(fs.path, t, t)
+}
+
+func (fs *FileStore) Close() error {
+	return nil
+}
+
+// BackupPath returns the path of the nth backup of the state file at path
+func BackupPath(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}
+
+// VerifyFile loads the state file at path without modifying it, returning
+// the state as it would be after migration.
+func VerifyFile(path string) (*State, error) {
+	s, _, _, err := readStateFile(path)
+	return s, err
+}
+
+// RestoreBackup replaces the state file at path with its nth backup. The
+// replaced file is kept as <path>.pre-restore. The daemon must not be
+// running, or it will overwrite the restored file on its next save.
+func RestoreBackup(path string, n int) error {
+	backup := BackupPath(path, n)
+	if _, err := VerifyFile(backup); err != nil {
+		return fmt.Errorf("backup %s is not usable: %w", backup, err)
+	}
+
+	data, err := os.ReadFile(backup)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(path, path+".pre-restore"); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to keep current state file: %w", err)
+	}
+
+	return writeFileAtomic(path, data)
+}
+
+// readStateFile reads and migrates the state file at path. It also returns
+// the raw file contents and the version they were written at.
+func readStateFile(path string) (*State, []byte, int, error) {
+	var s State
+
+	// read mtime of file to set heartbeat
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	s.HeartBeat = info.ModTime()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	migrated, fromVersion, err := migrate(data)
+	if errors.Is(err, ErrNewerVersion) {
+		return nil, nil, fromVersion, err
+	}
+	if err != nil {
+		return nil, nil, fromVersion, fmt.Errorf("%w: %s: %v", ErrCorrupt, path, err)
+	}
+
+	if err := json.Unmarshal(migrated, &s); err != nil {
+		return nil, nil, fromVersion, fmt.Errorf("%w: %s: %v", ErrCorrupt, path, err)
+	}
+	if s.Users == nil {
+		s.Users = make(map[string]session.User)
+	}
+
+	return &s, data, fromVersion, nil
+}
+
+// rotateBackups shifts the existing backups down by one and links the
+// current state file in as the newest. A corrupt state file is never
+// rotated in, so the backups stay last-known-good.
+func rotateBackups(path string) error {
+	if _, err := VerifyFile(path); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("not backing up current state: %w", err)
+	}
+
+	if err := os.Remove(BackupPath(path, BackupCount)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	for n := BackupCount - 1; n >= 1; n-- {
+		if err := os.Rename(BackupPath(path, n), BackupPath(path, n+1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	// The state file is replaced by rename, so a hard link keeps the old
+	// contents without copying them
+	if err := os.Link(path, BackupPath(path, 1)); err != nil {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return writeFileAtomic(BackupPath(path, 1), data)
+	}
+	return nil
+}
+
+// writeFileAtomic writes data to a temporary file, fsyncs it and renames it
+// over path, then fsyncs the directory so the rename survives a power loss.
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
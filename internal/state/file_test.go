@@ -0,0 +1,127 @@
+package state
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/SoarinFerret/SessionWarden/internal/session"
+)
+
+// saveWithBackup saves the manager's state, forcing a backup rotation first
+func saveWithBackup(t *testing.T, m *Manager) {
+	m.store.(*FileStore).lastBackup = time.Time{}
+	if err := m.save(); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+}
+
+func TestSave_RotatesBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	m, err := NewManager(path)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		m.state.Users[name] = session.User{}
+		saveWithBackup(t, m)
+	}
+
+	// The newest backup holds the state before the last save
+	s, err := VerifyFile(BackupPath(path, 1))
+	if err != nil {
+		t.Fatalf("backup 1 invalid: %v", err)
+	}
+	if _, ok := s.Users["e"]; ok {
+		t.Errorf("backup 1 should not contain the latest save")
+	}
+	if _, ok := s.Users["d"]; !ok {
+		t.Errorf("backup 1 should contain the previous save")
+	}
+
+	if _, err := os.Stat(BackupPath(path, BackupCount)); err != nil {
+		t.Errorf("expected %d backups: %v", BackupCount, err)
+	}
+	if _, err := os.Stat(BackupPath(path, BackupCount+1)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected no more than %d backups", BackupCount)
+	}
+
+	// Saves within the backup interval don't rotate
+	m.state.Users["f"] = session.User{}
+	if err := m.save(); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	s, _ = VerifyFile(BackupPath(path, 1))
+	if _, ok := s.Users["e"]; ok {
+		t.Errorf("backups rotated within the backup interval")
+	}
+}
+
+func TestLoad_RecoversFromBackup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	m, _ := NewManager(path)
+	m.state.Users["alice"] = session.User{Paused: true}
+	saveWithBackup(t, m)
+	saveWithBackup(t, m)
+
+	if err := os.WriteFile(path, []byte(`{"users": {"alice": `), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m2, err := NewManager(path)
+	if err != nil {
+		t.Fatalf("NewManager should recover from backup: %v", err)
+	}
+	if !m2.state.Users["alice"].Paused {
+		t.Errorf("state was not restored from backup")
+	}
+	if _, err := VerifyFile(path); err != nil {
+		t.Errorf("restored state was not written back: %v", err)
+	}
+
+	corrupt, _ := filepath.Glob(path + ".corrupt-*")
+	if len(corrupt) != 1 {
+		t.Errorf("expected the corrupt file to be kept, found %v", corrupt)
+	}
+}
+
+func TestLoad_CorruptWithoutBackup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(path, []byte(`not json`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewManager(path); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("expected ErrCorrupt, got %v", err)
+	}
+}
+
+func TestRestoreBackup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	m, _ := NewManager(path)
+	m.state.Users["alice"] = session.User{}
+	saveWithBackup(t, m)
+	delete(m.state.Users, "alice")
+	saveWithBackup(t, m)
+
+	if err := RestoreBackup(path, 1); err != nil {
+		t.Fatalf("RestoreBackup failed: %v", err)
+	}
+	s, err := VerifyFile(path)
+	if err != nil {
+		t.Fatalf("restored file invalid: %v", err)
+	}
+	if _, ok := s.Users["alice"]; !ok {
+		t.Errorf("backup was not restored")
+	}
+	if _, err := os.Stat(path + ".pre-restore"); err != nil {
+		t.Errorf("replaced file was not kept: %v", err)
+	}
+
+	if err := RestoreBackup(path, BackupCount+1); err == nil {
+		t.Errorf("expected error restoring a missing backup")
+	}
+}
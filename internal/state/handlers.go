@@ -1,13 +1,19 @@
 package state
 
 import (
-	"log"
+	"log/slog"
 	"time"
 
 	"github.com/SoarinFerret/SessionWarden/internal/session"
 )
 
 func (m *Manager) HandleLogin(user string, sessionID string) {
+	m.HandleLoginWithInfo(user, sessionID, session.SessionInfo{})
+}
+
+// HandleLoginWithInfo records a login along with the session's logind type,
+// remote flag and PAM service, which session policies are keyed on.
+func (m *Manager) HandleLoginWithInfo(user string, sessionID string, info session.SessionInfo) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -27,17 +33,17 @@ func (m *Manager) HandleLogin(user string, sessionID string) {
 		// If it's idle (no active segment), start a new segment
 		s, err := u.GetSessionByID(sessionID)
 		if err == nil && s.IsIdle() {
-			s.AddSegment(time.Now())
+			s.AddSegment(session.Now())
 			m.state.Users[user] = *u
-			m.save()
+			m.saveUser(user)
 		}
 		return
 	}
 
 	// Create new session (which automatically creates first segment)
-	u.AddSession(time.Now(), sessionID)
+	u.AddSessionWithInfo(session.Now(), sessionID, info)
 	m.state.Users[user] = *u
-	m.save()
+	m.saveUser(user)
 }
 
 func (m *Manager) HandleLogout(sessionID string) {
@@ -46,14 +52,14 @@ func (m *Manager) HandleLogout(sessionID string) {
 
 	username, u, err := m.state.GetUserBySession(sessionID)
 	if err != nil {
-		log.Println("Error finding user for session logout:", err)
+		slog.Warn("No user found for session logout", "session_id", sessionID, "error", err)
 		return
 	}
 	//log.Println("User logged out:", username)
 
-	u.EndSession(time.Now(), sessionID)
+	u.EndSession(session.Now(), sessionID)
 	m.state.Users[username] = *u
-	m.save()
+	m.saveUser(username)
 }
 
 func (m *Manager) HandleSleep() {
@@ -67,7 +73,7 @@ func (m *Manager) HandleSleep() {
 }
 
 func (m *Manager) HandleWake() {
-	log.Println("System woke up")
+	slog.Info("System woke up")
 	// Don't create segments here - wait for actual user interaction (unlock/login)
 }
 
@@ -80,19 +86,19 @@ func (m *Manager) HandleLock(user string, sessionID string) {
 	// End current segment
 	u, err := m.state.GetUser(user)
 	if err != nil {
-		log.Println("Error finding user for lock:", err)
+		slog.Warn("No user found for lock", "user", user, "session_id", sessionID, "error", err)
 		return
 	}
 	s, err := u.GetSessionByID(sessionID)
 	if err != nil {
-		log.Println("Error finding session for lock:", err)
+		slog.Warn("No session found for lock", "user", user, "session_id", sessionID, "error", err)
 		return
 	}
-	s.EndSegment(time.Now(), "user lock")
+	s.EndSegment(session.Now(), "user lock")
 
 	// Update user in state
 	m.state.Users[user] = *u
-	m.save()
+	m.saveUser(user)
 }
 
 func (m *Manager) HandleUnlock(user string, sessionID string) {
@@ -102,17 +108,48 @@ func (m *Manager) HandleUnlock(user string, sessionID string) {
 	//fmt.Println("User unlocked session:", user)
 	u, err := m.state.GetUser(user)
 	if err != nil {
-		log.Println("Error finding user for unlock:", err)
+		slog.Warn("No user found for unlock", "user", user, "session_id", sessionID, "error", err)
 		return
 	}
 	s, err := u.GetSessionByID(sessionID)
 	if err != nil {
-		log.Println("Error finding session for unlock:", err)
+		slog.Warn("No session found for unlock", "user", user, "session_id", sessionID, "error", err)
 		return
 	}
-	s.AddSegment(time.Now())
+	s.AddSegment(session.Now())
 
 	// Update user in state
 	m.state.Users[user] = *u
-	m.save()
+	m.saveUser(user)
+}
+
+// RecordDeniedLogin adds a login_denied entry to the user's history and
+// returns how many logins they have had denied today, including this one.
+// A user without state is only added if create is true, so denials for
+// arbitrary usernames can't grow the state; otherwise it returns 0.
+func (m *Manager) RecordDeniedLogin(user string, create bool, entry session.HistoryEntry) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, err := m.state.GetUser(user)
+	if err != nil {
+		if !create {
+			return 0
+		}
+		// Users can be denied before they ever log in
+		u = &session.User{
+			Sessions: []session.SessionRecord{},
+		}
+	}
+
+	entry.Kind = session.HistoryLoginDenied
+	u.AddHistory(entry)
+	m.state.Users[user] = *u
+	if err := m.saveUser(user); err != nil {
+		slog.Error("Failed to save state", "user", user, "error", err)
+	}
+
+	now := session.Now()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	return len(u.GetHistory(session.HistoryLoginDenied, midnight))
 }
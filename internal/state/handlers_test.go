@@ -4,6 +4,8 @@ import (
 	"path/filepath"
 	"testing"
 	"time"
+
+	"github.com/SoarinFerret/SessionWarden/internal/session"
 )
 
 func tempManager(t *testing.T) *Manager {
@@ -187,3 +189,54 @@ func TestSleepWakeWithSessionNewReemission(t *testing.T) {
 		t.Errorf("second HandleLogin should not create another segment, expected %d segments, got %d", initialSegmentCount+1, len(s.Segments))
 	}
 }
+
+func TestHandleLoginWithInfo(t *testing.T) {
+	m := tempManager(t)
+	info := session.SessionInfo{Type: "tty", Remote: true, Service: "sshd"}
+
+	m.HandleLoginWithInfo("frank", "sess6", info)
+	u, err := m.state.GetUser("frank")
+	if err != nil {
+		t.Fatalf("user not found after login: %v", err)
+	}
+	if len(u.Sessions) != 1 || u.Sessions[0].SessionInfo != info {
+		t.Errorf("expected session info %+v to be recorded, got %+v", info, u.Sessions)
+	}
+}
+
+func TestRecordDeniedLogin(t *testing.T) {
+	m := tempManager(t)
+	now := time.Date(2024, 6, 3, 22, 0, 0, 0, time.UTC)
+	session.SetClock(func() time.Time { return now })
+	defer session.SetClock(nil)
+
+	// A denial from yesterday doesn't count toward today's total
+	m.RecordDeniedLogin("gina", true, session.HistoryEntry{Time: now.Add(-24 * time.Hour), Reason: "paused"})
+	count := m.RecordDeniedLogin("gina", true, session.HistoryEntry{Reason: "outside_hours", Service: "sshd", Phase: "authentication"})
+	if count != 1 {
+		t.Errorf("expected 1 denial today, got %d", count)
+	}
+
+	u, err := m.state.GetUser("gina")
+	if err != nil {
+		t.Fatalf("user not created on denial: %v", err)
+	}
+	if len(u.History) != 2 {
+		t.Fatalf("expected 2 history entries, got %d", len(u.History))
+	}
+	last := u.History[1]
+	if last.Kind != session.HistoryLoginDenied || !last.Time.Equal(now) || last.Service != "sshd" {
+		t.Errorf("unexpected history entry %+v", last)
+	}
+
+	// Unknown users are not added to the state, but known ones still are
+	if count := m.RecordDeniedLogin("nobody", false, session.HistoryEntry{Reason: "paused"}); count != 0 {
+		t.Errorf("expected no count for an unknown user, got %d", count)
+	}
+	if _, err := m.state.GetUser("nobody"); err == nil {
+		t.Errorf("unknown user was added to the state")
+	}
+	if count := m.RecordDeniedLogin("gina", false, session.HistoryEntry{Reason: "paused"}); count != 2 {
+		t.Errorf("expected 2 denials today for an existing user, got %d", count)
+	}
+}
@@ -0,0 +1,238 @@
+package state
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/SoarinFerret/SessionWarden/internal/session"
+)
+
+// DefaultCompactAfter is how many journal records are written before the
+// journal is folded back into the snapshot.
+const DefaultCompactAfter = 500
+
+// JournalStore keeps a snapshot of the state in a JSON file (with the same
+// backups and recovery as FileStore) plus an append-only journal of user
+// records written since the snapshot. Single-user changes only append a
+// line, and a crash loses at most the record being written.
+type JournalStore struct {
+	snapshot    *FileStore
+	journalPath string
+	journal     *os.File
+	records     int
+	generation  uint64
+
+	// CompactAfter is the number of journal records that triggers a
+	// compaction (DefaultCompactAfter if zero)
+	CompactAfter int
+}
+
+// journalRecord is a single line in the journal: the full record for one
+// user at the time of the change, and the generation of the snapshot it
+// was written after.
+type journalRecord struct {
+	Version    int             `json:"version"`
+	Generation uint64          `json:"generation,omitempty"`
+	User       string          `json:"user"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// NewJournalStore returns a store with its snapshot at path and its journal
+// at path + ".journal".
+func NewJournalStore(path string) *JournalStore {
+	return &JournalStore{
+		snapshot:    NewFileStore(path),
+		journalPath: path + ".journal",
+	}
+}
+
+// Load reads the snapshot and replays the journal on top of it.
+func (js *JournalStore) Load() (*State, error) {
+	s, err := js.snapshot.Load()
+	if errors.Is(err, os.ErrNotExist) {
+		// A journal without a snapshot can still be replayed onto an
+		// empty state
+		if _, statErr := os.Stat(js.journalPath); statErr != nil {
+			return nil, err
+		}
+		s = &State{Users: make(map[string]session.User), Version: CurrentVersion}
+	} else if err != nil {
+		return nil, err
+	}
+
+	js.generation = s.Generation
+	records, err := js.replay(s)
+	if err != nil {
+		return nil, err
+	}
+	js.records = records
+	if records > 0 {
+		slog.Info("Replayed state journal", "records", records)
+		if info, err := os.Stat(js.journalPath); err == nil && info.ModTime().After(s.HeartBeat) {
+			s.HeartBeat = info.ModTime()
+		}
+	}
+
+	return s, nil
+}
+
+// replay applies each journal record to s. A record only counts once its
+// newline is written, so a torn final line left by a crash mid-write is
+// cut off the file; otherwise the next append would be glued onto it and
+// lost on the following load.
+func (js *JournalStore) replay(s *State) (int, error) {
+	data, err := os.ReadFile(js.journalPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	records, good := 0, 0
+	for rest := data; len(rest) > 0; good = len(data) - len(rest) {
+		end := bytes.IndexByte(rest, '\n')
+		if end < 0 {
+			break
+		}
+		line := rest[:end]
+		rest = rest[end+1:]
+		if len(line) == 0 {
+			continue
+		}
+
+		var rec journalRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			slog.Warn("Ignoring incomplete state journal record", "record", records+1, "error", err)
+			break
+		}
+		if rec.Generation < s.Generation {
+			// Left over from before the snapshot, which already has
+			// this change and possibly newer ones
+			continue
+		}
+
+		user, err := decodeJournalUser(rec)
+		if err != nil {
+			return records, fmt.Errorf("state journal record %d: %w", records+1, err)
+		}
+		s.Users[rec.User] = user
+		records++
+	}
+
+	if good < len(data) {
+		slog.Warn("Truncating torn state journal", "bytes", len(data)-good)
+		if err := os.Truncate(js.journalPath, int64(good)); err != nil {
+			return records, err
+		}
+	}
+	return records, nil
+}
+
+// decodeJournalUser decodes a journal record's user, migrating it if it was
+// written by an older version
+func decodeJournalUser(rec journalRecord) (session.User, error) {
+	var user session.User
+	data := []byte(rec.Data)
+
+	if rec.Version != CurrentVersion {
+		doc, err := json.Marshal(map[string]any{
+			"version": rec.Version,
+			"users":   map[string]json.RawMessage{rec.User: rec.Data},
+		})
+		if err != nil {
+			return user, err
+		}
+		migrated, _, err := migrate(doc)
+		if err != nil {
+			return user, err
+		}
+		var s State
+		if err := json.Unmarshal(migrated, &s); err != nil {
+			return user, err
+		}
+		return s.Users[rec.User], nil
+	}
+
+	err := json.Unmarshal(data, &user)
+	return user, err
+}
+
+// Save writes a new snapshot and empties the journal.
+func (js *JournalStore) Save(s *State) error {
+	// The snapshot gets a new generation, so if we crash before the
+	// journal is removed, its records are skipped on load rather than
+	// undoing changes made since they were written
+	next := *s
+	next.Generation = js.generation + 1
+	if err := js.snapshot.Save(&next); err != nil {
+		return err
+	}
+	js.generation = next.Generation
+
+	if js.journal != nil {
+		js.journal.Close()
+		js.journal = nil
+	}
+	if err := os.Remove(js.journalPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	js.records = 0
+	return nil
+}
+
+// SaveUser appends the user's record to the journal, compacting once the
+// journal grows past CompactAfter records.
+func (js *JournalStore) SaveUser(s *State, username string) error {
+	limit := js.CompactAfter
+	if limit <= 0 {
+		limit = DefaultCompactAfter
+	}
+	if js.records >= limit {
+		return js.Save(s)
+	}
+
+	data, err := json.Marshal(s.Users[username])
+	if err != nil {
+		return err
+	}
+	line, err := json.Marshal(journalRecord{Version: CurrentVersion, Generation: js.generation, User: username, Data: data})
+	if err != nil {
+		return err
+	}
+
+	if js.journal == nil {
+		js.journal, err = os.OpenFile(js.journalPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+	}
+	if _, err := js.journal.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if err := js.journal.Sync(); err != nil {
+		return err
+	}
+	js.records++
+	return nil
+}
+
+// Touch sets the snapshot's mtime, which Load reports as the heartbeat.
+func (js *JournalStore) Touch(t time.Time) error {
+	return js.snapshot.Touch(t)
+}
+
+// Close closes the journal file.
+func (js *JournalStore) Close() error {
+	if js.journal == nil {
+		return nil
+	}
+	err := js.journal.Close()
+	js.journal = nil
+	return err
+}
@@ -0,0 +1,212 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/SoarinFerret/SessionWarden/internal/session"
+)
+
+func TestJournalStore_ReplaysUserRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	m, err := NewManagerWithStore(NewJournalStore(path))
+	if err != nil {
+		t.Fatalf("NewManagerWithStore failed: %v", err)
+	}
+	snapshot, _ := os.ReadFile(path)
+
+	m.HandleLogin("alice", "s1")
+	m.HandleLock("alice", "s1")
+	m.HandleLogin("bob", "s2")
+
+	// Single-user changes only append to the journal
+	if after, _ := os.ReadFile(path); string(after) != string(snapshot) {
+		t.Errorf("snapshot was rewritten for a single-user change")
+	}
+	journal, err := os.ReadFile(path + ".journal")
+	if err != nil {
+		t.Fatalf("journal not written: %v", err)
+	}
+	if n := strings.Count(string(journal), "\n"); n != 3 {
+		t.Errorf("expected 3 journal records, got %d", n)
+	}
+
+	// Simulate a crash: no Close, and a torn record at the end
+	f, _ := os.OpenFile(path+".journal", os.O_WRONLY|os.O_APPEND, 0644)
+	f.WriteString(`{"version": 2, "user": "carol", "da`)
+	f.Close()
+
+	m2, err := NewManagerWithStore(NewJournalStore(path))
+	if err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	alice := m2.state.Users["alice"]
+	if len(alice.Sessions) != 1 || !alice.Sessions[0].IsIdle() {
+		t.Errorf("alice's lock was not replayed: %+v", alice.Sessions)
+	}
+	if _, ok := m2.state.Users["bob"]; !ok {
+		t.Errorf("bob's login was not replayed")
+	}
+	if _, ok := m2.state.Users["carol"]; ok {
+		t.Errorf("torn record should be ignored")
+	}
+}
+
+func TestJournalStore_AppendsAfterTornRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	m, err := NewManagerWithStore(NewJournalStore(path))
+	if err != nil {
+		t.Fatalf("NewManagerWithStore failed: %v", err)
+	}
+	m.HandleLogin("alice", "s1")
+
+	f, _ := os.OpenFile(path+".journal", os.O_WRONLY|os.O_APPEND, 0644)
+	f.WriteString(`{"version": 2, "user": "carol", "da`)
+	f.Close()
+
+	// Records appended after recovering from the torn line must survive
+	// the next reload
+	m2, err := NewManagerWithStore(NewJournalStore(path))
+	if err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	m2.HandleLogin("bob", "s2")
+	m2.HandleLock("alice", "s1")
+
+	m3, err := NewManagerWithStore(NewJournalStore(path))
+	if err != nil {
+		t.Fatalf("second reload failed: %v", err)
+	}
+	if _, ok := m3.state.Users["bob"]; !ok {
+		t.Errorf("bob's login after the torn record was lost")
+	}
+	alice := m3.state.Users["alice"]
+	if len(alice.Sessions) != 1 || !alice.Sessions[0].IsIdle() {
+		t.Errorf("alice's lock after the torn record was lost: %+v", alice.Sessions)
+	}
+	if _, ok := m3.state.Users["carol"]; ok {
+		t.Errorf("torn record should be ignored")
+	}
+}
+
+func TestJournalStore_SkipsJournalOlderThanSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	m, err := NewManagerWithStore(NewJournalStore(path))
+	if err != nil {
+		t.Fatalf("NewManagerWithStore failed: %v", err)
+	}
+	m.HandleLogin("alice", "s1")
+	m.HandleLogin("bob", "s2")
+	journal, err := os.ReadFile(path + ".journal")
+	if err != nil {
+		t.Fatalf("journal not written: %v", err)
+	}
+
+	// A full update writes a new snapshot; crash before the journal is
+	// removed by putting it back
+	err = m.Update(func(s *State) error {
+		alice := s.Users["alice"]
+		alice.Paused = true
+		s.Users["alice"] = alice
+		delete(s.Users, "bob")
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if err := os.WriteFile(path+".journal", journal, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m2, err := NewManagerWithStore(NewJournalStore(path))
+	if err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	if !m2.state.Users["alice"].Paused {
+		t.Errorf("stale journal record undid alice's pause")
+	}
+	if _, ok := m2.state.Users["bob"]; ok {
+		t.Errorf("stale journal record brought back the removed user bob")
+	}
+
+	// Records written after the snapshot are still replayed
+	m2.HandleLogin("carol", "s3")
+	m3, err := NewManagerWithStore(NewJournalStore(path))
+	if err != nil {
+		t.Fatalf("second reload failed: %v", err)
+	}
+	if _, ok := m3.state.Users["carol"]; !ok {
+		t.Errorf("carol's login after the snapshot was not replayed")
+	}
+}
+
+func TestJournalStore_Compacts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	store := NewJournalStore(path)
+	store.CompactAfter = 2
+	m, err := NewManagerWithStore(store)
+	if err != nil {
+		t.Fatalf("NewManagerWithStore failed: %v", err)
+	}
+
+	m.HandleLogin("alice", "s1")
+	m.HandleLogin("bob", "s2")
+	m.HandleLogin("carol", "s3") // compacts
+
+	if _, err := os.Stat(path + ".journal"); !os.IsNotExist(err) {
+		t.Errorf("expected journal to be removed after compaction")
+	}
+	s, err := VerifyFile(path)
+	if err != nil {
+		t.Fatalf("snapshot invalid: %v", err)
+	}
+	for _, name := range []string{"alice", "bob", "carol"} {
+		if _, ok := s.Users[name]; !ok {
+			t.Errorf("%s missing from compacted snapshot", name)
+		}
+	}
+
+	if err := m.Close(); err != nil {
+		t.Errorf("Close failed: %v", err)
+	}
+}
+
+func TestJournalStore_MigratesOldRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(path, []byte(`{"users": {}, "version": 2}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	record := `{"version": 1, "user": "alice", "data": {"sessions": [], "exceptions": [{"extra_hours": 15}]}}` + "\n"
+	if err := os.WriteFile(path+".journal", []byte(record), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewJournalStore(path).Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if o := s.Users["alice"].Overrides; len(o) != 1 || o[0].ExtraTime != 15 {
+		t.Errorf("old journal record was not migrated: %+v", o)
+	}
+}
+
+func TestManager_UpdateUser(t *testing.T) {
+	m := tempManager(t)
+
+	if err := m.UpdateUser("alice", false, func(u *session.User) error { return nil }); err == nil {
+		t.Errorf("expected error updating a missing user without create")
+	}
+
+	err := m.UpdateUser("alice", true, func(u *session.User) error {
+		u.Pause()
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("UpdateUser failed: %v", err)
+	}
+	if !m.state.Users["alice"].Paused {
+		t.Errorf("update was not applied")
+	}
+}
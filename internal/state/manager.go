@@ -1,7 +1,6 @@
 package state
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
@@ -11,23 +10,30 @@ import (
 	"github.com/SoarinFerret/SessionWarden/internal/session"
 )
 
-// Manager handles reading and writing state.json safely.
+// Manager owns the in-memory state and persists changes through a Store.
 type Manager struct {
-	path  string
-	mu    sync.Mutex
-	state *State
+	store      Store
+	mu         sync.Mutex
+	state      *State
+	changeHook func(username string)
 }
 
-// NewManager loads or initializes a new state manager.
+// NewManager loads or initializes a state manager backed by the JSON file
+// at path.
 func NewManager(path string) (*Manager, error) {
-	m := &Manager{path: path}
+	return NewManagerWithStore(NewFileStore(path))
+}
+
+// NewManagerWithStore loads or initializes a state manager backed by store.
+func NewManagerWithStore(store Store) (*Manager, error) {
+	m := &Manager{store: store}
 
 	if err := m.load(); err != nil {
 		if errors.Is(err, os.ErrNotExist) {
 			m.state = &State{
 				Users:     make(map[string]session.User),
 				HeartBeat: time.Now(),
-				Version:   1,
+				Version:   CurrentVersion,
 			}
 			if err := m.save(); err != nil {
 				return nil, err
@@ -42,51 +48,99 @@ func NewManager(path string) (*Manager, error) {
 	return m, nil
 }
 
-// load reads the state file into memory.
+// load reads the state from the store into memory.
 func (m *Manager) load() error {
-	var s State
-
-	// read mtime of file to set heartbeat
-	info, err := os.Stat(m.path)
+	s, err := m.store.Load()
 	if err != nil {
 		return err
 	}
-	s.HeartBeat = info.ModTime()
+	m.state = s
+	return nil
+}
 
-	data, err := os.ReadFile(m.path)
-	if err != nil {
+// UpdateUser is like Update for a change to a single user, so stores can
+// persist just that user. If the user doesn't exist, fn gets a new user when
+// create is true; otherwise the lookup error is returned.
+func (m *Manager) UpdateUser(username string, create bool, fn func(*session.User) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	previous, exists := m.state.Users[username]
+	if !exists && !create {
+		_, err := m.state.GetUser(username)
 		return err
 	}
 
-	if err := json.Unmarshal(data, &s); err != nil {
+	next := previous.Clone()
+	if next.Sessions == nil {
+		next.Sessions = []session.SessionRecord{}
+	}
+	if err := fn(&next); err != nil {
 		return err
 	}
 
-	m.state = &s
+	m.state.Users[username] = next
+	if err := m.saveUser(username); err != nil {
+		if exists {
+			m.state.Users[username] = previous
+		} else {
+			delete(m.state.Users, username)
+		}
+		return fmt.Errorf("failed to save state: %w", err)
+	}
 	return nil
 }
 
+// Close flushes the state to the store and releases it.
+func (m *Manager) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.save(); err != nil {
+		return err
+	}
+	return m.store.Close()
+}
+
 func (m *Manager) Heartbeat() {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	t := time.Now()
-	os.Chtimes(m.path, t, t)
+	m.store.Touch(t)
 	m.state.HeartBeat = t
 }
 
-// Save atomically writes the state file to disk.
+// SetChangeHook sets a function called after each change is saved, with
+// the user that changed, or "" if any user may have. It is called with the
+// manager locked, so it must not call back into the Manager.
+func (m *Manager) SetChangeHook(hook func(username string)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.changeHook = hook
+}
+
+// save writes the whole state to the store.
 func (m *Manager) save() error {
-	tmp := m.path + ".tmp"
-	data, err := json.MarshalIndent(m.state, "", "  ")
-	if err != nil {
+	if err := m.store.Save(m.state); err != nil {
 		return err
 	}
+	m.changed("")
+	return nil
+}
 
-	if err := os.WriteFile(tmp, data, 0644); err != nil {
+// saveUser writes a change to a single user, which stores like the journal
+// can persist without rewriting everything.
+func (m *Manager) saveUser(username string) error {
+	if err := m.store.SaveUser(m.state, username); err != nil {
 		return err
 	}
+	m.changed(username)
+	return nil
+}
 
-	return os.Rename(tmp, m.path)
+func (m *Manager) changed(username string) {
+	if m.changeHook != nil {
+		m.changeHook(username)
+	}
 }
 
 // StartUpChecks checks for power outages and cleans up sessions
@@ -126,6 +180,7 @@ func (m *Manager) startUpChecks() {
 	// Remove sessions from previous days
 	for uname, user := range m.state.Users {
 		user.RemoveOldSessions(now)
+		user.PruneHistory(now)
 		m.state.Users[uname] = user
 	}
 
@@ -161,16 +216,45 @@ func (m *Manager) CleanupOldSessions() {
 	}
 }
 
-// GetState returns the current state.
-func (m *Manager) GetState() *State {
+// PruneHistory removes history past its retention for all users and saves
+// the state. The daemon calls it daily, since it may run for weeks without
+// restarting.
+func (m *Manager) PruneHistory(now time.Time) error {
+	return m.Update(func(s *State) error {
+		for uname, user := range s.Users {
+			user.PruneHistory(now)
+			s.Users[uname] = user
+		}
+		return nil
+	})
+}
+
+// Snapshot returns a deep copy of the current state. It is safe to read
+// without holding the lock, and changes to it are not saved; use Update to
+// modify the state.
+func (m *Manager) Snapshot() State {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	return m.state
+	return m.state.Clone()
 }
 
-// Save atomically writes the state file to disk (public wrapper).
-func (m *Manager) Save() error {
+// Update runs fn against a copy of the state while holding the lock. If fn
+// returns an error, or the result cannot be saved, the state is left
+// unchanged and the error is returned.
+func (m *Manager) Update(fn func(*State) error) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	return m.save()
+
+	next := m.state.Clone()
+	if err := fn(&next); err != nil {
+		return err
+	}
+
+	previous := m.state
+	m.state = &next
+	if err := m.save(); err != nil {
+		m.state = previous
+		return fmt.Errorf("failed to save state: %w", err)
+	}
+	return nil
 }
@@ -1,8 +1,11 @@
 package state
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
@@ -41,7 +44,7 @@ func TestManager_SaveAndLoad(t *testing.T) {
 		t.Fatalf("save failed: %v", err)
 	}
 
-	m2 := &Manager{path: path}
+	m2 := &Manager{store: NewFileStore(path)}
 	if err := m2.load(); err != nil {
 		t.Fatalf("load failed: %v", err)
 	}
@@ -77,3 +80,144 @@ func TestManager_CleanupExpiredExceptions(t *testing.T) {
 		t.Errorf("CleanupExpiredExceptions did not filter expired exceptions")
 	}
 }
+
+func TestManager_PruneHistory(t *testing.T) {
+	path, cleanup := tempStateFile(t)
+	defer cleanup()
+	m, _ := NewManager(path)
+	now := time.Now()
+	old := session.HistoryEntry{Kind: session.HistoryLoginDenied, Time: now.Add(-31 * 24 * time.Hour)}
+	recent := session.HistoryEntry{Kind: session.HistoryLoginDenied, Time: now.Add(-time.Hour)}
+	m.state.Users["bob"] = session.User{History: []session.HistoryEntry{old, recent}}
+
+	if err := m.PruneHistory(now); err != nil {
+		t.Fatalf("PruneHistory failed: %v", err)
+	}
+	if h := m.state.Users["bob"].History; len(h) != 1 || !h[0].Time.Equal(recent.Time) {
+		t.Errorf("expected only the recent entry to be kept, got %+v", h)
+	}
+
+	// The pruned history is saved
+	s, err := VerifyFile(path)
+	if err != nil {
+		t.Fatalf("state file invalid: %v", err)
+	}
+	if h := s.Users["bob"].History; len(h) != 1 {
+		t.Errorf("expected 1 saved history entry, got %d", len(h))
+	}
+}
+
+func TestManager_UpdateAndSnapshot(t *testing.T) {
+	path, cleanup := tempStateFile(t)
+	defer cleanup()
+	m, _ := NewManager(path)
+
+	err := m.Update(func(st *State) error {
+		st.Users["alice"] = session.User{Paused: true}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	// Changes to a snapshot don't leak into the manager
+	snap := m.Snapshot()
+	u := snap.Users["alice"]
+	u.Paused = false
+	snap.Users["alice"] = u
+	snap.Users["bob"] = session.User{}
+	if !m.state.Users["alice"].Paused {
+		t.Errorf("snapshot change leaked into state")
+	}
+	if _, ok := m.state.Users["bob"]; ok {
+		t.Errorf("user added to snapshot leaked into state")
+	}
+
+	// A failed update leaves the state unchanged
+	err = m.Update(func(st *State) error {
+		delete(st.Users, "alice")
+		return errors.New("nope")
+	})
+	if err == nil {
+		t.Errorf("expected Update to return the error")
+	}
+	if _, ok := m.state.Users["alice"]; !ok {
+		t.Errorf("failed update was applied")
+	}
+
+	// Updates are persisted
+	m2 := &Manager{store: NewFileStore(path)}
+	if err := m2.load(); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if !m2.state.Users["alice"].Paused {
+		t.Errorf("update was not saved")
+	}
+}
+
+func TestManager_ConcurrentAccess(t *testing.T) {
+	path, cleanup := tempStateFile(t)
+	defer cleanup()
+	m, _ := NewManager(path)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(3)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				m.HandleLogin(fmt.Sprintf("user%d", i), fmt.Sprintf("s%d-%d", i, j))
+			}
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				m.Update(func(st *State) error {
+					u := st.Users[fmt.Sprintf("user%d", i)]
+					u.Paused = !u.Paused
+					st.Users[fmt.Sprintf("user%d", i)] = u
+					return nil
+				})
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				snap := m.Snapshot()
+				for _, u := range snap.Users {
+					u.GetTimeUsed()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	snap := m.Snapshot()
+	for i := 0; i < 4; i++ {
+		if n := len(snap.Users[fmt.Sprintf("user%d", i)].Sessions); n != 20 {
+			t.Errorf("user%d has %d sessions, want 20", i, n)
+		}
+	}
+}
+
+func TestManager_ChangeHook(t *testing.T) {
+	m := tempManager(t)
+
+	var changed []string
+	m.SetChangeHook(func(username string) {
+		changed = append(changed, username)
+	})
+
+	if err := m.UpdateUser("alice", true, func(u *session.User) error { return nil }); err != nil {
+		t.Fatalf("UpdateUser failed: %v", err)
+	}
+	// A failed update doesn't count as a change
+	m.UpdateUser("alice", false, func(u *session.User) error { return errors.New("no") })
+	if err := m.Update(func(s *State) error { return nil }); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	if fmt.Sprint(changed) != "[alice ]" {
+		t.Errorf("expected changes for alice then everyone, got %q", changed)
+	}
+}
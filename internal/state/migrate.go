@@ -0,0 +1,131 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/SoarinFerret/SessionWarden/internal/session"
+)
+
+// CurrentVersion is the state file schema version written by this build.
+const CurrentVersion = 3
+
+// ErrNewerVersion is returned when the state file was written by a newer
+// version of SessionWarden than this one.
+var ErrNewerVersion = errors.New("state file is from a newer version of SessionWarden")
+
+// A migration upgrades a raw state document by one version, from the version
+// at its index + 1. Migrations work on the decoded JSON rather than State so
+// they keep working as the Go types change.
+type migration func(doc map[string]any) error
+
+var migrations = []migration{
+	migrateV1ToV2,
+	migrateV2ToV3,
+}
+
+// migrate upgrades data to CurrentVersion one step at a time and returns the
+// upgraded JSON along with the version it started at. Files without a
+// version predate versioning and are treated as version 1.
+func migrate(data []byte) ([]byte, int, error) {
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, 0, err
+	}
+
+	version := 1
+	if v, ok := doc["version"].(float64); ok && v > 0 {
+		version = int(v)
+	}
+
+	if version > CurrentVersion {
+		return nil, version, fmt.Errorf("%w (file version %d, supported version %d)", ErrNewerVersion, version, CurrentVersion)
+	}
+	if version == CurrentVersion {
+		return data, version, nil
+	}
+
+	for v := version; v < CurrentVersion; v++ {
+		if err := migrations[v-1](doc); err != nil {
+			return nil, version, fmt.Errorf("failed to migrate state from version %d to %d: %w", v, v+1, err)
+		}
+		doc["version"] = v + 1
+	}
+
+	migrated, err := json.Marshal(doc)
+	if err != nil {
+		return nil, version, err
+	}
+	return migrated, version, nil
+}
+
+// migrateV1ToV2 renames the per-user "exceptions" list to "overrides", and
+// each override's "extra_hours" (which always held minutes) to
+// "extra_minutes".
+func migrateV1ToV2(doc map[string]any) error {
+	users, ok := doc["users"].(map[string]any)
+	if !ok {
+		return nil
+	}
+
+	for name, u := range users {
+		user, ok := u.(map[string]any)
+		if !ok {
+			return fmt.Errorf("user %s is not an object", name)
+		}
+
+		overrides, ok := user["exceptions"]
+		delete(user, "exceptions")
+		if !ok {
+			continue
+		}
+		list, ok := overrides.([]any)
+		if !ok {
+			// null or missing overrides
+			continue
+		}
+		for _, o := range list {
+			override, ok := o.(map[string]any)
+			if !ok {
+				return fmt.Errorf("override for user %s is not an object", name)
+			}
+			if extra, ok := override["extra_hours"]; ok {
+				override["extra_minutes"] = extra
+				delete(override, "extra_hours")
+			}
+		}
+		user["overrides"] = list
+	}
+	return nil
+}
+
+// migrateV2ToV3 gives each override an "id", so they can be edited and
+// removed without relying on their position in the list.
+func migrateV2ToV3(doc map[string]any) error {
+	users, ok := doc["users"].(map[string]any)
+	if !ok {
+		return nil
+	}
+
+	for name, u := range users {
+		user, ok := u.(map[string]any)
+		if !ok {
+			return fmt.Errorf("user %s is not an object", name)
+		}
+		list, ok := user["overrides"].([]any)
+		if !ok {
+			continue
+		}
+		for _, o := range list {
+			override, ok := o.(map[string]any)
+			if !ok {
+				return fmt.Errorf("override for user %s is not an object", name)
+			}
+			if id, _ := override["id"].(string); id == "" {
+				override["id"] = session.NewOverrideID()
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const stateV1 = `{
+  "users": {
+    "alice": {
+      "sessions": [],
+      "exceptions": [
+        {"reason": "homework", "extra_hours": 30, "expires_at": "2099-01-01T00:00:00Z"}
+      ],
+      "paused": false
+    },
+    "bob": {"sessions": [], "exceptions": null, "paused": true}
+  },
+  "version": 1
+}`
+
+func TestMigrate_V1ToCurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(path, []byte(stateV1), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := NewManager(path)
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+
+	if m.state.Version != CurrentVersion {
+		t.Errorf("expected version %d, got %d", CurrentVersion, m.state.Version)
+	}
+	alice := m.state.Users["alice"]
+	if len(alice.Overrides) != 1 || alice.Overrides[0].ExtraTime != 30 || alice.Overrides[0].Reason != "homework" {
+		t.Errorf("override not migrated: %+v", alice.Overrides)
+	}
+	if alice.Overrides[0].ID == "" {
+		t.Errorf("override was not given an ID")
+	}
+	if !m.state.Users["bob"].Paused {
+		t.Errorf("unrelated fields lost in migration")
+	}
+
+	// The original is backed up and the migrated file written back
+	backup, err := os.ReadFile(path + ".v1.bak")
+	if err != nil {
+		t.Fatalf("backup not written: %v", err)
+	}
+	if string(backup) != stateV1 {
+		t.Errorf("backup does not match the original file")
+	}
+	m2 := &Manager{store: NewFileStore(path)}
+	if err := m2.load(); err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	if m2.state.Users["alice"].Overrides[0].ExtraTime != 30 {
+		t.Errorf("migrated state was not saved")
+	}
+}
+
+func TestMigrate_UnversionedIsV1(t *testing.T) {
+	data, from, err := migrate([]byte(`{"users": {"alice": {"exceptions": [{"extra_hours": 5}]}}}`))
+	if err != nil {
+		t.Fatalf("migrate failed: %v", err)
+	}
+	if from != 1 {
+		t.Errorf("expected unversioned file to be treated as version 1, got %d", from)
+	}
+	if _, v, _ := migrate(data); v != CurrentVersion {
+		t.Errorf("expected migrated data at version %d, got %d", CurrentVersion, v)
+	}
+}
+
+func TestMigrate_RefusesNewerVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	newer := []byte(`{"users": {}, "version": 99}`)
+	if err := os.WriteFile(path, newer, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewManager(path); !errors.Is(err, ErrNewerVersion) {
+		t.Fatalf("expected ErrNewerVersion, got %v", err)
+	}
+
+	// The file must be left alone
+	data, _ := os.ReadFile(path)
+	if string(data) != string(newer) {
+		t.Errorf("newer state file was modified")
+	}
+}
+
+func TestMigrate_V2ToV3KeepsIDs(t *testing.T) {
+	data, _, err := migrate([]byte(`{"users": {"alice": {"overrides": [{"id": "keepme"}, {"reason": "new"}]}}, "version": 2}`))
+	if err != nil {
+		t.Fatalf("migrate failed: %v", err)
+	}
+
+	var s State
+	if err := json.Unmarshal(data, &s); err != nil {
+		t.Fatal(err)
+	}
+	overrides := s.Users["alice"].Overrides
+	if overrides[0].ID != "keepme" {
+		t.Errorf("existing ID was replaced with %q", overrides[0].ID)
+	}
+	if overrides[1].ID == "" || overrides[1].ID == overrides[0].ID {
+		t.Errorf("expected a new unique ID, got %q", overrides[1].ID)
+	}
+}
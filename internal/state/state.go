@@ -12,6 +12,20 @@ type State struct {
 	Users     map[string]session.User `json:"users"`
 	Version   int                     `json:"version"`
 	HeartBeat time.Time               `json:"-"` // not stored in JSON
+
+	// Generation counts the snapshots written by JournalStore, so journal
+	// records written before the current snapshot can be told apart
+	Generation uint64 `json:"generation,omitempty"`
+}
+
+// Clone returns a deep copy of the state
+func (s *State) Clone() State {
+	clone := *s
+	clone.Users = make(map[string]session.User, len(s.Users))
+	for name, user := range s.Users {
+		clone.Users[name] = user.Clone()
+	}
+	return clone
 }
 
 func (s *State) GetUser(username string) (*session.User, error) {
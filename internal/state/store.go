@@ -0,0 +1,20 @@
+package state
+
+import "time"
+
+// Store persists the daemon's state. Implementations only need to be safe
+// for use by a single Manager, which serializes calls.
+type Store interface {
+	// Load returns the stored state, or an error wrapping os.ErrNotExist if
+	// nothing has been stored yet.
+	Load() (*State, error)
+	// Save persists the whole state.
+	Save(s *State) error
+	// SaveUser persists a change to a single user in s.
+	SaveUser(s *State, username string) error
+	// Touch records that the daemon was alive at t, which is used to find
+	// sessions that ended when the system lost power.
+	Touch(t time.Time) error
+	// Close releases any open files.
+	Close() error
+}
@@ -0,0 +1,78 @@
+// Package supervisor runs the daemon's long-lived components together, so
+// that one failing takes the whole daemon down (for systemd to restart)
+// instead of leaving it running half-broken.
+package supervisor
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+)
+
+// Component is a long-running part of the daemon. Run should call ready once
+// it is serving, and return when ctx is cancelled.
+type Component struct {
+	Name string
+	Run  func(ctx context.Context, ready func()) error
+}
+
+// Run starts every component and blocks until ctx is cancelled or one of them
+// stops. A component stopping on its own, with or without an error, cancels
+// the others and is reported in the returned error. onReady (if not nil) is
+// called once, after every component has called ready.
+func Run(ctx context.Context, components []Component, onReady func()) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		failure   error
+		remaining = len(components)
+	)
+
+	markReady := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		remaining--
+		if remaining == 0 && onReady != nil {
+			onReady()
+		}
+	}
+
+	for _, c := range components {
+		wg.Add(1)
+		go func(c Component) {
+			defer wg.Done()
+
+			var once sync.Once
+			err := c.Run(ctx, func() { once.Do(markReady) })
+
+			if ctx.Err() != nil {
+				// Shutting down; errors from the teardown are expected
+				if err != nil {
+					slog.Debug("Component stopped", "component", c.Name, "error", err)
+				}
+				return
+			}
+
+			if err == nil {
+				err = fmt.Errorf("%s stopped unexpectedly", c.Name)
+			} else {
+				err = fmt.Errorf("%s failed: %w", c.Name, err)
+			}
+			slog.Error("Component stopped - shutting down", "component", c.Name, "error", err)
+
+			mu.Lock()
+			if failure == nil {
+				failure = err
+			}
+			mu.Unlock()
+			cancel()
+		}(c)
+	}
+
+	wg.Wait()
+	return failure
+}
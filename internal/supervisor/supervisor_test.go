@@ -0,0 +1,80 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// waiter is a component that reports ready and runs until cancelled
+func waiter(name string) Component {
+	return Component{Name: name, Run: func(ctx context.Context, ready func()) error {
+		ready()
+		<-ctx.Done()
+		return nil
+	}}
+}
+
+func TestRun_FailureStopsOthers(t *testing.T) {
+	boom := errors.New("boom")
+	components := []Component{
+		waiter("watcher"),
+		{Name: "dbus", Run: func(ctx context.Context, ready func()) error {
+			return boom
+		}},
+		waiter("engine"),
+	}
+
+	readyCalled := false
+	done := make(chan error)
+	go func() {
+		done <- Run(context.Background(), components, func() { readyCalled = true })
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, boom) {
+			t.Errorf("expected the component's error, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after a component failed")
+	}
+	if readyCalled {
+		t.Errorf("onReady called although a component never became ready")
+	}
+}
+
+func TestRun_UnexpectedStop(t *testing.T) {
+	components := []Component{
+		waiter("watcher"),
+		{Name: "engine", Run: func(ctx context.Context, ready func()) error {
+			ready()
+			return nil
+		}},
+	}
+
+	if err := Run(context.Background(), components, nil); err == nil {
+		t.Errorf("expected an error when a component stops on its own")
+	}
+}
+
+func TestRun_ReadyAndShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ready := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- Run(ctx, []Component{waiter("a"), waiter("b")}, func() { close(ready) })
+	}()
+
+	select {
+	case <-ready:
+	case <-time.After(time.Second):
+		t.Fatal("onReady was not called")
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("expected clean shutdown, got %v", err)
+	}
+}
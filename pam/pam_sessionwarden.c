@@ -4,6 +4,7 @@
 #include <dbus/dbus.h>
 #include <stdlib.h>
 #include <stdio.h>
+#include <stdarg.h>
 #include <string.h>
 #include <stdbool.h>
 #include <syslog.h>
@@ -18,13 +19,100 @@
 #define OBJECT_PATH    "/io/github/soarinferret/sessionwarden"
 #define INTERFACE_NAME "io.github.soarinferret.sessionwarden.Manager"
 
-/* List of group names to bypass DBus check for */
-static const char *BYPASS_GROUPS[] = { "wheel", "sudo" };
-static const int NBYPASS = sizeof(BYPASS_GROUPS)/sizeof(BYPASS_GROUPS[0]);
+#define MAX_BYPASS_GROUPS 32
+#define MAX_GROUP_NAME    64
 
-/* Check if user is in any of groups in BYPASS_GROUPS */
-static bool user_in_any_group(const char *username)
+/* Groups bypassing the DBus check when neither the module arguments nor
+   the daemon supply any */
+static const char *DEFAULT_BYPASS_GROUPS[] = { "wheel", "sudo" };
+static const int NDEFAULT_BYPASS = sizeof(DEFAULT_BYPASS_GROUPS)/sizeof(DEFAULT_BYPASS_GROUPS[0]);
+
+/*
+ * Module arguments, e.g. in /etc/pam.d/login:
+ *   auth required pam_sessionwarden.so bypass_group=wheel timeout_ms=5000 fail_open debug log_file=/var/log/sessionwarden/pam.log
+ *
+ * bypass_group=NAME  group allowed without asking the daemon (repeatable);
+ *                    if none are given, the daemon's exempt_groups are used
+ * timeout_ms=N       D-Bus call timeout (default: the D-Bus default of 25s)
+ * fail_open          allow logins when the daemon can't be reached
+ * fail_closed        deny logins when the daemon can't be reached (default)
+ * debug              write debug messages to syslog (and log_file, if set)
+ * log_file=PATH      also append debug messages to PATH
+ */
+struct module_options {
+    const char *bypass_groups[MAX_BYPASS_GROUPS];
+    int nbypass;
+    int timeout_ms;
+    bool fail_open;
+    bool debug;
+    const char *log_file;
+};
+
+static void parse_options(pam_handle_t *pamh, int argc, const char **argv, struct module_options *opts)
+{
+    memset(opts, 0, sizeof(*opts));
+    opts->timeout_ms = -1; /* libdbus default */
+
+    for (int i = 0; i < argc; ++i) {
+        const char *arg = argv[i];
+        if (strncmp(arg, "bypass_group=", 13) == 0) {
+            if (opts->nbypass < MAX_BYPASS_GROUPS) {
+                opts->bypass_groups[opts->nbypass++] = arg + 13;
+            } else {
+                pam_syslog(pamh, LOG_WARNING, "too many bypass_group arguments, ignoring %s", arg + 13);
+            }
+        } else if (strncmp(arg, "timeout_ms=", 11) == 0) {
+            char *end = NULL;
+            long timeout = strtol(arg + 11, &end, 10);
+            if (end == arg + 11 || *end != '\0' || timeout <= 0 || timeout > 0x7fffffff) {
+                pam_syslog(pamh, LOG_WARNING, "invalid timeout_ms %s, using default", arg + 11);
+            } else {
+                opts->timeout_ms = (int)timeout;
+            }
+        } else if (strcmp(arg, "fail_open") == 0) {
+            opts->fail_open = true;
+        } else if (strcmp(arg, "fail_closed") == 0) {
+            opts->fail_open = false;
+        } else if (strcmp(arg, "debug") == 0) {
+            opts->debug = true;
+        } else if (strncmp(arg, "log_file=", 9) == 0) {
+            opts->log_file = arg + 9;
+        } else {
+            pam_syslog(pamh, LOG_WARNING, "unknown option: %s", arg);
+        }
+    }
+}
+
+/* Write a debug message to syslog and optionally to the configured log file */
+static void debug_log(pam_handle_t *pamh, const struct module_options *opts, const char *fmt, ...)
+    __attribute__((format(printf, 3, 4)));
+
+static void debug_log(pam_handle_t *pamh, const struct module_options *opts, const char *fmt, ...)
 {
+    if (!opts->debug) return;
+
+    char message[512];
+    va_list ap;
+    va_start(ap, fmt);
+    vsnprintf(message, sizeof(message), fmt, ap);
+    va_end(ap);
+
+    pam_syslog(pamh, LOG_DEBUG, "%s", message);
+
+    if (opts->log_file && opts->log_file[0] != '\0') {
+        FILE *logfile = fopen(opts->log_file, "a");
+        if (logfile) {
+            fprintf(logfile, "%s\n", message);
+            fclose(logfile);
+        }
+    }
+}
+
+/* Check if user is in any of the given groups */
+static bool user_in_any_group(const char *username, const char *const *group_names, int ngroup_names)
+{
+    if (ngroup_names <= 0) return false;
+
     struct passwd pwd, *pw = NULL;
     long pw_buf_len = sysconf(_SC_GETPW_R_SIZE_MAX);
     if (pw_buf_len == -1) pw_buf_len = 16384;
@@ -37,8 +125,9 @@ static bool user_in_any_group(const char *username)
     }
 
     /* Resolve target group GIDs */
-    gid_t target_gids[NBYPASS];
-    for (int i = 0; i < NBYPASS; ++i) {
+    gid_t target_gids[MAX_BYPASS_GROUPS];
+    if (ngroup_names > MAX_BYPASS_GROUPS) ngroup_names = MAX_BYPASS_GROUPS;
+    for (int i = 0; i < ngroup_names; ++i) {
         struct group grp, *gr = NULL;
         long gr_buf_len = sysconf(_SC_GETGR_R_SIZE_MAX);
         if (gr_buf_len == -1) gr_buf_len = 16384;
@@ -47,7 +136,7 @@ static bool user_in_any_group(const char *username)
             free(pw_buf);
             return false;
         }
-        if (getgrnam_r(BYPASS_GROUPS[i], &grp, gr_buf, gr_buf_len, &gr) == 0 && gr != NULL) {
+        if (getgrnam_r(group_names[i], &grp, gr_buf, gr_buf_len, &gr) == 0 && gr != NULL) {
             target_gids[i] = gr->gr_gid;
         } else {
             /* group not found: set to an impossible GID */
@@ -74,7 +163,7 @@ static bool user_in_any_group(const char *username)
 
     /* Now check primary gid and supplementary groups for any target gid */
     bool found = false;
-    for (int i = 0; i < NBYPASS && !found; ++i) {
+    for (int i = 0; i < ngroup_names && !found; ++i) {
         if (target_gids[i] == (gid_t)-1) continue; /* group doesn't exist on system */
         if (pw->pw_gid == target_gids[i]) { found = true; break; }
         for (int j = 0; j < ngroups; ++j) {
@@ -87,123 +176,249 @@ static bool user_in_any_group(const char *username)
     return found;
 }
 
-// method to write to pam_sessionwarden.log for debugging
-static void debug_log(pam_handle_t *pamh, const char *message) {
-    FILE *logfile = fopen("/tmp/sessionwarden_pam.log", "a");
-    if (logfile) {
-        fprintf(logfile, "%s\n", message);
-        fclose(logfile);
-    }
-}
-
-static DBusConnection *connect_system_bus(pam_handle_t *pamh) {
+static DBusConnection *connect_system_bus(pam_handle_t *pamh, const struct module_options *opts) {
     DBusError err;
     dbus_error_init(&err);
 
     DBusConnection *conn = dbus_bus_get(DBUS_BUS_SYSTEM, &err);
     if (dbus_error_is_set(&err)) {
         pam_syslog(pamh, LOG_ERR, "D-Bus connection error: %s", err.message);
-        debug_log(pamh, "D-Bus connection error");
+        debug_log(pamh, opts, "D-Bus connection error: %s", err.message);
         dbus_error_free(&err);
         return NULL;
     }
     return conn;
 }
 
-static bool check_login_allowed(DBusConnection *conn, pam_handle_t *pamh, const char *user) {
+/* Exempt groups supplied by the daemon (config.toml [pam] exempt_groups) */
+struct group_list {
+    char names[MAX_BYPASS_GROUPS][MAX_GROUP_NAME];
+    const char *ptrs[MAX_BYPASS_GROUPS];
+    int n;
+};
+
+/* Ask the daemon for its exempt groups. Returns false if the call failed. */
+static bool fetch_exempt_groups(DBusConnection *conn, pam_handle_t *pamh,
+                                const struct module_options *opts, struct group_list *list) {
+    DBusMessage *msg, *reply;
+    DBusMessageIter args, array;
+    DBusError err;
+    dbus_error_init(&err);
+    list->n = 0;
+
+    msg = dbus_message_new_method_call(
+        SERVICE_NAME, OBJECT_PATH,
+        INTERFACE_NAME, "GetExemptGroups"
+    );
+    if (!msg) {
+        debug_log(pamh, opts, "Failed to create D-Bus message");
+        return false;
+    }
+
+    reply = dbus_connection_send_with_reply_and_block(conn, msg, opts->timeout_ms, &err);
+    dbus_message_unref(msg);
+
+    if (dbus_error_is_set(&err)) {
+        debug_log(pamh, opts, "GetExemptGroups failed: %s", err.message);
+        dbus_error_free(&err);
+        return false;
+    }
+
+    if (!dbus_message_iter_init(reply, &args)
+        || dbus_message_iter_get_arg_type(&args) != DBUS_TYPE_ARRAY
+        || dbus_message_iter_get_element_type(&args) != DBUS_TYPE_STRING) {
+        debug_log(pamh, opts, "Unexpected GetExemptGroups reply type");
+        dbus_message_unref(reply);
+        return false;
+    }
+
+    dbus_message_iter_recurse(&args, &array);
+    while (dbus_message_iter_get_arg_type(&array) == DBUS_TYPE_STRING && list->n < MAX_BYPASS_GROUPS) {
+        const char *name = NULL;
+        dbus_message_iter_get_basic(&array, &name);
+        snprintf(list->names[list->n], MAX_GROUP_NAME, "%s", name);
+        list->ptrs[list->n] = list->names[list->n];
+        list->n++;
+        dbus_message_iter_next(&array);
+    }
+
+    dbus_message_unref(reply);
+    return true;
+}
+
+/* Result of the CheckLoginDetailed D-Bus call */
+struct login_decision {
+    bool allowed;
+    char reason[64];
+    char message[256];
+    dbus_int64_t next_allowed; /* unix seconds, 0 if unknown */
+};
+
+/* Append a string key/value pair to an a{ss} dictionary */
+static void append_context(DBusMessageIter *dict, const char *key, const char *value)
+{
+    DBusMessageIter entry;
+    if (!value) value = "";
+    dbus_message_iter_open_container(dict, DBUS_TYPE_DICT_ENTRY, NULL, &entry);
+    dbus_message_iter_append_basic(&entry, DBUS_TYPE_STRING, &key);
+    dbus_message_iter_append_basic(&entry, DBUS_TYPE_STRING, &value);
+    dbus_message_iter_close_container(dict, &entry);
+}
+
+/* Append a PAM item (service, rhost, tty) to the context dictionary */
+static void append_pam_item(pam_handle_t *pamh, DBusMessageIter *dict, const char *key, int item_type)
+{
+    const void *item = NULL;
+    if (pam_get_item(pamh, item_type, &item) != PAM_SUCCESS) item = NULL;
+    append_context(dict, key, (const char *)item);
+}
+
+/* Ask the daemon whether the user may log in. Returns false if the call
+   itself failed, in which case decision is not filled in. */
+static bool check_login_detailed(DBusConnection *conn, pam_handle_t *pamh, const struct module_options *opts,
+                                 const char *user, const char *phase, struct login_decision *decision) {
     DBusMessage *msg, *reply;
-    DBusMessageIter args;
+    DBusMessageIter args, dict;
     DBusError err;
     dbus_error_init(&err);
 
     msg = dbus_message_new_method_call(
         SERVICE_NAME, OBJECT_PATH,
-        INTERFACE_NAME, "CheckLogin"
+        INTERFACE_NAME, "CheckLoginDetailed"
     );
     if (!msg) {
         pam_syslog(pamh, LOG_ERR, "Failed to create D-Bus message");
-        debug_log(pamh, "Failed to create D-Bus message");
+        debug_log(pamh, opts, "Failed to create D-Bus message");
         return false;
     }
 
-    // Add username as argument
-    dbus_message_append_args(msg, DBUS_TYPE_STRING, &user, DBUS_TYPE_INVALID);
+    // Add username and PAM context as arguments
+    dbus_message_iter_init_append(msg, &args);
+    dbus_message_iter_append_basic(&args, DBUS_TYPE_STRING, &user);
+    dbus_message_iter_open_container(&args, DBUS_TYPE_ARRAY, "{ss}", &dict);
+    append_pam_item(pamh, &dict, "service", PAM_SERVICE);
+    append_pam_item(pamh, &dict, "rhost", PAM_RHOST);
+    append_pam_item(pamh, &dict, "tty", PAM_TTY);
+    append_context(&dict, "phase", phase);
+    dbus_message_iter_close_container(&args, &dict);
 
     // Send message and wait for reply
-    reply = dbus_connection_send_with_reply_and_block(conn, msg, -1, &err);
+    reply = dbus_connection_send_with_reply_and_block(conn, msg, opts->timeout_ms, &err);
     dbus_message_unref(msg);
 
     if (dbus_error_is_set(&err)) {
         pam_syslog(pamh, LOG_ERR, "D-Bus call failed: %s", err.message);
-        // Log detailed error message
-        char debug_msg[256];
-        snprintf(debug_msg, sizeof(debug_msg), "D-Bus call failed for user %s: %s", user, err.message);
-        debug_log(pamh, debug_msg);
+        debug_log(pamh, opts, "D-Bus call failed for user %s: %s", user, err.message);
         dbus_error_free(&err);
         return false;
     }
 
-    // Extract boolean result
-    bool allowed = false;
-    if (!dbus_message_iter_init(reply, &args)) {
-        pam_syslog(pamh, LOG_ERR, "D-Bus reply has no arguments");
-        debug_log(pamh, "D-Bus reply has no arguments");
-    } else if (DBUS_TYPE_BOOLEAN != dbus_message_iter_get_arg_type(&args)) {
-        pam_syslog(pamh, LOG_ERR, "Unexpected D-Bus reply type");
-        debug_log(pamh, "Unexpected D-Bus reply type");
-    } else {
-        dbus_message_iter_get_basic(&args, &allowed);
+    // Extract (allowed, reason, next_allowed, message)
+    dbus_bool_t allowed = FALSE;
+    const char *reason = "";
+    const char *message = "";
+    dbus_int64_t next_allowed = 0;
+    if (!dbus_message_get_args(reply, &err,
+                               DBUS_TYPE_BOOLEAN, &allowed,
+                               DBUS_TYPE_STRING, &reason,
+                               DBUS_TYPE_INT64, &next_allowed,
+                               DBUS_TYPE_STRING, &message,
+                               DBUS_TYPE_INVALID)) {
+        pam_syslog(pamh, LOG_ERR, "Unexpected D-Bus reply: %s", err.message);
+        debug_log(pamh, opts, "Unexpected D-Bus reply type");
+        dbus_error_free(&err);
+        dbus_message_unref(reply);
+        return false;
     }
 
+    decision->allowed = allowed ? true : false;
+    decision->next_allowed = next_allowed;
+    snprintf(decision->reason, sizeof(decision->reason), "%s", reason);
+    snprintf(decision->message, sizeof(decision->message), "%s", message);
+
     dbus_message_unref(reply);
-    return allowed;
+    return true;
+}
+
+/* Result when the daemon can't be asked, depending on fail_open/fail_closed */
+static int daemon_unavailable(pam_handle_t *pamh, const struct module_options *opts, const char *user)
+{
+    if (opts->fail_open) {
+        pam_syslog(pamh, LOG_WARNING, "sessionwarden unavailable, allowing %s (fail_open)", user);
+        return PAM_SUCCESS;
+    }
+    pam_syslog(pamh, LOG_WARNING, "sessionwarden unavailable, denying %s (fail_closed)", user);
+    return PAM_PERM_DENIED;
 }
 
 /* Common implementation for both auth and account management */
-static int sessionwarden_check(pam_handle_t *pamh, const char *phase) {
-    pam_syslog(pamh, LOG_NOTICE, "sessionwarden called for %s", phase);
+static int sessionwarden_check(pam_handle_t *pamh, const char *phase, int argc, const char **argv) {
+    struct module_options opts;
+    parse_options(pamh, argc, argv, &opts);
 
-    char debug_msg[256];
-    snprintf(debug_msg, sizeof(debug_msg), "sessionwarden check called in %s phase", phase);
-    debug_log(pamh, debug_msg);
+    pam_syslog(pamh, LOG_NOTICE, "sessionwarden called for %s", phase);
+    debug_log(pamh, &opts, "sessionwarden check called in %s phase", phase);
 
     const char *user = NULL;
     pam_get_user(pamh, &user, NULL);
     if (!user) {
-        debug_log(pamh, "No user found");
+        debug_log(pamh, &opts, "No user found");
         return PAM_PERM_DENIED;
     }
 
-    // check if user is in wheel or sudo group
-    // if so, allow without checking
-    // (this is to allow root and sudo users to always login/unlock)
-    if (user_in_any_group(user)) {
-        debug_log(pamh, "User is in bypass group, allowing");
+    // if username is root, allow without checking
+    if (strcmp(user, "root") == 0) {
+        debug_log(pamh, &opts, "User is root, allowing");
         return PAM_SUCCESS;
     }
 
-    // if username is root, allow without checking
-    if (strcmp(user, "root") == 0) {
-        debug_log(pamh, "User is root, allowing");
+    DBusConnection *conn = connect_system_bus(pamh, &opts);
+
+    // check if user is in a bypass group, and if so, allow without checking
+    // (this is to allow admins to always login/unlock). Groups come from the
+    // module arguments, then the daemon's config, then the built-in defaults.
+    struct group_list daemon_groups;
+    const char *const *bypass = opts.bypass_groups;
+    int nbypass = opts.nbypass;
+    if (nbypass == 0) {
+        if (conn && fetch_exempt_groups(conn, pamh, &opts, &daemon_groups)) {
+            bypass = daemon_groups.ptrs;
+            nbypass = daemon_groups.n;
+        } else {
+            bypass = DEFAULT_BYPASS_GROUPS;
+            nbypass = NDEFAULT_BYPASS;
+        }
+    }
+    if (user_in_any_group(user, bypass, nbypass)) {
+        debug_log(pamh, &opts, "User %s is in bypass group, allowing", user);
         return PAM_SUCCESS;
     }
 
-    DBusConnection *conn = connect_system_bus(pamh);
     if (!conn) {
-        debug_log(pamh, "Failed to connect to D-Bus system bus");
-        return PAM_PERM_DENIED;
+        debug_log(pamh, &opts, "Failed to connect to D-Bus system bus");
+        return daemon_unavailable(pamh, &opts, user);
     }
 
-    bool allowed = check_login_allowed(conn, pamh, user);
-    if (!allowed) {
-        snprintf(debug_msg, sizeof(debug_msg), "Access denied by sessionwarden for %s", user);
-        debug_log(pamh, debug_msg);
-        pam_syslog(pamh, LOG_NOTICE, "sessionwarden denied access for %s", user);
+    struct login_decision decision = { 0 };
+    if (!check_login_detailed(conn, pamh, &opts, user, phase, &decision)) {
+        return daemon_unavailable(pamh, &opts, user);
+    }
+
+    if (!decision.allowed) {
+        debug_log(pamh, &opts, "Access denied by sessionwarden for %s (%s)", user, decision.reason);
+        pam_syslog(pamh, LOG_NOTICE, "sessionwarden denied access for %s: %s", user, decision.reason);
+        // Tell the user why, e.g. "Daily limit reached, next login allowed at 08:00"
+        if (decision.message[0] != '\0') {
+            pam_error(pamh, "%s", decision.message);
+        }
         return PAM_PERM_DENIED;
     }
 
-    snprintf(debug_msg, sizeof(debug_msg), "Access allowed by sessionwarden for %s", user);
-    debug_log(pamh, debug_msg);
+    if (decision.message[0] != '\0') {
+        pam_info(pamh, "%s", decision.message);
+    }
+
+    debug_log(pamh, &opts, "Access allowed by sessionwarden for %s", user);
 
     return PAM_SUCCESS;
 }
@@ -213,7 +428,7 @@ PAM_EXTERN int pam_sm_authenticate(pam_handle_t *pamh, int flags,
     // Called during auth phase (login AND screen unlock)
     // Does NOT verify password - that's pam_unix.so's job
     // Only checks if user should be allowed based on time limits
-    return sessionwarden_check(pamh, "authentication");
+    return sessionwarden_check(pamh, "authentication", argc, argv);
 }
 
 PAM_EXTERN int pam_sm_setcred(pam_handle_t *pamh, int flags,
@@ -226,5 +441,5 @@ PAM_EXTERN int pam_sm_setcred(pam_handle_t *pamh, int flags,
 PAM_EXTERN int pam_sm_acct_mgmt(pam_handle_t *pamh, int flags,
                                    int argc, const char **argv) {
     // Called during account management phase (login only, not unlock)
-    return sessionwarden_check(pamh, "account management");
+    return sessionwarden_check(pamh, "account management", argc, argv);
 }